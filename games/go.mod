@@ -1,3 +1,7 @@
 module games
 
 go 1.23.0
+
+require core v0.0.0
+
+replace core => ../core
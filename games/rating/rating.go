@@ -0,0 +1,158 @@
+// Package rating computes skill ratings from match results with the Elo and
+// Glicko-2 systems.
+//
+// Glicko-2 follows Mark Glickman's "Example of the Glicko-2 system",
+// http://www.glicko.net/glicko/glicko2.pdf.
+package rating
+
+import (
+	"math"
+)
+
+// Defaults for new players and for the systems' parameters.
+const (
+	DefaultRating     = 1500.0
+	DefaultDeviation  = 350.0
+	DefaultVolatility = 0.06
+	DefaultEloK       = 32.0
+	DefaultTau        = 0.5
+)
+
+// Elo rates players with the Elo system, updating ratings after every match.
+type Elo struct {
+	// K is the most a rating can change in a single game
+	K float64
+}
+
+// Expected returns the score a player rated a is expected to make against one rated b,
+// between 0 for a sure loss and 1 for a sure win.
+func (e Elo) Expected(a, b float64) float64 {
+	return 1 / (1 + math.Pow(10, (b-a)/400))
+}
+
+// Update returns the ratings of a and b after a game in which a scored score,
+// 1 for a win, 0.5 for a draw and 0 for a loss.
+func (e Elo) Update(a, b, score float64) (float64, float64) {
+	change := e.K * (score - e.Expected(a, b))
+	return a + change, b - change
+}
+
+// Rating is a Glicko-2 rating.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+// NewRating returns the rating of a player who hasn't played yet.
+func NewRating() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultDeviation, Volatility: DefaultVolatility}
+}
+
+// Result is the outcome of a game against an opponent.
+type Result struct {
+	Opponent Rating
+	// Score is 1 for a win, 0.5 for a draw and 0 for a loss
+	Score float64
+}
+
+// Glicko2 rates players with the Glicko-2 system, updating ratings once per rating period
+// from every game played in it.
+type Glicko2 struct {
+	// Tau constrains how much volatility can change, sensible values are 0.3 to 1.2
+	Tau float64
+}
+
+// glicko2Scale converts between the Glicko and Glicko-2 scales.
+const glicko2Scale = 173.7178
+
+// convergence is the tolerance of the volatility iteration.
+const convergence = 0.000001
+
+// Rate returns the player's rating after a rating period with the given results.
+// Opponents' ratings are as they were at the start of the period. A player with
+// no results only grows less certain, their deviation grows by their volatility.
+func (g Glicko2) Rate(player Rating, results []Result) Rating {
+	mu := (player.Rating - DefaultRating) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	sigma := player.Volatility
+
+	if len(results) == 0 {
+		return inactive(player, 1)
+	}
+
+	// Step 3 and 4, the estimated variance from the games and the improvement over the expected scores
+	var vInverse, improvement float64
+	for _, result := range results {
+		muJ := (result.Opponent.Rating - DefaultRating) / glicko2Scale
+		gJ := g.g(result.Opponent.Deviation / glicko2Scale)
+		expected := 1 / (1 + math.Exp(-gJ*(mu-muJ)))
+		vInverse += gJ * gJ * expected * (1 - expected)
+		improvement += gJ * (result.Score - expected)
+	}
+	v := 1 / vInverse
+	delta := v * improvement
+
+	// Step 5, the new volatility
+	sigma = g.volatility(phi, sigma, v, delta)
+
+	// Step 6 and 7, the new deviation and rating
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * improvement
+
+	return Rating{
+		Rating:     mu*glicko2Scale + DefaultRating,
+		Deviation:  phi * glicko2Scale,
+		Volatility: sigma,
+	}
+}
+
+func (g Glicko2) g(phi float64) float64 {
+	return 1 / math.Sqrt(1+3*phi*phi/(math.Pi*math.Pi))
+}
+
+// volatility finds the new volatility with the Illinois algorithm, as in step 5 of the paper.
+func (g Glicko2) volatility(phi, sigma, v, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	tau2 := g.Tau * g.Tau
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/tau2
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*g.Tau) < 0 {
+			k++
+		}
+		B = a - k*g.Tau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > convergence {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// inactive returns the rating of a player who played no games for the given number
+// of rating periods. Only the deviation changes, growing with the volatility up to that
+// of a new player.
+func inactive(player Rating, periods float64) Rating {
+	drift := player.Volatility * glicko2Scale
+	player.Deviation = min(math.Sqrt(player.Deviation*player.Deviation+periods*drift*drift), DefaultDeviation)
+	return player
+}
@@ -0,0 +1,201 @@
+package rating
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func assertClose(t *testing.T, what string, got, want, tolerance float64) {
+	t.Helper()
+	if math.Abs(got-want) > tolerance {
+		t.Errorf("got %s %v want %v", what, got, want)
+	}
+}
+
+func TestElo(t *testing.T) {
+	elo := Elo{K: 32}
+
+	assertClose(t, "expected score of equals", elo.Expected(1500, 1500), 0.5, 1e-9)
+	// 400 points ahead is 10 to 1 favourite
+	assertClose(t, "expected score 400 points ahead", elo.Expected(1900, 1500), 10.0/11, 1e-9)
+
+	winner, loser := elo.Update(1500, 1500, 1)
+	assertClose(t, "winner", winner, 1516, 1e-9)
+	assertClose(t, "loser", loser, 1484, 1e-9)
+
+	// An upset moves ratings further than an expected result
+	upsetWinner, _ := elo.Update(1500, 1900, 1)
+	expectedWinner, _ := elo.Update(1900, 1500, 1)
+	if upsetWinner-1500 <= expectedWinner-1900 {
+		t.Errorf("expected an upset to gain more than %v, got %v", expectedWinner-1900, upsetWinner-1500)
+	}
+
+	draw, _ := Elo{K: 10}.Update(1500, 1500, 0.5)
+	assertClose(t, "draw between equals", draw, 1500, 1e-9)
+}
+
+func TestGlicko2(t *testing.T) {
+	glicko := Glicko2{Tau: 0.5}
+
+	t.Run("Glickman's worked example", func(t *testing.T) {
+		player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+		got := glicko.Rate(player, []Result{
+			{Opponent: Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, Score: 1},
+			{Opponent: Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, Score: 0},
+			{Opponent: Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, Score: 0},
+		})
+
+		assertClose(t, "rating", got.Rating, 1464.06, 0.01)
+		assertClose(t, "deviation", got.Deviation, 151.52, 0.01)
+		assertClose(t, "volatility", got.Volatility, 0.05999, 0.00001)
+	})
+
+	t.Run("no games only grows the deviation", func(t *testing.T) {
+		player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+		got := glicko.Rate(player, nil)
+
+		assertClose(t, "rating", got.Rating, 1500, 0)
+		assertClose(t, "deviation", got.Deviation, 200.27, 0.01)
+		assertClose(t, "volatility", got.Volatility, 0.06, 0)
+	})
+
+	t.Run("winning raises the rating", func(t *testing.T) {
+		got := glicko.Rate(NewRating(), []Result{{Opponent: NewRating(), Score: 1}})
+		if got.Rating <= DefaultRating || got.Deviation >= DefaultDeviation {
+			t.Errorf("expected a higher, more certain rating, got %+v", got)
+		}
+	})
+}
+
+func TestTable(t *testing.T) {
+	day := 24 * time.Hour
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	newTable := func() (*Table, *time.Time) {
+		now := start
+		table := NewTable(Config{EloK: 32, Period: day})
+		table.now = func() time.Time { return now }
+		return table, &now
+	}
+
+	t.Run("Elo changes with every match", func(t *testing.T) {
+		table, _ := newTable()
+		table.Record("Alice", []string{"Bob"})
+
+		alice, _ := table.Get("Alice")
+		bob, _ := table.Get("Bob")
+		assertClose(t, "Alice's Elo", alice.Elo, 1516, 1e-9)
+		assertClose(t, "Bob's Elo", bob.Elo, 1484, 1e-9)
+		if alice.Matches != 1 || bob.Matches != 1 {
+			t.Errorf("expected one match each, got %d and %d", alice.Matches, bob.Matches)
+		}
+	})
+
+	t.Run("a winner against several losers is rated against each", func(t *testing.T) {
+		table, _ := newTable()
+		table.Record("Alice", []string{"Bob", "Carol"})
+
+		alice, _ := table.Get("Alice")
+		carol, _ := table.Get("Carol")
+		assertClose(t, "Alice's Elo", alice.Elo, 1532, 1e-9)
+		assertClose(t, "Carol's Elo", carol.Elo, 1484, 1e-9)
+		if alice.Matches != 1 {
+			t.Errorf("expected one match for Alice, got %d", alice.Matches)
+		}
+	})
+
+	t.Run("Glicko-2 changes when the period ends", func(t *testing.T) {
+		table, now := newTable()
+		table.Record("Alice", []string{"Bob"})
+
+		alice, _ := table.Get("Alice")
+		if alice.Glicko2 != NewRating() {
+			t.Errorf("expected no Glicko-2 change during the period, got %+v", alice.Glicko2)
+		}
+
+		*now = start.Add(day)
+		alice, _ = table.Get("Alice")
+		bob, _ := table.Get("Bob")
+		want := Glicko2{Tau: DefaultTau}.Rate(NewRating(), []Result{{Opponent: NewRating(), Score: 1}})
+		assertClose(t, "Alice's rating", alice.Glicko2.Rating, want.Rating, 1e-9)
+		if bob.Glicko2.Rating >= DefaultRating {
+			t.Errorf("expected Bob's rating to drop, got %+v", bob.Glicko2)
+		}
+	})
+
+	t.Run("idle periods grow the deviation", func(t *testing.T) {
+		table, now := newTable()
+		table.Record("Alice", []string{"Bob"})
+		*now = start.Add(day)
+		rated, _ := table.Get("Alice")
+
+		*now = start.Add(4 * day)
+		idle, _ := table.Get("Alice")
+		// The period ending at start+day was rated, then three more passed with no games
+		want := inactive(rated.Glicko2, 3)
+		assertClose(t, "deviation", idle.Glicko2.Deviation, want.Deviation, 1e-9)
+		assertClose(t, "rating", idle.Glicko2.Rating, rated.Glicko2.Rating, 0)
+
+		*now = start.Add(10000 * day)
+		forgotten, _ := table.Get("Alice")
+		assertClose(t, "deviation after years idle", forgotten.Glicko2.Deviation, DefaultDeviation, 1e-9)
+	})
+
+	t.Run("current period", func(t *testing.T) {
+		table, now := newTable()
+		*now = start.Add(day + time.Hour)
+		from, to := table.CurrentPeriod()
+		if want := start.Truncate(day).Add(day); !from.Equal(want) || !to.Equal(want.Add(day)) {
+			t.Errorf("got period %s to %s want %s to %s", from, to, want, want.Add(day))
+		}
+	})
+
+	t.Run("matches are rated in the periods they were played", func(t *testing.T) {
+		replayed, now := newTable()
+		*now = start.Add(10 * day)
+		replayed.RecordAt("Alice", []string{"Bob"}, start)
+		replayed.RecordAt("Bob", []string{"Alice"}, start.Add(day))
+
+		live, liveNow := newTable()
+		live.Record("Alice", []string{"Bob"})
+		*liveNow = start.Add(day)
+		live.Record("Bob", []string{"Alice"})
+		*liveNow = start.Add(10 * day)
+
+		got, _ := replayed.Get("Alice")
+		want, _ := live.Get("Alice")
+		if got != want {
+			t.Errorf("got %+v replayed want %+v", got, want)
+		}
+	})
+
+	t.Run("matches dated outside the clock's range don't move the periods", func(t *testing.T) {
+		table, now := newTable()
+		// Thousands of years of idle periods before the next match
+		table.RecordAt("Carol", []string{"Dave"}, time.Date(1, 1, 1, 0, 0, 1, 0, time.UTC))
+		table.RecordAt("Alice", []string{"Bob"}, start.Add(1000*day))
+
+		carol, _ := table.Get("Carol")
+		assertClose(t, "Carol's deviation", carol.Glicko2.Deviation, DefaultDeviation, 1e-9)
+		alice, _ := table.Get("Alice")
+		if alice.Glicko2 != NewRating() {
+			t.Errorf("expected a future match to be rated in the current period, got %+v", alice.Glicko2)
+		}
+		*now = start.Add(day)
+		alice, _ = table.Get("Alice")
+		if alice.Glicko2.Rating <= DefaultRating || alice.Glicko2.Deviation >= DefaultDeviation {
+			t.Errorf("expected the current period to be rated when it ends, got %+v", alice.Glicko2)
+		}
+	})
+
+	t.Run("unknown player", func(t *testing.T) {
+		table, _ := newTable()
+		if _, ok := table.Get("Nobody"); ok {
+			t.Error("expected no rating for a player who hasn't played")
+		}
+		if league := table.League(); len(league) != 0 {
+			t.Errorf("expected an empty league, got %v", league)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+package rating
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPeriod is the length of a Glicko-2 rating period.
+const DefaultPeriod = 24 * time.Hour
+
+// Config holds the parameters of a Table, zero values use the defaults.
+type Config struct {
+	// EloK is the Elo K-factor
+	EloK float64
+	// Tau is the Glicko-2 volatility constraint
+	Tau float64
+	// Period is the length of a Glicko-2 rating period. Periods start at
+	// multiples of it since the Unix epoch so replaying the same matches
+	// always gives the same ratings.
+	Period time.Duration
+}
+
+// PlayerRating is a player's rating in both systems.
+type PlayerRating struct {
+	Name    string  `json:"name"`
+	Elo     float64 `json:"elo"`
+	Glicko2 Rating  `json:"glicko2"`
+	// Matches is the number of matches the player has been rated on
+	Matches int `json:"matches"`
+}
+
+// pendingResult is a game played in the current rating period.
+type pendingResult struct {
+	opponent string
+	score    float64
+}
+
+// Table keeps the ratings of every player who has played a match. Elo ratings change
+// with every match, Glicko-2 ratings when the rating period the match was played in ends.
+// It is safe for concurrent use.
+type Table struct {
+	mu      sync.Mutex
+	elo     Elo
+	glicko  Glicko2
+	period  time.Duration
+	players map[string]*PlayerRating
+	// pending holds the results of the current rating period by player
+	pending map[string][]pendingResult
+	// periodEnd is when the current rating period ends, zero until the first match
+	periodEnd time.Time
+	// now is the table's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewTable creates an empty Table.
+func NewTable(cfg Config) *Table {
+	if cfg.EloK == 0 {
+		cfg.EloK = DefaultEloK
+	}
+	if cfg.Tau == 0 {
+		cfg.Tau = DefaultTau
+	}
+	if cfg.Period == 0 {
+		cfg.Period = DefaultPeriod
+	}
+	return &Table{
+		elo:     Elo{K: cfg.EloK},
+		glicko:  Glicko2{Tau: cfg.Tau},
+		period:  cfg.Period,
+		players: make(map[string]*PlayerRating),
+		pending: make(map[string][]pendingResult),
+		now:     time.Now,
+	}
+}
+
+// Record rates a match the winner just won against each of the losers.
+// Rating periods advance with the table's clock, so when a match says it was
+// played doesn't end periods early or hold them open. It counts towards the
+// current period, periods that have ended are never rated again.
+func (t *Table) Record(winner string, losers []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(t.now())
+	t.rate(winner, losers)
+}
+
+// RecordAt rates a match played at the given time, first ending the rating
+// periods that ended by then. Rating matches as they are recorded and again from
+// the history in the order they were played gives the same ratings. A match
+// dated after the table's clock is rated as if it was played now, one dated
+// before the current period counts towards the current one.
+func (t *Table) RecordAt(winner string, losers []string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if now := t.now(); at.After(now) {
+		at = now
+	}
+	t.advance(at)
+	t.rate(winner, losers)
+}
+
+// rate updates the ratings for a match the winner won against each of the losers.
+func (t *Table) rate(winner string, losers []string) {
+	w := t.player(winner)
+	// Every Elo change is against the ratings from before the match
+	winnerElo := w.Elo
+	for _, name := range losers {
+		l := t.player(name)
+		newWinner, newLoser := t.elo.Update(winnerElo, l.Elo, 1)
+		w.Elo += newWinner - winnerElo
+		l.Elo = newLoser
+		l.Matches++
+
+		t.pending[winner] = append(t.pending[winner], pendingResult{opponent: name, score: 1})
+		t.pending[name] = append(t.pending[name], pendingResult{opponent: winner, score: 0})
+	}
+	w.Matches++
+}
+
+// Get returns the named player's rating.
+func (t *Table) Get(name string) (PlayerRating, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(t.now())
+
+	p, ok := t.players[name]
+	if !ok {
+		return PlayerRating{}, false
+	}
+	return *p, true
+}
+
+// League returns the rating of every player, in no particular order.
+func (t *Table) League() []PlayerRating {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.advance(t.now())
+
+	league := make([]PlayerRating, 0, len(t.players))
+	for _, p := range t.players {
+		league = append(league, *p)
+	}
+	return league
+}
+
+// CurrentPeriod returns when the current rating period started and when it ends.
+// Matches dated in it are rated in it however they are recorded.
+func (t *Table) CurrentPeriod() (start, end time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	end = t.now().Truncate(t.period).Add(t.period)
+	return end.Add(-t.period), end
+}
+
+// player returns the named player's rating, adding a new player if needed.
+func (t *Table) player(name string) *PlayerRating {
+	p, ok := t.players[name]
+	if !ok {
+		p = &PlayerRating{Name: name, Elo: DefaultRating, Glicko2: NewRating()}
+		t.players[name] = p
+	}
+	return p
+}
+
+// advance closes every rating period that ended by the given time.
+func (t *Table) advance(at time.Time) {
+	end := at.Truncate(t.period).Add(t.period)
+	if t.periodEnd.IsZero() {
+		t.periodEnd = end
+		return
+	}
+	if !end.After(t.periodEnd) {
+		return
+	}
+
+	t.closePeriod()
+	// Nobody played in the periods since, so they only grow less certain.
+	// Sub saturates rather than overflowing, by then every deviation is at its maximum.
+	if idle := end.Sub(t.periodEnd)/t.period - 1; idle > 0 {
+		for _, p := range t.players {
+			p.Glicko2 = inactive(p.Glicko2, float64(idle))
+		}
+	}
+	t.periodEnd = end
+}
+
+// closePeriod rates every player on the results of the current period.
+func (t *Table) closePeriod() {
+	// Rate everyone against the ratings from the start of the period
+	rated := make(map[string]Rating, len(t.players))
+	for name, p := range t.players {
+		results := make([]Result, 0, len(t.pending[name]))
+		for _, r := range t.pending[name] {
+			results = append(results, Result{Opponent: t.players[r.opponent].Glicko2, Score: r.score})
+		}
+		rating := t.glicko.Rate(p.Glicko2, results)
+		rating.Deviation = min(rating.Deviation, DefaultDeviation)
+		rated[name] = rating
+	}
+	for name, rating := range rated {
+		t.players[name].Glicko2 = rating
+	}
+	clear(t.pending)
+}
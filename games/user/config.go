@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"games/rating"
+	"math"
+	"strconv"
+	"time"
+)
+
+// config holds the settings of the user service.
+// Each flag defaults to an environment variable so the binary can be configured either way,
+// flags given on the command line win.
+type config struct {
+	addr            string
+	storeType       string
+	storePath       string
+	autoCreate      bool
+	cacheEntries    int
+	cacheTTL        time.Duration
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	shutdownTimeout time.Duration
+	apiKeysPath     string
+	rateLimit       float64
+	rateBurst       int
+	rateBuckets     int
+	rateKey         string
+	idempotencyTTL  time.Duration
+	idempotencyKeys int
+	webhooks        bool
+	matchesPath     string
+	eloK            float64
+	glickoTau       float64
+	ratingPeriod    time.Duration
+	seasonsPath     string
+	seasonSchedule  string
+	// tokenSecret is only read from the environment so it doesn't show up in process listings
+	tokenSecret string
+}
+
+// parseConfig reads the config from args, falling back to getenv and then to built in defaults.
+func parseConfig(args []string, getenv func(string) string) (config, error) {
+	env := envDefaults{getenv: getenv}
+
+	cfg := config{}
+	fs := flag.NewFlagSet("runuser", flag.ContinueOnError)
+	fs.StringVar(&cfg.addr, "addr", env.string("USER_ADDR", ":5000"),
+		"listen address (env USER_ADDR)")
+	fs.StringVar(&cfg.storeType, "store", env.string("USER_STORE", "memory"),
+		"player store backend: memory, file or events (env USER_STORE)")
+	fs.StringVar(&cfg.storePath, "path", env.string("USER_STORE_PATH", ""),
+		"path of the scores file for the file store, default scores.json, or the log directory for the events store, default events (env USER_STORE_PATH)")
+	fs.BoolVar(&cfg.autoCreate, "autocreate", env.bool("USER_AUTOCREATE", false),
+		"create unknown players on their first win instead of requiring POST /user (env USER_AUTOCREATE)")
+	fs.IntVar(&cfg.cacheEntries, "cache", env.int("USER_CACHE_ENTRIES", 0),
+		"maximum number of players cached in front of the store, 0 disables the cache (env USER_CACHE_ENTRIES)")
+	fs.DurationVar(&cfg.cacheTTL, "cache-ttl", env.duration("USER_CACHE_TTL", 5*time.Second),
+		"how long players and the league are cached (env USER_CACHE_TTL)")
+	fs.DurationVar(&cfg.readTimeout, "read-timeout", env.duration("USER_READ_TIMEOUT", 5*time.Second),
+		"maximum duration for reading a request (env USER_READ_TIMEOUT)")
+	fs.DurationVar(&cfg.writeTimeout, "write-timeout", env.duration("USER_WRITE_TIMEOUT", 10*time.Second),
+		"maximum duration for writing a response (env USER_WRITE_TIMEOUT)")
+	fs.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", env.duration("USER_SHUTDOWN_TIMEOUT", 15*time.Second),
+		"how long to wait for in-flight requests to drain on shutdown (env USER_SHUTDOWN_TIMEOUT)")
+
+	fs.StringVar(&cfg.apiKeysPath, "api-keys", env.string("USER_API_KEYS", ""),
+		"file of API keys allowed to record wins (env USER_API_KEYS)")
+	fs.Float64Var(&cfg.rateLimit, "rate-limit", env.float("USER_RATE_LIMIT", 0),
+		"score changes allowed per second per rate key, 0 disables rate limiting (env USER_RATE_LIMIT)")
+	fs.IntVar(&cfg.rateBurst, "rate-burst", env.int("USER_RATE_BURST", 10),
+		"score changes allowed in a burst per rate key (env USER_RATE_BURST)")
+	fs.IntVar(&cfg.rateBuckets, "rate-buckets", env.int("USER_RATE_BUCKETS", 100000),
+		"maximum number of rate keys tracked, the least recently used are forgotten past it (env USER_RATE_BUCKETS)")
+	fs.StringVar(&cfg.rateKey, "rate-key", env.string("USER_RATE_KEY", "ip"),
+		"what score changes are rate limited by: ip, apikey or player (env USER_RATE_KEY)")
+	fs.DurationVar(&cfg.idempotencyTTL, "idempotency-ttl", env.duration("USER_IDEMPOTENCY_TTL", 10*time.Minute),
+		"how long responses to score changes with an Idempotency-Key are replayed, 0 disables it (env USER_IDEMPOTENCY_TTL)")
+	fs.IntVar(&cfg.idempotencyKeys, "idempotency-keys", env.int("USER_IDEMPOTENCY_KEYS", 10000),
+		"maximum number of idempotency keys remembered (env USER_IDEMPOTENCY_KEYS)")
+	fs.BoolVar(&cfg.webhooks, "webhooks", env.bool("USER_WEBHOOKS", false),
+		"deliver score changes to webhooks registered with POST /webhooks, needs api-keys or USER_TOKEN_SECRET (env USER_WEBHOOKS)")
+	fs.StringVar(&cfg.matchesPath, "matches", env.string("USER_MATCHES_PATH", ""),
+		"path of the match history log, match history is kept in memory if empty (env USER_MATCHES_PATH)")
+	fs.Float64Var(&cfg.eloK, "elo-k", env.float("USER_ELO_K", rating.DefaultEloK),
+		"Elo K-factor, the most a rating changes in one game (env USER_ELO_K)")
+	fs.Float64Var(&cfg.glickoTau, "glicko-tau", env.float("USER_GLICKO_TAU", rating.DefaultTau),
+		"Glicko-2 tau, how much volatility can change (env USER_GLICKO_TAU)")
+	fs.DurationVar(&cfg.ratingPeriod, "rating-period", env.duration("USER_RATING_PERIOD", rating.DefaultPeriod),
+		"length of a Glicko-2 rating period (env USER_RATING_PERIOD)")
+	fs.StringVar(&cfg.seasonsPath, "seasons", env.string("USER_SEASONS_PATH", ""),
+		"path of the season archive, seasons are kept in memory if empty (env USER_SEASONS_PATH)")
+	fs.StringVar(&cfg.seasonSchedule, "season-schedule", env.string("USER_SEASON_SCHEDULE", ""),
+		"when seasons close: weekly, monthly or a duration, empty only closes them with POST /seasons (env USER_SEASON_SCHEDULE)")
+	cfg.tokenSecret = getenv("USER_TOKEN_SECRET")
+
+	if env.err != nil {
+		return config{}, env.err
+	}
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+	if cfg.storePath == "" {
+		// The events store keeps a directory, which mustn't take the file store's file name
+		cfg.storePath = "scores.json"
+		if cfg.storeType == "events" {
+			cfg.storePath = "events"
+		}
+	}
+	if cfg.cacheEntries < 0 {
+		return config{}, fmt.Errorf("invalid cache %d, want at least 0", cfg.cacheEntries)
+	}
+	if cfg.cacheEntries > 0 && cfg.cacheTTL <= 0 {
+		return config{}, fmt.Errorf("invalid cache-ttl %s, want a positive duration", cfg.cacheTTL)
+	}
+	if !(cfg.rateLimit >= 0) || math.IsInf(cfg.rateLimit, 1) {
+		return config{}, fmt.Errorf("invalid rate-limit %v, want a finite rate of at least 0", cfg.rateLimit)
+	}
+	if cfg.rateLimit > 0 && cfg.rateBurst < 1 {
+		return config{}, fmt.Errorf("invalid rate-burst %d, want at least 1", cfg.rateBurst)
+	}
+	if cfg.rateLimit > 0 && cfg.rateBuckets < 1 {
+		return config{}, fmt.Errorf("invalid rate-buckets %d, want at least 1", cfg.rateBuckets)
+	}
+	if cfg.idempotencyTTL > 0 && cfg.idempotencyKeys < 1 {
+		return config{}, fmt.Errorf("invalid idempotency-keys %d, want at least 1", cfg.idempotencyKeys)
+	}
+	if cfg.webhooks && cfg.apiKeysPath == "" && cfg.tokenSecret == "" {
+		return config{}, errors.New("webhooks need authentication, set api-keys or USER_TOKEN_SECRET")
+	}
+	return cfg, nil
+}
+
+// envDefaults reads flag defaults from the environment, keeping the first parse error.
+type envDefaults struct {
+	getenv func(string) string
+	err    error
+}
+
+func (e *envDefaults) string(key, fallback string) string {
+	if v := e.getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (e *envDefaults) bool(key string, fallback bool) bool {
+	v := e.getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		e.fail(key, v, err)
+		return fallback
+	}
+	return b
+}
+
+func (e *envDefaults) int(key string, fallback int) int {
+	v := e.getenv(key)
+	if v == "" {
+		return fallback
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		e.fail(key, v, err)
+		return fallback
+	}
+	return i
+}
+
+func (e *envDefaults) float(key string, fallback float64) float64 {
+	v := e.getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		e.fail(key, v, err)
+		return fallback
+	}
+	return f
+}
+
+func (e *envDefaults) duration(key string, fallback time.Duration) time.Duration {
+	v := e.getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		e.fail(key, v, err)
+		return fallback
+	}
+	return d
+}
+
+func (e *envDefaults) fail(key, value string, err error) {
+	if e.err == nil {
+		e.err = fmt.Errorf("invalid %s=%q: %w", key, value, err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := parseConfig(nil, env(nil))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := config{
+			addr:            ":5000",
+			storeType:       "memory",
+			storePath:       "scores.json",
+			cacheTTL:        5 * time.Second,
+			readTimeout:     5 * time.Second,
+			writeTimeout:    10 * time.Second,
+			shutdownTimeout: 15 * time.Second,
+			rateBurst:       10,
+			rateBuckets:     100000,
+			rateKey:         "ip",
+			idempotencyTTL:  10 * time.Minute,
+			idempotencyKeys: 10000,
+			eloK:            32,
+			glickoTau:       0.5,
+			ratingPeriod:    24 * time.Hour,
+		}
+		if cfg != want {
+			t.Errorf("got %+v want %+v", cfg, want)
+		}
+	})
+
+	t.Run("environment overrides defaults and flags override environment", func(t *testing.T) {
+		cfg, err := parseConfig([]string{"-addr", ":6000"}, env(map[string]string{
+			"USER_ADDR":          ":7000",
+			"USER_STORE":         "file",
+			"USER_AUTOCREATE":    "true",
+			"USER_READ_TIMEOUT":  "1s",
+			"USER_WRITE_TIMEOUT": "2s",
+		}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cfg.addr != ":6000" {
+			t.Errorf("got addr %q want %q", cfg.addr, ":6000")
+		}
+		if cfg.storeType != "file" || !cfg.autoCreate {
+			t.Errorf("expected file store with autocreate, got %+v", cfg)
+		}
+		if cfg.readTimeout != time.Second || cfg.writeTimeout != 2*time.Second {
+			t.Errorf("got timeouts %s, %s want 1s, 2s", cfg.readTimeout, cfg.writeTimeout)
+		}
+	})
+
+	t.Run("stores default to their own path", func(t *testing.T) {
+		tests := []struct {
+			args []string
+			want string
+		}{
+			{[]string{"-store", "file"}, "scores.json"},
+			{[]string{"-store", "events"}, "events"},
+			{[]string{"-store", "events", "-path", "log"}, "log"},
+		}
+		for _, tt := range tests {
+			cfg, err := parseConfig(tt.args, env(nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cfg.storePath != tt.want {
+				t.Errorf("got path %q for %v want %q", cfg.storePath, tt.args, tt.want)
+			}
+		}
+	})
+
+	t.Run("invalid environment value is an error", func(t *testing.T) {
+		_, err := parseConfig(nil, env(map[string]string{"USER_READ_TIMEOUT": "soon"}))
+		if err == nil {
+			t.Error("expected an error for an invalid duration")
+		}
+	})
+
+	t.Run("invalid limits are an error", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"-cache", "-1"},
+			{"-cache", "100", "-cache-ttl", "0s"},
+			{"-rate-limit", "-1"},
+			{"-rate-limit", "NaN"},
+			{"-rate-limit", "+Inf"},
+			{"-rate-limit", "5", "-rate-burst", "0"},
+			{"-rate-limit", "5", "-rate-buckets", "0"},
+			{"-idempotency-keys", "0"},
+			{"-webhooks"},
+		} {
+			if _, err := parseConfig(args, env(nil)); err == nil {
+				t.Errorf("expected an error for %v", args)
+			}
+		}
+	})
+}
@@ -1,12 +1,206 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"games/rating"
 	"games/user/server"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	s := server.PlayerServer{}
-	log.Fatal(http.ListenAndServe(":5000", s.Handler))
+	cfg, err := parseConfig(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// run serves the user service on cfg.addr until ctx is done.
+func run(ctx context.Context, cfg config) error {
+	store, err := newStore(cfg.storeType, cfg.storePath)
+	if err != nil {
+		return err
+	}
+	if cfg.cacheEntries > 0 {
+		store = server.NewCachingPlayerStore(store, cfg.cacheEntries, cfg.cacheTTL)
+	}
+	listener, err := net.Listen("tcp", cfg.addr)
+	if err != nil {
+		if closer, ok := store.(io.Closer); ok {
+			closer.Close()
+		}
+		return err
+	}
+	return serve(ctx, cfg, store, listener)
+}
+
+// serve serves the user service backed by store on listener until ctx is done,
+// then drains in-flight requests and closes the store.
+func serve(ctx context.Context, cfg config, store server.PlayerStoreV2, listener net.Listener) (err error) {
+	defer listener.Close()
+	if closer, ok := store.(io.Closer); ok {
+		defer func() {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("closing store: %w", closeErr)
+			}
+		}()
+	}
+
+	s := server.NewPlayerServerV2(store)
+	s.AutoCreate = cfg.autoCreate
+	s.Auth, err = newAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.rateLimit > 0 {
+		key, err := rateLimitKey(cfg.rateKey)
+		if err != nil {
+			return err
+		}
+		s.RateLimits = []*server.RateLimiter{server.NewRateLimiter(cfg.rateLimit, cfg.rateBurst, cfg.rateBuckets, key)}
+	}
+	if cfg.idempotencyTTL > 0 {
+		s.Idempotency = server.NewIdempotencyCache(cfg.idempotencyTTL, cfg.idempotencyKeys)
+	}
+	s.Ratings = rating.NewTable(rating.Config{EloK: cfg.eloK, Tau: cfg.glickoTau, Period: cfg.ratingPeriod})
+	if cfg.matchesPath != "" {
+		var matches *server.FileSystemMatchStore
+		matches, err = server.NewFileSystemMatchStore(cfg.matchesPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := matches.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("closing match log: %w", closeErr)
+			}
+		}()
+		s.Matches = matches
+		// Ratings are only kept in memory, rebuild them from the match history
+		for _, m := range matches.AllMatches() {
+			s.Ratings.RecordAt(m.Winner, m.Losers, m.PlayedAt)
+		}
+	}
+	if cfg.seasonsPath != "" {
+		s.Seasons, err = server.NewFileSystemSeasonArchive(cfg.seasonsPath)
+		if err != nil {
+			return err
+		}
+	}
+	schedule, err := parseSeasonSchedule(cfg.seasonSchedule)
+	if err != nil {
+		return err
+	}
+	if cfg.webhooks {
+		s.Webhooks = server.NewWebhookDispatcher(server.WebhookConfig{})
+	}
+	s.Start()
+	if err := s.ResumeSeason(ctx); err != nil {
+		return fmt.Errorf("resuming season: %w", err)
+	}
+
+	httpServer := &http.Server{
+		Handler:      s,
+		ReadTimeout:  cfg.readTimeout,
+		WriteTimeout: cfg.writeTimeout,
+	}
+	// Event streams never finish by themselves, end them so Shutdown can drain
+	httpServer.RegisterOnShutdown(s.Events.Close)
+
+	if schedule != nil {
+		go closeSeasons(ctx, s, schedule)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("user service listening on %s with %s store", listener.Addr(), cfg.storeType)
+		serveErr <- httpServer.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, draining requests for up to %s", cfg.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutting down: %w", err)
+	}
+	// No more wins can be recorded, deliver what is queued in the time left
+	if s.Webhooks != nil {
+		if err := s.Webhooks.Close(shutdownCtx); err != nil {
+			log.Printf("abandoned webhook deliveries: %v", err)
+		}
+	}
+	return nil
+}
+
+// newStore creates the store selected by the config. Stores that can't fail are
+// adapted, the server reports the failures of the others to clients.
+func newStore(storeType, path string) (server.PlayerStoreV2, error) {
+	switch storeType {
+	case "memory":
+		return server.AdaptPlayerStore(server.NewInMemoryPlayerStore()), nil
+	case "file":
+		return server.NewFileSystemPlayerStore(path)
+	case "events":
+		return server.NewEventSourcedPlayerStore(path, server.EventStoreConfig{})
+	default:
+		return nil, fmt.Errorf("unknown store %q, want memory, file or events", storeType)
+	}
+}
+
+// newAuthenticator creates the Authenticator for the configured API keys and token secret.
+// With neither configured it returns nil, leaving score changes open.
+func newAuthenticator(cfg config) (server.Authenticator, error) {
+	var auth server.Authenticators
+	if cfg.apiKeysPath != "" {
+		keys, err := server.LoadAPIKeys(cfg.apiKeysPath)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, keys)
+	}
+	if cfg.tokenSecret != "" {
+		auth = append(auth, server.NewTokenAuthenticator([]byte(cfg.tokenSecret)))
+	}
+	if len(auth) == 0 {
+		log.Print("no API keys or token secret configured, anyone can record wins")
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// rateLimitKey returns the RateLimitKey selected by the config.
+func rateLimitKey(name string) (server.RateLimitKey, error) {
+	switch name {
+	case "ip":
+		return server.KeyByClientIP, nil
+	case "apikey":
+		return server.KeyByAPIKey, nil
+	case "player":
+		return server.KeyByPlayer, nil
+	default:
+		return nil, fmt.Errorf("unknown rate key %q, want ip, apikey or player", name)
+	}
 }
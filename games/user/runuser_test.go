@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"games/user/server"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStore holds RecordWin until release is closed, so a test can shut
+// down while the request is in flight.
+type blockingStore struct {
+	server.PlayerStoreV2
+	entered chan struct{}
+	release chan struct{}
+	closed  atomic.Bool
+}
+
+func (s *blockingStore) RecordWin(ctx context.Context, name string) error {
+	close(s.entered)
+	<-s.release
+	return s.PlayerStoreV2.RecordWin(ctx, name)
+}
+
+func (s *blockingStore) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestServe_GracefulShutdown(t *testing.T) {
+	cfg, err := parseConfig([]string{"-autocreate", "-shutdown-timeout", "5s"}, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store := &blockingStore{
+		PlayerStoreV2: server.AdaptPlayerStore(server.NewInMemoryPlayerStore()),
+		entered:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + listener.Addr().String()
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, cfg, store, listener) }()
+
+	stream, err := http.Get(base + "/league/events")
+	if err != nil {
+		t.Fatalf("unexpected error opening the event stream: %v", err)
+	}
+	defer stream.Body.Close()
+
+	recorded := make(chan *http.Response, 1)
+	go func() {
+		request, _ := http.NewRequest(http.MethodPut, base+"/user/Alice/score", nil)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Errorf("in-flight request failed: %v", err)
+			close(recorded)
+			return
+		}
+		response.Body.Close()
+		recorded <- response
+	}()
+	<-store.entered
+
+	shutdown()
+	// The stream is ended once shutdown has begun
+	if _, err := io.ReadAll(stream.Body); err != nil {
+		t.Errorf("expected the event stream to end cleanly, got %v", err)
+	}
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(store.release)
+	if response := <-recorded; response == nil || response.StatusCode != http.StatusAccepted {
+		t.Errorf("expected the in-flight request to complete with %d, got %v", http.StatusAccepted, response)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("unexpected error from serve: %v", err)
+	}
+	if !store.closed.Load() {
+		t.Error("expected the store to be closed")
+	}
+	if got, _ := store.GetPlayerScore(context.Background(), "Alice"); got != 1 {
+		t.Errorf("got score %d want 1", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"games/user/server"
+	"log"
+	"time"
+)
+
+// seasonSchedule returns when the season running at a given time ends.
+type seasonSchedule func(time.Time) time.Time
+
+// parseSeasonSchedule parses the -season-schedule flag: weekly seasons end at midnight UTC
+// on Monday, monthly ones at midnight UTC on the 1st, and a duration ends them at multiples
+// of it since the Unix epoch. An empty schedule returns nil, seasons are only closed by POST /seasons.
+func parseSeasonSchedule(schedule string) (seasonSchedule, error) {
+	switch schedule {
+	case "":
+		return nil, nil
+	case "weekly":
+		return func(t time.Time) time.Time {
+			t = t.UTC()
+			midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+			days := (8 - int(t.Weekday())) % 7
+			if days == 0 {
+				days = 7
+			}
+			return midnight.AddDate(0, 0, days)
+		}, nil
+	case "monthly":
+		return func(t time.Time) time.Time {
+			t = t.UTC()
+			return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		}, nil
+	}
+
+	d, err := time.ParseDuration(schedule)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("unknown season schedule %q, want weekly, monthly or a duration", schedule)
+	}
+	return func(t time.Time) time.Time {
+		return t.Truncate(d).Add(d)
+	}, nil
+}
+
+// seasonRetryDelay is how long closeSeasons waits before trying again after a failure.
+const seasonRetryDelay = time.Minute
+
+// closeSeasons closes the current season whenever the schedule says it ends, until ctx is done.
+// When a season ends is worked out from when it started, so a season that was due
+// to end while the service was down is closed as soon as it starts.
+func closeSeasons(ctx context.Context, s *server.PlayerServer, schedule seasonSchedule) {
+	for {
+		current, err := s.Seasons.CurrentSeason(ctx)
+		if err != nil {
+			log.Printf("reading current season: %v", err)
+			if !sleep(ctx, seasonRetryDelay) {
+				return
+			}
+			continue
+		}
+		if !sleep(ctx, time.Until(schedule(current.StartedAt))) {
+			return
+		}
+
+		season, err := s.CloseSeason(ctx)
+		if err != nil {
+			log.Printf("closing season: %v", err)
+			if !sleep(ctx, seasonRetryDelay) {
+				return
+			}
+			continue
+		}
+		log.Printf("closed season %d with %d players", season.ID, len(season.League))
+	}
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
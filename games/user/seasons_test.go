@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"games/user/server"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseSeasonSchedule(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2025, 6, 4, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		schedule string
+		at       time.Time
+		want     time.Time
+	}{
+		{"weekly", now, time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC)},
+		{"weekly", time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 16, 0, 0, 0, 0, time.UTC)},
+		{"monthly", now, time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"6h", now, time.Date(2025, 6, 4, 18, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			schedule, err := parseSeasonSchedule(tt.schedule)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := schedule(tt.at); !got.Equal(tt.want) {
+				t.Errorf("season running at %s ends %s want %s", tt.at, got, tt.want)
+			}
+		})
+	}
+
+	if schedule, err := parseSeasonSchedule(""); schedule != nil || err != nil {
+		t.Errorf("expected no schedule and no error for an empty schedule, got %v", err)
+	}
+	for _, invalid := range []string{"fortnightly", "-1h", "0s"} {
+		if _, err := parseSeasonSchedule(invalid); err == nil {
+			t.Errorf("expected an error for schedule %q", invalid)
+		}
+	}
+}
+
+func TestCloseSeasons(t *testing.T) {
+	// The current season started long before the service, so it is overdue
+	path := filepath.Join(t.TempDir(), "seasons.json")
+	if err := os.WriteFile(path, []byte(`{"startedAt":"2020-01-01T00:00:00Z","seasons":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := server.NewFileSystemSeasonArchive(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening archive: %v", err)
+	}
+	s := server.NewPlayerServer(server.NewInMemoryPlayerStore())
+	s.Seasons = archive
+	s.Start()
+	schedule, _ := parseSeasonSchedule("24h")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		closeSeasons(ctx, s, schedule)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		seasons, _ := archive.Seasons(ctx)
+		if len(seasons) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the overdue season to be closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The next season started when the overdue one was closed, it isn't due yet
+	time.Sleep(20 * time.Millisecond)
+	if seasons, _ := archive.Seasons(ctx); len(seasons) != 1 {
+		t.Errorf("expected one season to be closed, got %+v", seasons)
+	}
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// logFile is the file an appendLog writes to, an *os.File outside of tests.
+type logFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Seek(offset int64, whence int) (int64, error)
+	Close() error
+}
+
+// appendLog appends lines to a file, syncing each to disk before append returns.
+// A line whose write or sync fails is truncated away, so the next line doesn't
+// land after a torn one. If truncating fails too the log refuses further appends.
+// It does no locking, the owning store guards it.
+type appendLog struct {
+	file logFile
+	// size is the length of the log up to its last complete line
+	size int64
+	// failed is set once the log can't be appended to
+	failed error
+}
+
+// openAppendLog returns an appendLog writing to file after its first size bytes,
+// dropping anything past them such as a torn last line.
+func openAppendLog(file logFile, size int64) (*appendLog, error) {
+	l := &appendLog{file: file, size: size}
+	if err := l.truncate(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// append writes a line, which must end in a newline, and syncs it.
+func (l *appendLog) append(line []byte) error {
+	if l.failed != nil {
+		return l.failed
+	}
+	_, err := l.file.Write(line)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err == nil {
+		l.size += int64(len(line))
+		return nil
+	}
+
+	if terr := l.truncate(); terr != nil {
+		l.failed = fmt.Errorf("log is unusable after a failed write: %w", terr)
+		return errors.Join(err, l.failed)
+	}
+	return err
+}
+
+// truncate cuts the file back to size and moves the write offset there.
+func (l *appendLog) truncate() error {
+	if err := l.file.Truncate(l.size); err != nil {
+		return fmt.Errorf("truncating: %w", err)
+	}
+	if _, err := l.file.Seek(l.size, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking: %w", err)
+	}
+	return nil
+}
+
+// Close closes the file.
+func (l *appendLog) Close() error {
+	return l.file.Close()
+}
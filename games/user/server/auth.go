@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyHeader carries a static API key.
+const APIKeyHeader = "X-API-Key"
+
+// AnyPlayer in a Principal's players lets it record wins for every player.
+const AnyPlayer = "*"
+
+var (
+	// ErrNoCredentials is returned by an Authenticator when the request carries none of its credentials.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by an Authenticator when the request's credentials are wrong or expired.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	// Subject names the key or token holder, for logs
+	Subject string
+	// Players the principal may record wins for, AnyPlayer allows all of them
+	Players []string
+}
+
+// CanRecordFor reports whether the principal may record wins for the named player.
+func (p Principal) CanRecordFor(player string) bool {
+	return slices.Contains(p.Players, AnyPlayer) || slices.Contains(p.Players, player)
+}
+
+// Authenticator establishes who sent a request.
+// It returns ErrNoCredentials if the request has no credentials it understands
+// and ErrInvalidCredentials if they are wrong.
+type Authenticator interface {
+	Authenticate(r *http.Request) (Principal, error)
+}
+
+// Authenticators tries each Authenticator in turn, the first one that finds
+// credentials in the request decides.
+type Authenticators []Authenticator
+
+func (a Authenticators) Authenticate(r *http.Request) (Principal, error) {
+	for _, auth := range a {
+		principal, err := auth.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return principal, err
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// authorize checks the request may change the named player, writing a 401 or 403
+// and returning false if it may not. Every request is authorized when p.Auth is nil.
+func (p *PlayerServer) authorize(w http.ResponseWriter, r *http.Request, player string) bool {
+	_, ok := p.authenticate(w, r, player)
+	return ok
+}
+
+// authenticate is authorize returning who the request was authenticated as.
+// The principal is empty when p.Auth is nil.
+func (p *PlayerServer) authenticate(w http.ResponseWriter, r *http.Request, player string) (Principal, bool) {
+	if p.Auth == nil {
+		return Principal{}, true
+	}
+
+	principal, err := p.Auth.Authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="players"`)
+		http.Error(w, fmt.Sprintf("unauthorized: %v", err), http.StatusUnauthorized)
+		return Principal{}, false
+	}
+	if !principal.CanRecordFor(player) {
+		http.Error(w, fmt.Sprintf("forbidden: %s may not change player %s", principal.Subject, player), http.StatusForbidden)
+		return Principal{}, false
+	}
+	return principal, true
+}
+
+// principalKey is the context key of the Principal a request was authenticated as.
+type principalKey struct{}
+
+// PrincipalFromContext returns the Principal a score change was authenticated as,
+// ok is false if it wasn't authenticated.
+func PrincipalFromContext(ctx context.Context) (principal Principal, ok bool) {
+	principal, ok = ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// --- API keys ---
+
+// APIKeyAuthenticator authenticates requests by a static key in the X-API-Key header.
+// Only hashes of the keys are kept so lookups don't leak key prefixes through timing.
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]Principal
+}
+
+// NewAPIKeyAuthenticator creates an APIKeyAuthenticator from keys mapped to their principals.
+func NewAPIKeyAuthenticator(keys map[string]Principal) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]Principal, len(keys))}
+	for key, principal := range keys {
+		a.keys[sha256.Sum256([]byte(key))] = principal
+	}
+	return a
+}
+
+// LoadAPIKeys reads API keys from a file with one key per line:
+//
+//	<key> <subject> <player>[,<player>...]
+//
+// where a player of * allows every player. Blank lines and lines starting with # are ignored.
+func LoadAPIKeys(path string) (*APIKeyAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening API keys: %w", err)
+	}
+	defer file.Close()
+
+	keys := make(map[string]Principal)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: want <key> <subject> <players>, got %d fields", path, line, len(fields))
+		}
+		if _, ok := keys[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate key for %s", path, line, fields[1])
+		}
+		keys[fields[0]] = Principal{Subject: fields[1], Players: strings.Split(fields[2], ",")}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading API keys: %w", err)
+	}
+	return NewAPIKeyAuthenticator(keys), nil
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	principal, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	return principal, nil
+}
+
+// --- Signed tokens ---
+
+// TokenClaims are carried by a signed bearer token.
+type TokenClaims struct {
+	Subject   string `json:"sub"`
+	Player    string `json:"player"`
+	ExpiresAt int64  `json:"exp"` // unix seconds
+}
+
+// TokenAuthenticator authenticates requests by an HMAC-SHA256 signed bearer token
+// in the Authorization header. A token is the base64url encoded JSON claims and
+// signature joined by a dot, and allows recording wins for its player claim only.
+type TokenAuthenticator struct {
+	secret []byte
+	// now is the authenticator's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewTokenAuthenticator creates a TokenAuthenticator that signs and verifies tokens with secret.
+func NewTokenAuthenticator(secret []byte) *TokenAuthenticator {
+	return &TokenAuthenticator{
+		secret: secret,
+		now:    time.Now,
+	}
+}
+
+// Issue returns a signed token for player, valid for ttl.
+func (a *TokenAuthenticator) Issue(subject, player string, ttl time.Duration) (string, error) {
+	claims := TokenClaims{
+		Subject:   subject,
+		Player:    player,
+		ExpiresAt: a.now().Add(ttl).Unix(),
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding token claims: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(a.sign(encoded)), nil
+}
+
+func (a *TokenAuthenticator) Authenticate(r *http.Request) (Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return Principal{}, ErrNoCredentials
+	}
+
+	encoded, signature, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, a.sign(encoded)) {
+		return Principal{}, fmt.Errorf("%w: bad token signature", ErrInvalidCredentials)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+	var claims TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed token claims", ErrInvalidCredentials)
+	}
+	if !a.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return Principal{}, fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	}
+	if claims.Player == "" {
+		return Principal{}, fmt.Errorf("%w: token has no player claim", ErrInvalidCredentials)
+	}
+	return Principal{Subject: claims.Subject, Players: []string{claims.Player}}, nil
+}
+
+// sign returns the HMAC-SHA256 of the encoded claims.
+func (a *TokenAuthenticator) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
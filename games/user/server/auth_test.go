@@ -0,0 +1,206 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayerServer_Auth(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tokens := NewTokenAuthenticator([]byte("test-secret"))
+	tokens.now = func() time.Time { return now }
+
+	aliceToken, err := tokens.Issue("alice-client", "Alice", time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error issuing token: %v", err)
+	}
+	forged := NewTokenAuthenticator([]byte("wrong-secret"))
+	forged.now = tokens.now
+	forgedToken, _ := forged.Issue("mallory", "Alice", time.Hour)
+
+	keys := NewAPIKeyAuthenticator(map[string]Principal{
+		"admin-key": {Subject: "admin", Players: []string{AnyPlayer}},
+		"bob-key":   {Subject: "bob-client", Players: []string{"Bob"}},
+	})
+
+	server, store := setupTestServer(t)
+	server.Auth = Authenticators{keys, tokens}
+	server.Start()
+
+	tests := []struct {
+		name           string
+		method         string
+		player         string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"GET stays public", http.MethodGet, "Alice", "", "", http.StatusOK},
+		{"PUT without credentials", http.MethodPut, "Alice", "", "", http.StatusUnauthorized},
+		{"PUT with unknown API key", http.MethodPut, "Alice", APIKeyHeader, "guess", http.StatusUnauthorized},
+		{"PUT with admin API key", http.MethodPut, "Alice", APIKeyHeader, "admin-key", http.StatusAccepted},
+		{"PUT with API key for the player", http.MethodPut, "Bob", APIKeyHeader, "bob-key", http.StatusAccepted},
+		{"PUT with API key for another player", http.MethodPut, "Alice", APIKeyHeader, "bob-key", http.StatusForbidden},
+		{"PUT with token for the player", http.MethodPut, "Alice", "Authorization", "Bearer " + aliceToken, http.StatusAccepted},
+		{"PUT with token for another player", http.MethodPut, "Bob", "Authorization", "Bearer " + aliceToken, http.StatusForbidden},
+		{"PUT with forged token", http.MethodPut, "Alice", "Authorization", "Bearer " + forgedToken, http.StatusUnauthorized},
+		{"PUT with malformed token", http.MethodPut, "Alice", "Authorization", "Bearer nonsense", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(tt.method, "/user/"+tt.player+"/score", nil)
+			if tt.header != "" {
+				request.Header.Set(tt.header, tt.value)
+			}
+			response := httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, request)
+
+			if response.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %q", response.Code, tt.expectedStatus, response.Body.String())
+			}
+			if response.Code == http.StatusUnauthorized && response.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected a WWW-Authenticate header on 401")
+			}
+			if response.Code >= 400 && strings.TrimSpace(response.Body.String()) == "" {
+				t.Error("expected rejected request to explain why")
+			}
+		})
+	}
+
+	if len(store.recordWinCalls) != 3 {
+		t.Errorf("expected only the 3 authorized PUTs to record wins, got %v", store.recordWinCalls)
+	}
+}
+
+func TestPlayerServer_AuthDelete(t *testing.T) {
+	store := NewInMemoryPlayerStore()
+	store.CreateUser(User{Name: "Alice"})
+	server := NewPlayerServer(store)
+	server.Auth = NewAPIKeyAuthenticator(map[string]Principal{
+		"bob-key": {Subject: "bob-client", Players: []string{"Bob"}},
+	})
+	server.Start()
+
+	request, _ := http.NewRequest(http.MethodDelete, "/user/Alice", nil)
+	request.Header.Set(APIKeyHeader, "bob-key")
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusForbidden {
+		t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusForbidden)
+	}
+	if _, ok := store.GetUser("Alice"); !ok {
+		t.Error("expected Alice not to be deleted")
+	}
+}
+
+func TestPlayerServer_AuthCreate(t *testing.T) {
+	store := NewInMemoryPlayerStore()
+	server := NewPlayerServer(store)
+	server.Auth = NewAPIKeyAuthenticator(map[string]Principal{
+		"bob-key": {Subject: "bob-client", Players: []string{"Bob"}},
+	})
+	server.Start()
+
+	tests := []struct {
+		name           string
+		player         string
+		key            string
+		expectedStatus int
+	}{
+		{"without credentials", "Alice", "", http.StatusUnauthorized},
+		{"with API key for another player", "Alice", "bob-key", http.StatusForbidden},
+		{"with API key for the player", "Bob", "bob-key", http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodPost, "/user", strings.NewReader(`{"name":"`+tt.player+`"}`))
+			if tt.key != "" {
+				request.Header.Set(APIKeyHeader, tt.key)
+			}
+			response := httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, request)
+
+			if response.Code != tt.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v, body %q", response.Code, tt.expectedStatus, response.Body.String())
+			}
+		})
+	}
+
+	if _, ok := store.GetUser("Alice"); ok {
+		t.Error("expected Alice not to be created")
+	}
+	if _, ok := store.GetUser("Bob"); !ok {
+		t.Error("expected Bob to be created")
+	}
+}
+
+func TestTokenAuthenticator_Expiry(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tokens := NewTokenAuthenticator([]byte("test-secret"))
+	tokens.now = func() time.Time { return now }
+
+	token, err := tokens.Issue("alice-client", "Alice", time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error issuing token: %v", err)
+	}
+	request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	if _, err := tokens.Authenticate(request); err != nil {
+		t.Errorf("unexpected error before expiry: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := tokens.Authenticate(request); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("got error %v after expiry, want %v", err, ErrInvalidCredentials)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "keys")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("loads keys and skips comments", func(t *testing.T) {
+		auth, err := LoadAPIKeys(write(t, "# game clients\n\nk1 admin *\nk2 league Alice,Bob\n"))
+		if err != nil {
+			t.Fatalf("unexpected error loading keys: %v", err)
+		}
+
+		request, _ := http.NewRequest(http.MethodPut, "/", nil)
+		request.Header.Set(APIKeyHeader, "k2")
+		principal, err := auth.Authenticate(request)
+		if err != nil {
+			t.Fatalf("unexpected error authenticating: %v", err)
+		}
+		if !principal.CanRecordFor("Bob") || principal.CanRecordFor("Charlie") {
+			t.Errorf("unexpected principal %+v", principal)
+		}
+	})
+
+	t.Run("malformed line is an error", func(t *testing.T) {
+		if _, err := LoadAPIKeys(write(t, "k1 admin\n")); err == nil {
+			t.Error("expected an error for a line without players")
+		}
+	})
+
+	t.Run("duplicate key is an error", func(t *testing.T) {
+		if _, err := LoadAPIKeys(write(t, "k1 a *\nk1 b *\n")); err == nil {
+			t.Error("expected an error for a duplicate key")
+		}
+	})
+}
@@ -0,0 +1,431 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CacheStats counts how a CachingPlayerStore served reads.
+type CacheStats struct {
+	// Hits were served from the cache
+	Hits uint64 `json:"hits"`
+	// Misses were read from the wrapped store
+	Misses uint64 `json:"misses"`
+	// Coalesced misses waited for a read of the same player already in flight
+	Coalesced uint64 `json:"coalesced"`
+	// Evictions were entries dropped to stay within the size bound
+	Evictions uint64 `json:"evictions"`
+	// Entries is how many players are cached
+	Entries int `json:"entries"`
+}
+
+// CachingPlayerStore caches the reads of a slow PlayerStoreV2. Players are kept in
+// a bounded LRU cache for a TTL and the league for the same TTL. Recording a win
+// drops the player and the league, so a read that starts after RecordWin returns
+// never sees the score from before it. Concurrent misses for the same player share
+// a single read of the wrapped store, a read that fails isn't cached.
+//
+// A cached player holds its score, version and user together, so GetPlayerScore,
+// GetPlayerScoreVersion and GetUser are all served from one read: GetUser if the
+// wrapped store is a UserStore, whose users must carry the version
+// GetPlayerScoreVersion reports, else GetPlayerScoreVersion or GetPlayerScore.
+// The other optional interfaces of the wrapped store are forwarded to it and
+// their writes drop what they change from the cache. PlayerServer only uses the
+// ones the wrapped store implements, called directly the others return
+// errors.ErrUnsupported.
+type CachingPlayerStore struct {
+	store      PlayerStoreV2
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*playerEntry
+	order   *list.List // entries least recently used first
+	loads   map[string]*cacheLoad[cachedPlayer]
+	league  []Player
+	// leagueExpires is zero when the league isn't cached
+	leagueExpires time.Time
+	leagueLoad    *cacheLoad[[]Player]
+	stats         CacheStats
+	// now is the cache's clock, replaced in tests
+	now func() time.Time
+}
+
+// cachedPlayer is what the cache holds for a player. user has the name, wins
+// and version of every player, the rest only when read from a UserStore.
+type cachedPlayer struct {
+	user User
+	// found is set when a UserStore has the user
+	found bool
+}
+
+// playerEntry is a cached player.
+type playerEntry struct {
+	name    string
+	player  cachedPlayer
+	expires time.Time
+	elem    *list.Element
+}
+
+// cacheLoad is a read of the wrapped store that concurrent misses wait for.
+// value and err are set once done is closed, ok is false if the read panicked.
+type cacheLoad[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+	ok    bool
+	// stale is set when a win is recorded during the read, its value isn't cached
+	stale bool
+}
+
+// NewCachingPlayerStore wraps store with a cache of up to maxEntries players kept for ttl.
+func NewCachingPlayerStore(store PlayerStoreV2, maxEntries int, ttl time.Duration) *CachingPlayerStore {
+	return &CachingPlayerStore{
+		store:      store,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*playerEntry),
+		order:      list.New(),
+		loads:      make(map[string]*cacheLoad[cachedPlayer]),
+		now:        time.Now,
+	}
+}
+
+// GetPlayerScore returns the player's cached score, reading it from the wrapped store on a miss.
+func (c *CachingPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	player, err := c.player(ctx, name)
+	return player.user.Wins, err
+}
+
+// RecordWin records the win in the wrapped store and drops the cached player and league.
+func (c *CachingPlayerStore) RecordWin(ctx context.Context, name string) error {
+	defer c.invalidate(name)
+	return c.store.RecordWin(ctx, name)
+}
+
+// GetLeague returns the cached league, reading it from the wrapped store on a miss.
+func (c *CachingPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	c.mu.Lock()
+	if !c.leagueExpires.IsZero() && c.now().Before(c.leagueExpires) {
+		c.stats.Hits++
+		league := slices.Clone(c.league)
+		c.mu.Unlock()
+		return league, nil
+	}
+	c.stats.Misses++
+
+	if load := c.leagueLoad; load != nil {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if load.ok && load.err == nil {
+			return slices.Clone(load.value), nil
+		}
+		// The read we waited for failed, try for ourselves
+		return c.store.GetLeague(ctx)
+	}
+	load := &cacheLoad[[]Player]{done: make(chan struct{})}
+	c.leagueLoad = load
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		if c.leagueLoad == load {
+			c.leagueLoad = nil
+		}
+		if load.ok && load.err == nil && !load.stale {
+			c.league = load.value
+			c.leagueExpires = c.now().Add(c.ttl)
+		}
+		c.mu.Unlock()
+		close(load.done)
+	}()
+	load.value, load.err = c.store.GetLeague(ctx)
+	load.ok = true
+	return slices.Clone(load.value), load.err
+}
+
+// player returns the named player from the cache, reading it from the wrapped store on a miss.
+func (c *CachingPlayerStore) player(ctx context.Context, name string) (cachedPlayer, error) {
+	c.mu.Lock()
+	if entry, ok := c.entries[name]; ok {
+		if c.now().Before(entry.expires) {
+			c.order.MoveToBack(entry.elem)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return entry.player, nil
+		}
+		c.remove(entry)
+	}
+	c.stats.Misses++
+
+	load, inFlight := c.loads[name]
+	if inFlight {
+		c.stats.Coalesced++
+		c.mu.Unlock()
+		select {
+		case <-load.done:
+		case <-ctx.Done():
+			return cachedPlayer{}, ctx.Err()
+		}
+		if load.ok && load.err == nil {
+			return load.value, nil
+		}
+		// The read we waited for failed, try for ourselves
+		return c.read(ctx, name)
+	}
+	load = &cacheLoad[cachedPlayer]{done: make(chan struct{})}
+	c.loads[name] = load
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		if c.loads[name] == load {
+			delete(c.loads, name)
+		}
+		if load.ok && load.err == nil && !load.stale {
+			c.add(name, load.value)
+		}
+		c.mu.Unlock()
+		close(load.done)
+	}()
+	load.value, load.err = c.read(ctx, name)
+	load.ok = true
+	return load.value, load.err
+}
+
+// read reads the named player from the wrapped store.
+func (c *CachingPlayerStore) read(ctx context.Context, name string) (cachedPlayer, error) {
+	if users, ok := asStore[UserStore](c.store); ok {
+		if err := ctx.Err(); err != nil {
+			return cachedPlayer{}, err
+		}
+		user, found := users.GetUser(name)
+		if !found {
+			user = User{Name: name}
+		}
+		return cachedPlayer{user: user, found: found}, nil
+	}
+	if versioned, ok := asStore[VersionedPlayerStore](c.store); ok {
+		score, version, err := versioned.GetPlayerScoreVersion(ctx, name)
+		return cachedPlayer{user: User{Name: name, Wins: score, Version: version}}, err
+	}
+	score, err := c.store.GetPlayerScore(ctx, name)
+	return cachedPlayer{user: User{Name: name, Wins: score}}, err
+}
+
+// GetUser returns the named user from the cache, reading it from the wrapped store on a miss.
+func (c *CachingPlayerStore) GetUser(name string) (User, bool) {
+	if _, ok := asStore[UserStore](c.store); !ok {
+		return User{}, false
+	}
+	player, err := c.player(context.Background(), name)
+	if err != nil || !player.found {
+		return User{}, false
+	}
+	user := player.user
+	user.Metadata = maps.Clone(user.Metadata)
+	return user, true
+}
+
+// CreateUser registers a user in the wrapped store and drops the cached score and league.
+func (c *CachingPlayerStore) CreateUser(user User) (User, error) {
+	users, ok := asStore[UserStore](c.store)
+	if !ok {
+		return User{}, errors.ErrUnsupported
+	}
+	defer c.invalidate(user.Name)
+	return users.CreateUser(user)
+}
+
+// DeleteUser removes a user from the wrapped store and drops the cached score and league.
+func (c *CachingPlayerStore) DeleteUser(name string) error {
+	users, ok := asStore[UserStore](c.store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	defer c.invalidate(name)
+	return users.DeleteUser(name)
+}
+
+// GetPlayerScoreVersion returns the player's cached score and version, reading
+// them from the wrapped store on a miss. They are cached together, so a version
+// is never older than the score served with it.
+func (c *CachingPlayerStore) GetPlayerScoreVersion(ctx context.Context, name string) (int, uint64, error) {
+	if _, ok := asStore[VersionedPlayerStore](c.store); !ok {
+		return 0, 0, errors.ErrUnsupported
+	}
+	player, err := c.player(ctx, name)
+	return player.user.Wins, player.user.Version, err
+}
+
+// RecordWinIfRegistered records a win for a registered player in the wrapped
+// store and drops the cached player and league.
+func (c *CachingPlayerStore) RecordWinIfRegistered(ctx context.Context, name string) error {
+	recorder, ok := asStore[RegisteredWinRecorder](c.store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	defer c.invalidate(name)
+	return recorder.RecordWinIfRegistered(ctx, name)
+}
+
+// RecordWinIfVersion records a win in the wrapped store and drops the cached score and league.
+func (c *CachingPlayerStore) RecordWinIfVersion(ctx context.Context, name string, version uint64) (uint64, error) {
+	versioned, ok := asStore[VersionedPlayerStore](c.store)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	defer c.invalidate(name)
+	return versioned.RecordWinIfVersion(ctx, name, version)
+}
+
+// DeleteUserIfVersion deletes a player from the wrapped store and drops the cached score and league.
+func (c *CachingPlayerStore) DeleteUserIfVersion(ctx context.Context, name string, version uint64) error {
+	versioned, ok := asStore[VersionedPlayerStore](c.store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	defer c.invalidate(name)
+	return versioned.DeleteUserIfVersion(ctx, name, version)
+}
+
+// ResetScores resets the scores in the wrapped store and drops every cached score and the league.
+func (c *CachingPlayerStore) ResetScores(ctx context.Context, season int, archive func(league []Player) error) error {
+	seasonal, ok := asStore[SeasonalPlayerStore](c.store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	defer c.invalidateAll()
+	return seasonal.ResetScores(ctx, season, archive)
+}
+
+// LastReset returns the season the wrapped store last reset.
+func (c *CachingPlayerStore) LastReset(ctx context.Context) (int, error) {
+	seasonal, ok := asStore[SeasonalPlayerStore](c.store)
+	if !ok {
+		return 0, errors.ErrUnsupported
+	}
+	return seasonal.LastReset(ctx)
+}
+
+// GetRank returns the named player's rank from the wrapped store.
+func (c *CachingPlayerStore) GetRank(ctx context.Context, name string) (RankedPlayer, error) {
+	ranked, ok := asStore[RankedPlayerStore](c.store)
+	if !ok {
+		return RankedPlayer{}, errors.ErrUnsupported
+	}
+	return ranked.GetRank(ctx, name)
+}
+
+// GetLeaderboard returns a page of the leaderboard from the wrapped store.
+func (c *CachingPlayerStore) GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error) {
+	ranked, ok := asStore[RankedPlayerStore](c.store)
+	if !ok {
+		return nil, 0, errors.ErrUnsupported
+	}
+	return ranked.GetLeaderboard(ctx, offset, limit)
+}
+
+// Ping checks the wrapped store is reachable.
+func (c *CachingPlayerStore) Ping(ctx context.Context) error {
+	pinger, ok := asStore[Pinger](c.store)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	return pinger.Ping(ctx)
+}
+
+// unwrapStore returns the wrapped store, so PlayerServer only uses the optional
+// interfaces it implements.
+func (c *CachingPlayerStore) unwrapStore() any {
+	return c.store
+}
+
+// Stats returns how reads have been served so far.
+func (c *CachingPlayerStore) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	return stats
+}
+
+// Close closes the wrapped store if it is an io.Closer.
+func (c *CachingPlayerStore) Close() error {
+	if closer, ok := c.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// invalidate drops the named player and the league after a write.
+func (c *CachingPlayerStore) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[name]; ok {
+		c.remove(entry)
+	}
+	// Reads in flight may have seen the score from before the write, later
+	// reads must not wait for them
+	if load, ok := c.loads[name]; ok {
+		load.stale = true
+		delete(c.loads, name)
+	}
+	c.invalidateLeague()
+}
+
+// invalidateAll drops every cached player and the league after a write that changed them all.
+func (c *CachingPlayerStore) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, entry := range c.entries {
+		c.remove(entry)
+	}
+	for name, load := range c.loads {
+		load.stale = true
+		delete(c.loads, name)
+	}
+	c.invalidateLeague()
+}
+
+// invalidateLeague drops the cached league. Callers must hold c.mu.
+func (c *CachingPlayerStore) invalidateLeague() {
+	c.leagueExpires = time.Time{}
+	c.league = nil
+	if c.leagueLoad != nil {
+		c.leagueLoad.stale = true
+		c.leagueLoad = nil
+	}
+}
+
+// add caches a player, evicting the least recently used players over the bound.
+// Callers must hold c.mu.
+func (c *CachingPlayerStore) add(name string, player cachedPlayer) {
+	if entry, ok := c.entries[name]; ok {
+		c.remove(entry)
+	}
+	entry := &playerEntry{name: name, player: player, expires: c.now().Add(c.ttl)}
+	entry.elem = c.order.PushBack(entry)
+	c.entries[name] = entry
+	for c.order.Len() > c.maxEntries {
+		c.remove(c.order.Front().Value.(*playerEntry))
+		c.stats.Evictions++
+	}
+}
+
+// remove drops a cached player. Callers must hold c.mu.
+func (c *CachingPlayerStore) remove(entry *playerEntry) {
+	c.order.Remove(entry.elem)
+	delete(c.entries, entry.name)
+}
@@ -0,0 +1,527 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// CountingPlayerStore is an InMemoryPlayerStore that counts reads and can hold
+// the next player read, after it has read the player, until released. Reads
+// take delay, to stand in for a slow store.
+type CountingPlayerStore struct {
+	*InMemoryPlayerStore
+	playerReads atomic.Int64
+	leagueReads atomic.Int64
+	delay       time.Duration
+
+	mu      sync.Mutex
+	hold    chan struct{}
+	holding chan struct{}
+}
+
+func NewCountingPlayerStore() *CountingPlayerStore {
+	return &CountingPlayerStore{InMemoryPlayerStore: NewInMemoryPlayerStore()}
+}
+
+// holdNextRead makes the next player read wait for release once it has read the
+// player, held is closed when it is waiting.
+func (s *CountingPlayerStore) holdNextRead() (held <-chan struct{}, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hold = make(chan struct{})
+	s.holding = make(chan struct{})
+	hold := s.hold
+	return s.holding, func() { close(hold) }
+}
+
+// read counts a player read and waits for it to be released if it is held.
+func (s *CountingPlayerStore) read() {
+	s.playerReads.Add(1)
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	hold, holding := s.hold, s.holding
+	s.hold, s.holding = nil, nil
+	s.mu.Unlock()
+	if hold != nil {
+		close(holding)
+		<-hold
+	}
+}
+
+func (s *CountingPlayerStore) GetPlayerScore(name string) int {
+	score := s.InMemoryPlayerStore.GetPlayerScore(name)
+	s.read()
+	return score
+}
+
+func (s *CountingPlayerStore) GetUser(name string) (User, bool) {
+	user, ok := s.InMemoryPlayerStore.GetUser(name)
+	s.read()
+	return user, ok
+}
+
+func (s *CountingPlayerStore) GetLeague() []Player {
+	s.leagueReads.Add(1)
+	time.Sleep(s.delay)
+	return s.InMemoryPlayerStore.GetLeague()
+}
+
+// FlakyPlayerStore is a PlayerStoreV2 whose score reads fail while failing is set.
+type FlakyPlayerStore struct {
+	PlayerStoreV2
+	failing atomic.Bool
+}
+
+func (s *FlakyPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	if s.failing.Load() {
+		return 0, ErrStoreUnavailable
+	}
+	return s.PlayerStoreV2.GetPlayerScore(ctx, name)
+}
+
+func newTestCache(maxEntries int) (*CachingPlayerStore, *CountingPlayerStore, *time.Time) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := NewCountingPlayerStore()
+	cache := NewCachingPlayerStore(AdaptPlayerStore(store), maxEntries, time.Minute)
+	cache.now = func() time.Time { return now }
+	return cache, store, &now
+}
+
+// cachedScore reads the player's score through the cache.
+func cachedScore(t *testing.T, cache *CachingPlayerStore, name string) int {
+	t.Helper()
+	score, err := cache.GetPlayerScore(context.Background(), name)
+	if err != nil {
+		t.Fatalf("unexpected error reading %s's score: %v", name, err)
+	}
+	return score
+}
+
+// cachedLeague reads the league through the cache.
+func cachedLeague(t *testing.T, cache *CachingPlayerStore) []Player {
+	t.Helper()
+	league, err := cache.GetLeague(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error reading the league: %v", err)
+	}
+	return league
+}
+
+func TestCachingPlayerStore(t *testing.T) {
+	t.Run("serves repeated reads from the cache until the TTL passes", func(t *testing.T) {
+		cache, store, now := newTestCache(10)
+		store.RecordWin("Alice")
+
+		for range 3 {
+			if got := cachedScore(t, cache, "Alice"); got != 1 {
+				t.Fatalf("got score %d want 1", got)
+			}
+		}
+		if reads := store.playerReads.Load(); reads != 1 {
+			t.Errorf("expected 1 read of the store, got %d", reads)
+		}
+
+		*now = now.Add(time.Minute)
+		cachedScore(t, cache, "Alice")
+		if reads := store.playerReads.Load(); reads != 2 {
+			t.Errorf("expected the expired score to be read again, got %d reads", reads)
+		}
+
+		want := CacheStats{Hits: 2, Misses: 2, Entries: 1}
+		if got := cache.Stats(); got != want {
+			t.Errorf("got stats %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("a win drops the cached score and league", func(t *testing.T) {
+		cache, _, _ := newTestCache(10)
+		cachedScore(t, cache, "Alice")
+		cachedLeague(t, cache)
+
+		cache.RecordWin(context.Background(), "Alice")
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got score %d after a win want 1", got)
+		}
+		if league := cachedLeague(t, cache); len(league) != 1 || league[0].Wins != 1 {
+			t.Errorf("got league %v after a win want Alice with 1 win", league)
+		}
+	})
+
+	t.Run("evicts the least recently used score", func(t *testing.T) {
+		cache, store, _ := newTestCache(2)
+		cachedScore(t, cache, "Alice")
+		cachedScore(t, cache, "Bob")
+		cachedScore(t, cache, "Alice")
+		cachedScore(t, cache, "Carol") // evicts Bob
+
+		before := store.playerReads.Load()
+		cachedScore(t, cache, "Alice")
+		if store.playerReads.Load() != before {
+			t.Error("expected Alice to still be cached")
+		}
+		cachedScore(t, cache, "Bob")
+		if store.playerReads.Load() != before+1 {
+			t.Error("expected Bob to have been evicted")
+		}
+		if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 2 {
+			t.Errorf("expected 2 entries after 2 evictions, got %+v", stats)
+		}
+	})
+
+	t.Run("the league is cached and callers own their copy", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		store.RecordWin("Alice")
+
+		league := cachedLeague(t, cache)
+		league[0].Wins = 100
+		if got := cachedLeague(t, cache); got[0].Wins != 1 {
+			t.Errorf("changing a returned league changed the cache, got %v", got)
+		}
+		if reads := store.leagueReads.Load(); reads != 1 {
+			t.Errorf("expected 1 read of the league, got %d", reads)
+		}
+	})
+
+	t.Run("concurrent misses share one read", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		store.RecordWin("Alice")
+		held, release := store.holdNextRead()
+
+		const readers = 10
+		scores := make(chan int, readers)
+		go func() {
+			score, _ := cache.GetPlayerScore(context.Background(), "Alice")
+			scores <- score
+		}()
+		<-held
+		for range readers - 1 {
+			go func() {
+				score, _ := cache.GetPlayerScore(context.Background(), "Alice")
+				scores <- score
+			}()
+		}
+		for cache.Stats().Coalesced < readers-1 {
+			time.Sleep(time.Millisecond)
+		}
+		release()
+
+		for range readers {
+			if got := <-scores; got != 1 {
+				t.Errorf("got score %d want 1", got)
+			}
+		}
+		if reads := store.playerReads.Load(); reads != 1 {
+			t.Errorf("expected one read of the store for %d readers, got %d", readers, reads)
+		}
+	})
+
+	t.Run("writes through the optional interfaces drop the cache", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		ctx := context.Background()
+		store.CreateUser(User{Name: "Alice"})
+		store.CreateUser(User{Name: "Bob"})
+		store.RecordWin("Bob")
+
+		cachedScore(t, cache, "Alice")
+		_, version, _ := cache.GetPlayerScoreVersion(ctx, "Alice")
+		if _, err := cache.RecordWinIfVersion(ctx, "Alice", version); err != nil {
+			t.Fatalf("unexpected error recording win: %v", err)
+		}
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got Alice's score %d after RecordWinIfVersion want 1", got)
+		}
+
+		cachedScore(t, cache, "Bob")
+		cachedLeague(t, cache)
+		if err := cache.ResetScores(ctx, 1, func([]Player) error { return nil }); err != nil {
+			t.Fatalf("unexpected error resetting scores: %v", err)
+		}
+		if got := cachedScore(t, cache, "Bob"); got != 0 {
+			t.Errorf("got Bob's score %d after ResetScores want 0", got)
+		}
+		if league := cachedLeague(t, cache); league[0].Wins != 0 || league[1].Wins != 0 {
+			t.Errorf("got league %v after ResetScores want no wins", league)
+		}
+
+		cachedScore(t, cache, "Alice")
+		if err := cache.RecordWinIfRegistered(ctx, "Alice"); err != nil {
+			t.Fatalf("unexpected error recording win: %v", err)
+		}
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got Alice's score %d after RecordWinIfRegistered want 1", got)
+		}
+
+		cache.RecordWin(context.Background(), "Bob")
+		cachedScore(t, cache, "Bob")
+		if err := cache.DeleteUser("Bob"); err != nil {
+			t.Fatalf("unexpected error deleting user: %v", err)
+		}
+		if got := cachedScore(t, cache, "Bob"); got != 0 {
+			t.Errorf("got Bob's score %d after DeleteUser want 0", got)
+		}
+		if _, ok := cache.GetUser("Bob"); ok {
+			t.Error("expected Bob not to be cached after DeleteUser")
+		}
+	})
+
+	t.Run("score, version and user are served from one read", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		ctx := context.Background()
+		store.CreateUser(User{Name: "Alice", Metadata: map[string]string{"team": "red"}})
+		store.RecordWin("Alice")
+		want, _ := store.InMemoryPlayerStore.GetUser("Alice")
+
+		user, ok := cache.GetUser("Alice")
+		if !ok || user.Wins != 1 || user.Version != want.Version || user.Metadata["team"] != "red" {
+			t.Errorf("got user %+v, %v want %+v", user, ok, want)
+		}
+		score, version, err := cache.GetPlayerScoreVersion(ctx, "Alice")
+		if err != nil || score != 1 || version != want.Version {
+			t.Errorf("got score %d at version %d, %v want 1 at version %d", score, version, err, want.Version)
+		}
+		cachedScore(t, cache, "Alice")
+		if reads := store.playerReads.Load(); reads != 1 {
+			t.Errorf("expected 1 read of the store, got %d", reads)
+		}
+
+		// Callers own the user they're given
+		user.Metadata["team"] = "blue"
+		if again, _ := cache.GetUser("Alice"); again.Metadata["team"] != "red" {
+			t.Errorf("changing a returned user changed the cache, got %+v", again)
+		}
+		if _, ok := cache.GetUser("Nobody"); ok {
+			t.Error("expected an unknown user not to be found")
+		}
+	})
+
+	t.Run("a failed read isn't cached", func(t *testing.T) {
+		store := &FlakyPlayerStore{PlayerStoreV2: AdaptPlayerStore(NewInMemoryPlayerStore())}
+		cache := NewCachingPlayerStore(store, 10, time.Minute)
+		ctx := context.Background()
+		store.RecordWin(ctx, "Alice")
+
+		store.failing.Store(true)
+		if _, err := cache.GetPlayerScore(ctx, "Alice"); !errors.Is(err, ErrStoreUnavailable) {
+			t.Errorf("got error %v want %v", err, ErrStoreUnavailable)
+		}
+		store.failing.Store(false)
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got score %d once the store recovered want 1", got)
+		}
+		if stats := cache.Stats(); stats.Misses != 2 {
+			t.Errorf("expected the failed read to be retried, got %+v", stats)
+		}
+	})
+
+	t.Run("a reader waiting on another's read gives up with its context", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		held, release := store.holdNextRead()
+		defer release()
+
+		go cache.GetPlayerScore(context.Background(), "Alice")
+		<-held
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := cache.GetPlayerScore(ctx, "Alice"); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("interfaces the wrapped store lacks are unsupported", func(t *testing.T) {
+		cache := NewCachingPlayerStore(AdaptPlayerStore(NewSpyPlayerStore(t)), 10, time.Minute)
+		if _, err := cache.CreateUser(User{Name: "Alice"}); !errors.Is(err, errors.ErrUnsupported) {
+			t.Errorf("got error %v want %v", err, errors.ErrUnsupported)
+		}
+		server := NewPlayerServerV2(cache)
+		server.Start()
+		if _, ok := storeAs[UserStore](server); ok {
+			t.Error("expected the server not to use a UserStore the wrapped store doesn't implement")
+		}
+		if _, ok := storeAs[SeasonalPlayerStore](server); ok {
+			t.Error("expected the server not to use a SeasonalPlayerStore the wrapped store doesn't implement")
+		}
+	})
+
+	t.Run("a read from before a win is neither shared nor cached", func(t *testing.T) {
+		cache, store, _ := newTestCache(10)
+		held, release := store.holdNextRead()
+
+		early := make(chan int)
+		go func() {
+			score, _ := cache.GetPlayerScore(context.Background(), "Alice")
+			early <- score
+		}()
+		<-held // the early read has seen 0
+
+		cache.RecordWin(context.Background(), "Alice")
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got score %d after the win returned want 1", got)
+		}
+
+		release()
+		<-early
+		if got := cachedScore(t, cache, "Alice"); got != 1 {
+			t.Errorf("got score %d once the early read finished want 1", got)
+		}
+	})
+}
+
+func TestCachingPlayerStore_NoStaleReadsUnderConcurrency(t *testing.T) {
+	ctx := context.Background()
+	// A small cache so entries are evicted and reloaded throughout
+	cache := NewCachingPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), 4, time.Hour)
+
+	const writers, wins = 8, 200
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each player has a single writer, so once its win returns the
+			// score it reads must be exactly the wins it has recorded
+			name := fmt.Sprintf("player-%d", w)
+			for i := 1; i <= wins; i++ {
+				if err := cache.RecordWin(ctx, name); err != nil {
+					t.Errorf("unexpected error recording a win for %s: %v", name, err)
+					return
+				}
+				if got, _ := cache.GetPlayerScore(ctx, name); got != i {
+					t.Errorf("%s read %d after recording %d wins", name, got, i)
+					return
+				}
+			}
+		}()
+	}
+	// Readers racing the writers for the same players
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := range writers {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cache.GetPlayerScore(ctx, fmt.Sprintf("player-%d", r))
+				cache.GetLeague(ctx)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	for _, player := range cachedLeague(t, cache) {
+		if player.Wins != wins {
+			t.Errorf("got %d wins for %s in the league want %d", player.Wins, player.Name, wins)
+		}
+	}
+	if stats := cache.Stats(); stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("expected both hits and misses, got %+v", stats)
+	}
+}
+
+func TestPlayerServer_CacheHits(t *testing.T) {
+	store := NewCountingPlayerStore()
+	store.CreateUser(User{Name: "Alice"})
+	store.RecordWin("Alice")
+	store.delay = 100 * time.Millisecond
+	cache := NewCachingPlayerStore(AdaptPlayerStore(store), 100, time.Minute)
+	server := NewPlayerServerV2(cache)
+	server.Start()
+
+	for _, path := range []string{"/user/Alice/score", "/user/Alice"} {
+		t.Run(path, func(t *testing.T) {
+			before := store.playerReads.Load()
+			for i := range 2 {
+				request, _ := http.NewRequest(http.MethodGet, path, nil)
+				response := httptest.NewRecorder()
+				start := time.Now()
+				server.Handler.ServeHTTP(response, request)
+				elapsed := time.Since(start)
+
+				if response.Code != http.StatusOK {
+					t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+				}
+				if i == 1 && elapsed >= store.delay {
+					t.Errorf("expected the second GET to be served from the cache, it took %s", elapsed)
+				}
+			}
+			// The first GET of the score reads the player once for the
+			// registration check, the score and the ETag
+			if reads := store.playerReads.Load() - before; reads > 1 {
+				t.Errorf("expected at most 1 read of the store, got %d", reads)
+			}
+		})
+	}
+}
+
+func TestPlayerServer_ThroughCache(t *testing.T) {
+	server := NewPlayerServerV2(NewCachingPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), 100, time.Minute))
+	server.Start()
+
+	serve := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		for key, value := range header {
+			request.Header.Set(key, value)
+		}
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+	score := func() string {
+		response := serve(http.MethodGet, "/user/Alice/score", "", nil)
+		body, _ := io.ReadAll(response.Body)
+		return string(body)
+	}
+
+	if response := serve(http.MethodPost, "/user", `{"name":"Alice"}`, nil); response.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code creating Alice: got %v want %v", response.Code, http.StatusCreated)
+	}
+	response := serve(http.MethodGet, "/user/Alice/score", "", nil)
+	if body, _ := io.ReadAll(response.Body); string(body) != "0" {
+		t.Errorf("got score %q want 0", body)
+	}
+
+	// The ETag comes from the wrapped store and a conditional win drops the cached score
+	etag := response.Header().Get("ETag")
+	if response := serve(http.MethodPut, "/user/Alice/score", "", map[string]string{"If-Match": etag}); response.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+	}
+	if got := score(); got != "1" {
+		t.Errorf("got score %q after the conditional win want 1", got)
+	}
+	if response := serve(http.MethodPut, "/user/Alice/score", "", map[string]string{"If-Match": etag}); response.Code != http.StatusPreconditionFailed {
+		t.Errorf("handler returned wrong status code for a stale ETag: got %v want %v", response.Code, http.StatusPreconditionFailed)
+	}
+
+	if response := serve(http.MethodGet, "/user/Alice/rank", "", nil); response.Code != http.StatusOK {
+		t.Errorf("handler returned wrong status code for the rank: got %v want %v", response.Code, http.StatusOK)
+	}
+	if response := serve(http.MethodPost, "/seasons", "", nil); response.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code closing the season: got %v want %v", response.Code, http.StatusCreated)
+	}
+	if got := score(); got != "0" {
+		t.Errorf("got score %q after the season closed want 0", got)
+	}
+
+	if response := serve(http.MethodDelete, "/user/Alice", "", nil); response.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code deleting Alice: got %v want %v", response.Code, http.StatusNoContent)
+	}
+	if response := serve(http.MethodGet, "/user/Alice", "", nil); response.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code after deleting Alice: got %v want %v", response.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlayerEventType names a change to the players of an EventSourcedPlayerStore.
+type PlayerEventType string
+
+// The events an EventSourcedPlayerStore records.
+const (
+	// PlayerCreated registers a player with no wins
+	PlayerCreated PlayerEventType = "PlayerCreated"
+	// WinRecorded adds a win, creating the player if needed
+	WinRecorded PlayerEventType = "WinRecorded"
+	// ScoreCorrected sets a player's wins, creating the player if needed
+	ScoreCorrected PlayerEventType = "ScoreCorrected"
+	// PlayerDeleted removes a player and their wins
+	PlayerDeleted PlayerEventType = "PlayerDeleted"
+	// ScoresReset sets every player's wins to 0 when a season closes
+	ScoresReset PlayerEventType = "ScoresReset"
+)
+
+// PlayerEvent is an entry in the event log. Events are numbered from 1 in the
+// order they were recorded and never change once written.
+type PlayerEvent struct {
+	Seq    uint64          `json:"seq"`
+	Type   PlayerEventType `json:"type"`
+	Time   time.Time       `json:"time"`
+	Player string          `json:"player,omitempty"`
+	// Wins is the corrected score of a ScoreCorrected event
+	Wins int `json:"wins,omitempty"`
+	// Season is the season a ScoresReset event closed
+	Season int `json:"season,omitempty"`
+	// DisplayName and Metadata describe the player of a PlayerCreated event
+	DisplayName string            `json:"displayName,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// applyPlayerEvent folds an event into the users it changes.
+func applyPlayerEvent(users userTable, e PlayerEvent) userTable {
+	switch e.Type {
+	case PlayerCreated:
+		users.put(&User{
+			Name:        e.Player,
+			DisplayName: e.DisplayName,
+			CreatedAt:   e.Time,
+			UpdatedAt:   e.Time,
+			Metadata:    e.Metadata,
+			Version:     1,
+		})
+	case WinRecorded:
+		users.recordWin(e.Player, e.Time)
+	case ScoreCorrected:
+		u, ok := users.users[e.Player]
+		if !ok {
+			u = &User{Name: e.Player, DisplayName: e.Player, CreatedAt: e.Time}
+			users.put(u)
+		}
+		users.setWins(u, e.Wins)
+		u.UpdatedAt = e.Time
+		u.Version++
+	case PlayerDeleted:
+		users.delete(e.Player)
+	case ScoresReset:
+		users.resetScores(e.Season, e.Time)
+	}
+	return users
+}
+
+// segmentPrefix and segmentSuffix frame the sequence number of a segment's first event
+// in its file name, zero padded so segments sort in order.
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+	snapshotFile  = "snapshot.json"
+)
+
+// segment is a file of the event log holding events from first on, one JSON event per line.
+type segment struct {
+	path  string
+	first uint64
+}
+
+func segmentPath(dir string, first uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, first, segmentSuffix))
+}
+
+// listSegments returns the segments in dir in order.
+func listSegments(dir string) ([]segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing event log: %w", err)
+	}
+	var segments []segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment{path: filepath.Join(dir, name), first: first})
+	}
+	slices.SortFunc(segments, func(a, b segment) int {
+		return cmp.Compare(a.first, b.first)
+	})
+	return segments, nil
+}
+
+// readSegment returns the events in a segment up to the one numbered last and the
+// length of the segment up to the last of them. A last line without its newline was
+// torn by a crash, or is still being appended, and is dropped.
+func readSegment(path string, last uint64) ([]PlayerEvent, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("opening event log segment: %w", err)
+	}
+	defer file.Close()
+
+	var events []PlayerEvent
+	var valid int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return events, valid, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("reading %s: %w", filepath.Base(path), err)
+		}
+		var event PlayerEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return nil, 0, fmt.Errorf("decoding %s at byte %d: %w", filepath.Base(path), valid, err)
+		}
+		events = append(events, event)
+		valid += int64(len(line))
+		// Lines past last may be rewritten by appends while they are read
+		if event.Seq >= last {
+			return events, valid, nil
+		}
+	}
+}
+
+// playerSnapshot is the users folded from the events up to Seq.
+type playerSnapshot struct {
+	Seq   uint64           `json:"seq"`
+	Users map[string]*User `json:"users"`
+	// LastReset is the season the last reset closed, 0 before the first
+	LastReset int `json:"lastReset"`
+}
+
+// loadSnapshot reads the snapshot in dir, a missing snapshot gives no users at seq 0.
+func loadSnapshot(dir string) (userTable, uint64, error) {
+	users := newUserTable()
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return users, 0, nil
+	}
+	if err != nil {
+		return userTable{}, 0, fmt.Errorf("reading snapshot: %w", err)
+	}
+	var snapshot playerSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return userTable{}, 0, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	for name, u := range snapshot.Users {
+		u.Name = name
+		users.put(u)
+	}
+	users.lastReset = snapshot.LastReset
+	return users, snapshot.Seq, nil
+}
+
+// saveSnapshot writes the users folded up to seq as the snapshot in dir.
+func saveSnapshot(dir string, users userTable, seq uint64) error {
+	snapshot := playerSnapshot{Seq: seq, Users: users.users, LastReset: users.lastReset}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dir, snapshotFile), data)
+}
@@ -0,0 +1,426 @@
+package server
+
+import (
+	"context"
+	"core"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// Defaults of EventStoreConfig.
+const (
+	defaultSegmentEvents = 10000
+	defaultSnapshotEvery = 1000
+)
+
+// EventStoreConfig configures an EventSourcedPlayerStore, zero values use the defaults.
+type EventStoreConfig struct {
+	// SegmentEvents is how many events a segment file holds before the next is started
+	SegmentEvents int
+	// SnapshotEvery is how many events are recorded between snapshots
+	SnapshotEvery int
+}
+
+// EventSourcedPlayerStore is a PlayerStoreV2 whose players are folded from an
+// append-only log of PlayerEvents kept in segment files in a directory. Every
+// event is fsynced before the call that recorded it returns, a failed append is
+// returned and nothing is ever rewritten. A snapshot of the players is written every SnapshotEvery events
+// so opening the store only replays the events since.
+type EventSourcedPlayerStore struct {
+	mu  sync.RWMutex
+	dir string
+	cfg EventStoreConfig
+	// users is the projection of every event up to seq
+	users userTable
+	seq   uint64
+	// log is the segment events are appended to, holding segmentEvents of them
+	log           *appendLog
+	segmentEvents int
+	// sinceSnapshot counts events recorded since the last snapshot
+	sinceSnapshot int
+	// now is the store's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewEventSourcedPlayerStore opens the event log in dir, creating it if needed,
+// and folds it into the players from the latest snapshot on.
+func NewEventSourcedPlayerStore(dir string, cfg EventStoreConfig) (*EventSourcedPlayerStore, error) {
+	if cfg.SegmentEvents <= 0 {
+		cfg.SegmentEvents = defaultSegmentEvents
+	}
+	if cfg.SnapshotEvery <= 0 {
+		cfg.SnapshotEvery = defaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating event log: %w", err)
+	}
+
+	users, seq, err := loadSnapshot(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &EventSourcedPlayerStore{dir: dir, cfg: cfg, users: users, seq: seq, now: time.Now}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	var last []PlayerEvent
+	var valid int64
+	for i, seg := range segments {
+		// Skip segments the snapshot covers, except the last which is appended to
+		if i+1 < len(segments) && segments[i+1].first <= seq+1 {
+			continue
+		}
+		events, length, err := readSegment(seg.path, math.MaxUint64)
+		if err != nil {
+			return nil, err
+		}
+		s.users = core.Reduce(eventsAfter(events, s.seq), applyPlayerEvent, s.users)
+		if n := len(events); n > 0 {
+			s.seq = max(s.seq, events[n-1].Seq)
+		}
+		last, valid = events, length
+	}
+
+	if len(segments) == 0 {
+		err = s.startSegment()
+	} else {
+		err = s.resumeSegment(segments[len(segments)-1].path, valid, len(last))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// eventsAfter returns the events recorded after seq.
+func eventsAfter(events []PlayerEvent, seq uint64) []PlayerEvent {
+	for i, e := range events {
+		if e.Seq > seq {
+			return events[i:]
+		}
+	}
+	return nil
+}
+
+// startSegment starts a new segment for the events after s.seq. Callers must hold s.mu
+// or own s.
+func (s *EventSourcedPlayerStore) startSegment() error {
+	file, err := os.OpenFile(segmentPath(s.dir, s.seq+1), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("starting event log segment: %w", err)
+	}
+	if err := syncDir(s.dir); err != nil {
+		file.Close()
+		return err
+	}
+	l, err := openAppendLog(file, 0)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("starting event log segment: %w", err)
+	}
+	if s.log != nil {
+		s.log.Close()
+	}
+	s.log = l
+	s.segmentEvents = 0
+	return nil
+}
+
+// resumeSegment reopens the last segment to append to, dropping a line torn by a crash.
+func (s *EventSourcedPlayerStore) resumeSegment(path string, valid int64, events int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("opening event log segment: %w", err)
+	}
+	l, err := openAppendLog(file, valid)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("opening event log segment: %w", err)
+	}
+	s.log = l
+	s.segmentEvents = events
+	return nil
+}
+
+// record appends an event to the log and folds it into the players. An event
+// that fails to append is cut from the log and changes nothing, its Seq is
+// given to the next. Callers must hold s.mu for writing.
+func (s *EventSourcedPlayerStore) record(e PlayerEvent) error {
+	if s.segmentEvents >= s.cfg.SegmentEvents {
+		if err := s.startSegment(); err != nil {
+			return err
+		}
+	}
+
+	e.Seq = s.seq + 1
+	e.Time = s.now()
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding event: %w", err)
+	}
+	if err := s.log.append(append(line, '\n')); err != nil {
+		return fmt.Errorf("appending to event log: %w", err)
+	}
+
+	s.seq = e.Seq
+	s.segmentEvents++
+	s.users = applyPlayerEvent(s.users, e)
+
+	s.sinceSnapshot++
+	if s.sinceSnapshot >= s.cfg.SnapshotEvery {
+		// The events are safe in the log, a failed snapshot only makes opening slower
+		if err := s.snapshot(); err != nil {
+			log.Printf("event store: failed to write snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+// snapshot writes the current players as the snapshot. Callers must hold s.mu.
+func (s *EventSourcedPlayerStore) snapshot() error {
+	if err := saveSnapshot(s.dir, s.users, s.seq); err != nil {
+		return err
+	}
+	s.sinceSnapshot = 0
+	return nil
+}
+
+// GetPlayerScore returns the score for a player, unknown players have a score of 0.
+func (s *EventSourcedPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.score(name), nil
+}
+
+// RecordWin records a WinRecorded event.
+func (s *EventSourcedPlayerStore) RecordWin(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.record(PlayerEvent{Type: WinRecorded, Player: name})
+}
+
+// RecordWinIfRegistered records a WinRecorded event for a registered user.
+func (s *EventSourcedPlayerStore) RecordWinIfRegistered(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users.users[name]; !ok {
+		return ErrUserNotFound
+	}
+	return s.record(PlayerEvent{Type: WinRecorded, Player: name})
+}
+
+// GetLeague returns every player with their wins.
+func (s *EventSourcedPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.league(), nil
+}
+
+// GetUser returns the named user, the bool is false if the user is unknown.
+func (s *EventSourcedPlayerStore) GetUser(name string) (User, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.user(name)
+}
+
+// CreateUser records a PlayerCreated event for a user that isn't registered yet.
+func (s *EventSourcedPlayerStore) CreateUser(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users.users[user.Name]; ok {
+		return User{}, ErrUserExists
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = user.Name
+	}
+	err := s.record(PlayerEvent{
+		Type:        PlayerCreated,
+		Player:      user.Name,
+		DisplayName: user.DisplayName,
+		Metadata:    maps.Clone(user.Metadata),
+	})
+	if err != nil {
+		return User{}, err
+	}
+	created, _ := s.users.user(user.Name)
+	return created, nil
+}
+
+// DeleteUser records a PlayerDeleted event for a registered user.
+func (s *EventSourcedPlayerStore) DeleteUser(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users.users[name]; !ok {
+		return ErrUserNotFound
+	}
+	return s.record(PlayerEvent{Type: PlayerDeleted, Player: name})
+}
+
+// CorrectScore records a ScoreCorrected event setting the player's wins.
+func (s *EventSourcedPlayerStore) CorrectScore(ctx context.Context, name string, wins int) error {
+	if wins < 0 {
+		return fmt.Errorf("invalid score %d for %s", wins, name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.record(PlayerEvent{Type: ScoreCorrected, Player: name, Wins: wins})
+}
+
+// GetPlayerScoreVersion returns the score and version of a player, unknown players have version 0.
+func (s *EventSourcedPlayerStore) GetPlayerScoreVersion(ctx context.Context, name string) (int, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.score(name), s.users.version(name), nil
+}
+
+// RecordWinIfVersion records a WinRecorded event if the player's version is still version.
+func (s *EventSourcedPlayerStore) RecordWinIfVersion(ctx context.Context, name string, version uint64) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.users.version(name) != version {
+		return 0, ErrVersionConflict
+	}
+	if err := s.record(PlayerEvent{Type: WinRecorded, Player: name}); err != nil {
+		return 0, err
+	}
+	return s.users.version(name), nil
+}
+
+// DeleteUserIfVersion records a PlayerDeleted event if the user's version is still version.
+func (s *EventSourcedPlayerStore) DeleteUserIfVersion(ctx context.Context, name string, version uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users.users[name]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if u.Version != version {
+		return ErrVersionConflict
+	}
+	return s.record(PlayerEvent{Type: PlayerDeleted, Player: name})
+}
+
+// ResetScores archives every player's wins and records a ScoresReset event for the end of season.
+func (s *EventSourcedPlayerStore) ResetScores(ctx context.Context, season int, archive func(league []Player) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := archive(s.users.league()); err != nil {
+		return err
+	}
+	return s.record(PlayerEvent{Type: ScoresReset, Season: season})
+}
+
+// LastReset returns the season the last ScoresReset event closed.
+func (s *EventSourcedPlayerStore) LastReset(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.lastReset, nil
+}
+
+// GetRank returns the named player's rank.
+func (s *EventSourcedPlayerStore) GetRank(ctx context.Context, name string) (RankedPlayer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users.rank(name), nil
+}
+
+// GetLeaderboard returns a page of players ranked by wins.
+func (s *EventSourcedPlayerStore) GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	players, total := s.users.leaderboard(offset, limit)
+	return players, total, nil
+}
+
+// ScoreAt returns the player's score as it was at the given time, by replaying
+// the log from the start.
+func (s *EventSourcedPlayerStore) ScoreAt(ctx context.Context, name string, at time.Time) (int, error) {
+	users, err := ProjectEvents(ctx, s, newUserTable(), func(users userTable, e PlayerEvent) userTable {
+		if e.Time.After(at) {
+			return users
+		}
+		return applyPlayerEvent(users, e)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return users.score(name), nil
+}
+
+// Rebuild replays the whole log into new players, ignoring the snapshot, and
+// replaces the current ones and the snapshot with them.
+func (s *EventSourcedPlayerStore) Rebuild(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segments, err := listSegments(s.dir)
+	if err != nil {
+		return err
+	}
+	users, err := foldEvents(ctx, segments, s.seq, newUserTable(), applyPlayerEvent)
+	if err != nil {
+		return err
+	}
+	s.users = users
+	return s.snapshot()
+}
+
+// Snapshot writes a snapshot of the current players now.
+func (s *EventSourcedPlayerStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Close writes a snapshot and closes the log.
+func (s *EventSourcedPlayerStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.snapshot(); err != nil {
+		s.log.Close()
+		return err
+	}
+	return s.log.Close()
+}
+
+// ProjectEvents folds every event in the store's log, oldest first, into a
+// projection starting from initial. It is how read models the store doesn't
+// keep are built, or rebuilt after their fold changes.
+func ProjectEvents[T any](ctx context.Context, s *EventSourcedPlayerStore, initial T, apply func(T, PlayerEvent) T) (T, error) {
+	// Take the log as of one moment and fold it without holding off appends
+	s.mu.RLock()
+	segments, err := listSegments(s.dir)
+	seq := s.seq
+	s.mu.RUnlock()
+	if err != nil {
+		return initial, err
+	}
+	return foldEvents(ctx, segments, seq, initial, apply)
+}
+
+// foldEvents folds the events in segments up to the one numbered seq into initial,
+// a segment at a time. Segments are only appended to so events up to seq never change.
+func foldEvents[T any](ctx context.Context, segments []segment, seq uint64, initial T, apply func(T, PlayerEvent) T) (T, error) {
+	projection := initial
+	for _, seg := range segments {
+		if seg.first > seq {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return initial, err
+		}
+		events, _, err := readSegment(seg.path, seq)
+		if err != nil {
+			return initial, err
+		}
+		projection = core.Reduce(events, apply, projection)
+	}
+	return projection, nil
+}
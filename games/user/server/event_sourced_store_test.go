@@ -0,0 +1,382 @@
+package server
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventSourcedPlayerStore(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// open opens the store in dir with a clock that ticks a minute per event
+	open := func(t *testing.T, dir string, cfg EventStoreConfig) *EventSourcedPlayerStore {
+		t.Helper()
+		store, err := NewEventSourcedPlayerStore(dir, cfg)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		now := start
+		store.now = func() time.Time {
+			now = now.Add(time.Minute)
+			return now
+		}
+		return store
+	}
+
+	t.Run("events are appended to segments", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{SegmentEvents: 2})
+		store.CreateUser(User{Name: "Alice", DisplayName: "Alice A"})
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Bob")
+		store.CorrectScore(ctx, "Bob", 5)
+		store.DeleteUser("Alice")
+		store.Close()
+
+		segments, _ := listSegments(dir)
+		var firsts []uint64
+		for _, seg := range segments {
+			firsts = append(firsts, seg.first)
+		}
+		if !reflect.DeepEqual(firsts, []uint64{1, 3, 5}) {
+			t.Errorf("got segments starting at %v want [1 3 5]", firsts)
+		}
+
+		events, err := ProjectEvents(ctx, open(t, dir, EventStoreConfig{}), []PlayerEvent(nil), func(events []PlayerEvent, e PlayerEvent) []PlayerEvent {
+			return append(events, e)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error folding events: %v", err)
+		}
+		var got []PlayerEventType
+		for i, e := range events {
+			if e.Seq != uint64(i+1) {
+				t.Errorf("got event %d with seq %d", i, e.Seq)
+			}
+			got = append(got, e.Type)
+		}
+		want := []PlayerEventType{PlayerCreated, WinRecorded, WinRecorded, ScoreCorrected, PlayerDeleted}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got events %v want %v", got, want)
+		}
+		if events[0].DisplayName != "Alice A" || events[3].Wins != 5 {
+			t.Errorf("expected events to carry their details, got %+v", events)
+		}
+	})
+
+	t.Run("players are folded from the log", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{})
+		if _, err := store.CreateUser(User{Name: "Alice", Metadata: map[string]string{"team": "red"}}); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		if _, err := store.CreateUser(User{Name: "Alice"}); err != ErrUserExists {
+			t.Errorf("got error %v want %v", err, ErrUserExists)
+		}
+		if err := store.DeleteUser("Nobody"); err != ErrUserNotFound {
+			t.Errorf("got error %v want %v", err, ErrUserNotFound)
+		}
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Alice")
+		store.CorrectScore(ctx, "Bob", 4)
+
+		user, _ := store.GetUser("Alice")
+		if user.Wins != 2 || user.Metadata["team"] != "red" || user.Version != 3 {
+			t.Errorf("got user %+v", user)
+		}
+		if rank, _ := store.GetRank(ctx, "Alice"); rank.Rank != 2 {
+			t.Errorf("expected Alice ranked 2nd behind Bob, got %+v", rank)
+		}
+
+		var archived []Player
+		store.ResetScores(ctx, 1, func(league []Player) error {
+			archived = league
+			return nil
+		})
+		if bob, _ := store.GetPlayerScore(ctx, "Bob"); len(archived) != 2 || bob != 0 {
+			t.Errorf("expected the league archived and reset, got %v and Bob on %d", archived, bob)
+		}
+	})
+
+	t.Run("the season of the last reset is kept", func(t *testing.T) {
+		// From the snapshot, and from the log
+		for _, cfg := range []EventStoreConfig{{SnapshotEvery: 2}, {}} {
+			dir := t.TempDir()
+			store := open(t, dir, cfg)
+			if season, _ := store.LastReset(ctx); season != 0 {
+				t.Errorf("got last reset %d for a new store want 0", season)
+			}
+			store.RecordWin(ctx, "Alice")
+			store.ResetScores(ctx, 3, func([]Player) error { return nil })
+			store.RecordWin(ctx, "Alice")
+			store.log.Close()
+
+			reopened := open(t, dir, cfg)
+			if season, _ := reopened.LastReset(ctx); season != 3 {
+				t.Errorf("got last reset %d want 3", season)
+			}
+		}
+	})
+
+	t.Run("snapshots replace replaying the log they cover", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{SegmentEvents: 3, SnapshotEvery: 4})
+		for range 5 {
+			store.RecordWin(ctx, "Alice")
+		}
+		// The snapshot was written at event 4, so the first segment (events 1 to 3) isn't needed
+		store.log.Close()
+		segments, _ := listSegments(dir)
+		os.Remove(segments[0].path)
+
+		reopened := open(t, dir, EventStoreConfig{SegmentEvents: 3})
+		if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 5 {
+			t.Errorf("got score %d from the snapshot and later events want 5", got)
+		}
+	})
+
+	t.Run("the log is replayed without a snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{SegmentEvents: 3, SnapshotEvery: 2})
+		for range 7 {
+			store.RecordWin(ctx, "Alice")
+		}
+		store.Close()
+		os.Remove(filepath.Join(dir, snapshotFile))
+
+		reopened := open(t, dir, EventStoreConfig{SegmentEvents: 3})
+		if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 7 {
+			t.Errorf("got score %d replaying the log want 7", got)
+		}
+		reopened.RecordWin(ctx, "Alice")
+		if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 8 {
+			t.Errorf("got score %d after another win want 8", got)
+		}
+	})
+
+	t.Run("a torn last event is dropped", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{})
+		store.RecordWin(ctx, "Alice")
+		store.log.Close()
+
+		segments, _ := listSegments(dir)
+		file, _ := os.OpenFile(segments[0].path, os.O_APPEND|os.O_WRONLY, 0)
+		file.WriteString(`{"seq":2,"type":"WinRec`)
+		file.Close()
+
+		reopened := open(t, dir, EventStoreConfig{})
+		reopened.RecordWin(ctx, "Alice")
+		reopened.Close()
+		again := open(t, dir, EventStoreConfig{})
+		if got, _ := again.GetPlayerScore(ctx, "Alice"); got != 2 {
+			t.Errorf("got score %d want 2", got)
+		}
+	})
+
+	t.Run("a failed append is cut from the log", func(t *testing.T) {
+		for _, file := range []failingFile{{tornWrite: true}, {failSync: true}} {
+			dir := t.TempDir()
+			store := open(t, dir, EventStoreConfig{})
+			store.RecordWin(ctx, "Alice")
+
+			file.File = store.log.file.(*os.File)
+			store.log.file = &file
+			if err := store.CorrectScore(ctx, "Alice", 10); err == nil {
+				t.Fatal("expected the failed append to be an error")
+			}
+			if got, _ := store.GetPlayerScore(ctx, "Alice"); got != 1 {
+				t.Errorf("got score %d after the failed append want 1", got)
+			}
+			store.RecordWin(ctx, "Alice")
+			store.log.Close()
+
+			events, err := ProjectEvents(ctx, open(t, dir, EventStoreConfig{}), []uint64(nil), func(seqs []uint64, e PlayerEvent) []uint64 {
+				return append(seqs, e.Seq)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error reopening: %v", err)
+			}
+			if !reflect.DeepEqual(events, []uint64{1, 2}) {
+				t.Errorf("got events %v want [1 2]", events)
+			}
+		}
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{})
+		version, err := store.RecordWinIfVersion(ctx, "Alice", 0)
+		if err != nil || version != 1 {
+			t.Fatalf("got version %d, %v want 1", version, err)
+		}
+		if _, err := store.RecordWinIfVersion(ctx, "Alice", 0); err != ErrVersionConflict {
+			t.Errorf("got error %v want %v", err, ErrVersionConflict)
+		}
+		if score, version, _ := store.GetPlayerScoreVersion(ctx, "Alice"); score != 1 || version != 1 {
+			t.Errorf("got score %d version %d want 1 and 1", score, version)
+		}
+		if err := store.DeleteUserIfVersion(ctx, "Alice", 2); err != ErrVersionConflict {
+			t.Errorf("got error %v want %v", err, ErrVersionConflict)
+		}
+		if err := store.DeleteUserIfVersion(ctx, "Nobody", 0); err != ErrUserNotFound {
+			t.Errorf("got error %v want %v", err, ErrUserNotFound)
+		}
+		store.RecordWinIfVersion(ctx, "Bob", 0)
+		if err := store.DeleteUserIfVersion(ctx, "Alice", 1); err != nil {
+			t.Fatalf("unexpected error deleting: %v", err)
+		}
+		store.Close()
+
+		// The checked writes are events like any other
+		reopened := open(t, dir, EventStoreConfig{})
+		if _, ok := reopened.GetUser("Alice"); ok {
+			t.Error("expected Alice to stay deleted")
+		}
+		if _, version, _ := reopened.GetPlayerScoreVersion(ctx, "Bob"); version != 1 {
+			t.Errorf("got Bob's version %d want 1", version)
+		}
+	})
+
+	t.Run("a segment that can't be read is an error", func(t *testing.T) {
+		// A directory opens but fails to read, it mustn't pass for an empty segment
+		path := segmentPath(t.TempDir(), 1)
+		os.Mkdir(path, 0o755)
+		if _, _, err := readSegment(path, math.MaxUint64); err == nil {
+			t.Error("expected reading to fail")
+		}
+	})
+
+	t.Run("score as of a time", func(t *testing.T) {
+		store := open(t, t.TempDir(), EventStoreConfig{})
+		// Events are recorded a minute apart from start+1m
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Alice")
+		store.CorrectScore(ctx, "Alice", 10)
+		store.RecordWin(ctx, "Alice")
+
+		tests := []struct {
+			at   time.Time
+			want int
+		}{
+			{start, 0},
+			{start.Add(time.Minute), 1},
+			{start.Add(2*time.Minute + time.Second), 2},
+			{start.Add(3 * time.Minute), 10},
+			{start.Add(time.Hour), 11},
+		}
+		for _, tt := range tests {
+			got, err := store.ScoreAt(ctx, "Alice", tt.at)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got score %d at %s want %d", got, tt.at.Format(time.TimeOnly), tt.want)
+			}
+		}
+	})
+
+	t.Run("rebuild replaces a bad snapshot", func(t *testing.T) {
+		dir := t.TempDir()
+		store := open(t, dir, EventStoreConfig{})
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Bob")
+		store.Close()
+
+		// A snapshot from a buggy fold
+		bad := newUserTable()
+		bad.put(&User{Name: "Alice", Wins: 99})
+		saveSnapshot(dir, bad, 2)
+
+		reopened := open(t, dir, EventStoreConfig{})
+		if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 99 {
+			t.Fatalf("expected the bad snapshot to be loaded, got %d", got)
+		}
+		if err := reopened.Rebuild(ctx); err != nil {
+			t.Fatalf("unexpected error rebuilding: %v", err)
+		}
+		got, _ := reopened.GetLeague(ctx)
+		if alice, _ := reopened.GetPlayerScore(ctx, "Alice"); len(got) != 2 || alice != 1 {
+			t.Errorf("expected the league rebuilt from the log, got %v", got)
+		}
+		reopened.Close()
+
+		if got, _ := open(t, dir, EventStoreConfig{}).GetPlayerScore(ctx, "Alice"); got != 1 {
+			t.Errorf("expected the rebuilt snapshot to be saved, got score %d", got)
+		}
+	})
+
+	t.Run("custom projections", func(t *testing.T) {
+		store := open(t, t.TempDir(), EventStoreConfig{})
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Bob")
+		store.CorrectScore(ctx, "Bob", 0)
+
+		corrections, err := ProjectEvents(ctx, store, map[string]int{}, func(counts map[string]int, e PlayerEvent) map[string]int {
+			if e.Type == ScoreCorrected {
+				counts[e.Player]++
+			}
+			return counts
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(corrections, map[string]int{"Bob": 1}) {
+			t.Errorf("got corrections %v", corrections)
+		}
+	})
+
+	t.Run("projections don't hold off appends", func(t *testing.T) {
+		store := open(t, t.TempDir(), EventStoreConfig{SegmentEvents: 2})
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Alice")
+
+		// Wins recorded during the fold would deadlock it if it held the lock, and aren't folded
+		seqs, err := ProjectEvents(ctx, store, []uint64(nil), func(seqs []uint64, e PlayerEvent) []uint64 {
+			if err := store.RecordWin(ctx, "Bob"); err != nil {
+				t.Errorf("unexpected error recording a win during the fold: %v", err)
+			}
+			return append(seqs, e.Seq)
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(seqs, []uint64{1, 2, 3}) {
+			t.Errorf("got events %v want [1 2 3]", seqs)
+		}
+		if got, _ := store.GetPlayerScore(ctx, "Bob"); got != 3 {
+			t.Errorf("got Bob's score %d want 3", got)
+		}
+	})
+}
+
+func TestPlayerServer_EventStoreFailedAppend(t *testing.T) {
+	store, err := NewEventSourcedPlayerStore(t.TempDir(), EventStoreConfig{})
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	defer store.Close()
+	server := NewPlayerServerV2(store)
+	server.AutoCreate = true
+	server.Start()
+	store.log.file = &failingFile{File: store.log.file.(*os.File), failSync: true}
+
+	request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code for a win that wasn't logged: got %v want %v", response.Code, http.StatusInternalServerError)
+	}
+	if got, _ := store.GetPlayerScore(context.Background(), "Alice"); got != 0 {
+		t.Errorf("got score %d for a win that wasn't logged want 0", got)
+	}
+}
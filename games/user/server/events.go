@@ -0,0 +1,297 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults for the Broadcaster Start() creates.
+const (
+	defaultEventBuffer  = 64
+	defaultEventHistory = 1024
+)
+
+// sseKeepAlive is how often an idle event stream gets a comment so proxies keep it open.
+const sseKeepAlive = 15 * time.Second
+
+// ScoreEvent is published whenever a win changes a player's score.
+type ScoreEvent struct {
+	ID     uint64    `json:"id"`
+	Player string    `json:"player"`
+	Wins   int       `json:"wins"`
+	Time   time.Time `json:"time"`
+}
+
+// Broadcaster fans score events out to subscribers. Each subscriber has a
+// buffer, a subscriber that lets it fill up is evicted rather than holding up
+// the others. Recent events are kept so a subscriber that reconnects can
+// resume from the last event it saw.
+type Broadcaster struct {
+	bufferSize  int
+	historySize int
+
+	mu          sync.Mutex
+	nextID      uint64
+	history     []ScoreEvent // the most recent events, oldest first
+	subscribers map[*Subscription]struct{}
+	closed      bool
+	// now is the broadcaster's clock, replaced in tests
+	now func() time.Time
+}
+
+// Subscription receives the events of one player, or of every player.
+// Events is closed when the subscriber is evicted or the broadcaster closes.
+type Subscription struct {
+	Events <-chan ScoreEvent
+	events chan ScoreEvent
+	player string
+}
+
+// NewBroadcaster creates a Broadcaster buffering bufferSize events per subscriber
+// and keeping the last historySize events for resuming.
+func NewBroadcaster(bufferSize, historySize int) *Broadcaster {
+	return &Broadcaster{
+		bufferSize:  bufferSize,
+		historySize: historySize,
+		nextID:      1,
+		subscribers: make(map[*Subscription]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish sends an event for the player's new score to every interested subscriber.
+func (b *Broadcaster) Publish(player string, wins int) ScoreEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := ScoreEvent{ID: b.nextID, Player: player, Wins: wins, Time: b.now()}
+	b.nextID++
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Slow consumer, it can reconnect and resume from its last event
+			b.evict(sub)
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber for player's events, every player's if player is "".
+// Kept events after lastEventID are returned so a reconnecting subscriber misses
+// nothing still in the history, pass 0 for none. ok is false once the broadcaster is closed.
+func (b *Broadcaster) Subscribe(player string, lastEventID uint64) (sub *Subscription, missed []ScoreEvent, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, false
+	}
+
+	events := make(chan ScoreEvent, b.bufferSize)
+	sub = &Subscription{Events: events, events: events, player: player}
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastEventID && sub.wants(event) {
+				missed = append(missed, event)
+			}
+		}
+	}
+	return sub, missed, true
+}
+
+// Unsubscribe removes a subscriber, it is safe to call after it was evicted.
+func (b *Broadcaster) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		b.evict(sub)
+	}
+}
+
+// Close ends every subscription and refuses new ones, so event streams
+// finish when the server shuts down.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		b.evict(sub)
+	}
+}
+
+// evict removes a subscriber and closes its channel. Callers must hold b.mu.
+func (b *Broadcaster) evict(sub *Subscription) {
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+// subscriberCount returns the number of live subscribers.
+func (b *Broadcaster) subscriberCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// wants reports whether the subscription is interested in event.
+func (s *Subscription) wants(event ScoreEvent) bool {
+	return s.player == "" || s.player == event.Player
+}
+
+// playerLockStripes is how many locks the players' score changes are spread over.
+const playerLockStripes = 64
+
+// playerLock returns the lock serializing the named player's score changes.
+func (p *PlayerServer) playerLock(name string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return &p.playerLocks[h.Sum32()%playerLockStripes]
+}
+
+// lockAllPlayers takes every player's lock, in order so it can't deadlock with
+// another caller, and returns a func that releases them.
+func (p *PlayerServer) lockAllPlayers() (unlock func()) {
+	for i := range p.playerLocks {
+		p.playerLocks[i].Lock()
+	}
+	return func() {
+		for i := range p.playerLocks {
+			p.playerLocks[i].Unlock()
+		}
+	}
+}
+
+// recordAndPublishWin records a win for the named player with record and then tells
+// subscribers and webhooks about their new score. A player's wins are recorded
+// and published one at a time, so the score read back after the write is the
+// one it produced and subscribers see each score once and in order.
+func (p *PlayerServer) recordAndPublishWin(ctx context.Context, name string, record func() error) error {
+	mu := p.playerLock(name)
+	mu.Lock()
+	defer mu.Unlock()
+	if err := record(); err != nil {
+		return err
+	}
+	score, err := p.store.GetPlayerScore(ctx, name)
+	if err != nil {
+		// The win is recorded, subscribers get the score with the next event
+		return nil
+	}
+	p.publishScore(name, score)
+	return nil
+}
+
+// publishScore publishes the named player's new score to the event streams and webhooks.
+func (p *PlayerServer) publishScore(name string, score int) {
+	event := p.Events.Publish(name, score)
+	if p.Webhooks != nil {
+		p.Webhooks.Notify(event)
+	}
+}
+
+// streamPlayerEvents streams the named player's score changes as server-sent events.
+func (p *PlayerServer) streamPlayerEvents(w http.ResponseWriter, r *http.Request) {
+	playerName := r.PathValue("name")
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	p.streamEvents(w, r, playerName)
+}
+
+// streamLeagueEvents streams every player's score changes as server-sent events.
+func (p *PlayerServer) streamLeagueEvents(w http.ResponseWriter, r *http.Request) {
+	p.streamEvents(w, r, "")
+}
+
+// streamEvents subscribes to player's events and writes them as server-sent events
+// until the client goes away or the subscription ends. A Last-Event-ID header
+// resumes the stream after that event.
+func (p *PlayerServer) streamEvents(w http.ResponseWriter, r *http.Request, player string) {
+	var lastEventID uint64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastEventID = id
+	}
+
+	rc := http.NewResponseController(w)
+	sub, missed, ok := p.Events.Subscribe(player, lastEventID)
+	if !ok {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer p.Events.Unsubscribe(sub)
+
+	// Streams outlive the server's write timeout
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for _, event := range missed {
+		if writeEvent(w, event) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if writeEvent(w, event) != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a score event in the server-sent events format.
+func writeEvent(w http.ResponseWriter, event ScoreEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: score\ndata: %s\n\n", event.ID, data)
+	return err
+}
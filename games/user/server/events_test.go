@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventReader reads server-sent events from a stream.
+type eventReader struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+}
+
+// next returns the next event.
+func (e *eventReader) next() (id string, event ScoreEvent) {
+	e.t.Helper()
+	var data string
+	for e.scanner.Scan() {
+		line := e.scanner.Text()
+		switch {
+		case line == "" && data != "":
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				e.t.Fatalf("unable to parse event data %q: %v", data, err)
+			}
+			return id, event
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	e.t.Fatalf("stream ended waiting for an event: %v", e.scanner.Err())
+	return "", ScoreEvent{}
+}
+
+func TestPlayerServer_EventStreams(t *testing.T) {
+	newServer := func(t *testing.T) *httptest.Server {
+		t.Helper()
+		server, _ := setupTestServer(t)
+		ts := httptest.NewServer(server)
+		t.Cleanup(ts.Close)
+		// Close the streams first so the test server's Close doesn't wait on them
+		t.Cleanup(server.Events.Close)
+		return ts
+	}
+
+	subscribe := func(t *testing.T, ts *httptest.Server, path, lastEventID string) *eventReader {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if lastEventID != "" {
+			request.Header.Set("Last-Event-ID", lastEventID)
+		}
+		// The client timeout fails the test rather than hanging if an event never arrives
+		client := &http.Client{Timeout: 5 * time.Second}
+		response, err := client.Do(request)
+		if err != nil {
+			t.Fatalf("unable to subscribe to %s: %v", path, err)
+		}
+		t.Cleanup(func() { response.Body.Close() })
+
+		if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("got content type %q want %q", got, "text/event-stream")
+		}
+		return &eventReader{t: t, scanner: bufio.NewScanner(response.Body)}
+	}
+
+	recordWin := func(t *testing.T, ts *httptest.Server, player string) {
+		t.Helper()
+		request, _ := http.NewRequest(http.MethodPut, ts.URL+"/user/"+player+"/score", nil)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("unable to record win: %v", err)
+		}
+		response.Body.Close()
+	}
+
+	t.Run("player stream gets that player's score changes", func(t *testing.T) {
+		ts := newServer(t)
+		events := subscribe(t, ts, "/user/Alice/score/events", "")
+
+		recordWin(t, ts, "Bob")
+		recordWin(t, ts, "Alice")
+		recordWin(t, ts, "Alice")
+
+		for _, wantWins := range []int{1, 2} {
+			_, event := events.next()
+			if event.Player != "Alice" || event.Wins != wantWins {
+				t.Errorf("got event %+v want Alice with %d wins", event, wantWins)
+			}
+		}
+	})
+
+	t.Run("league stream gets every player's score changes", func(t *testing.T) {
+		ts := newServer(t)
+		events := subscribe(t, ts, "/league/events", "")
+
+		recordWin(t, ts, "Alice")
+		recordWin(t, ts, "Bob")
+
+		for _, want := range []string{"Alice", "Bob"} {
+			if _, event := events.next(); event.Player != want {
+				t.Errorf("got event for %s want %s", event.Player, want)
+			}
+		}
+	})
+
+	t.Run("Last-Event-ID resumes the stream", func(t *testing.T) {
+		ts := newServer(t)
+		recordWin(t, ts, "Alice")
+		recordWin(t, ts, "Alice")
+		recordWin(t, ts, "Alice")
+
+		events := subscribe(t, ts, "/user/Alice/score/events", "1")
+		for _, wantWins := range []int{2, 3} {
+			if _, event := events.next(); event.Wins != wantWins {
+				t.Errorf("got resumed event with %d wins want %d", event.Wins, wantWins)
+			}
+		}
+
+		recordWin(t, ts, "Alice")
+		id, event := events.next()
+		if id != "4" || event.Wins != 4 {
+			t.Errorf("got live event %s %+v want id 4 with 4 wins", id, event)
+		}
+	})
+}
+
+func TestBroadcaster(t *testing.T) {
+	t.Run("slow consumer is evicted without holding up others", func(t *testing.T) {
+		broadcaster := NewBroadcaster(2, 10)
+		slow, _, _ := broadcaster.Subscribe("", 0)
+		fast, _, _ := broadcaster.Subscribe("", 0)
+
+		for i := 1; i <= 3; i++ {
+			broadcaster.Publish("Alice", i)
+			<-fast.Events
+		}
+
+		// slow got the 2 events its buffer holds, then its channel was closed
+		for i := 0; i < 2; i++ {
+			if _, ok := <-slow.Events; !ok {
+				t.Fatalf("expected buffered event %d", i+1)
+			}
+		}
+		if _, ok := <-slow.Events; ok {
+			t.Error("expected the slow subscriber to be evicted")
+		}
+		if got := broadcaster.subscriberCount(); got != 1 {
+			t.Errorf("expected 1 subscriber left, got %d", got)
+		}
+
+		// Unsubscribing an evicted subscriber is safe
+		broadcaster.Unsubscribe(slow)
+	})
+
+	t.Run("history is bounded", func(t *testing.T) {
+		broadcaster := NewBroadcaster(10, 2)
+		for i := 1; i <= 5; i++ {
+			broadcaster.Publish("Alice", i)
+		}
+
+		_, missed, _ := broadcaster.Subscribe("Alice", 1)
+		if len(missed) != 2 || missed[0].ID != 4 || missed[1].ID != 5 {
+			t.Errorf("expected only the last 2 events to be resumed, got %+v", missed)
+		}
+	})
+
+	t.Run("close ends subscriptions and refuses new ones", func(t *testing.T) {
+		broadcaster := NewBroadcaster(10, 10)
+		sub, _, _ := broadcaster.Subscribe("", 0)
+		broadcaster.Close()
+
+		if _, ok := <-sub.Events; ok {
+			t.Error("expected subscription to end on close")
+		}
+		if _, _, ok := broadcaster.Subscribe("", 0); ok {
+			t.Error("expected subscribing to a closed broadcaster to fail")
+		}
+	})
+}
+
+// slowReadStore is an InMemoryPlayerStore whose scores take a while to read,
+// widening the gap between recording a win and reading the score back.
+type slowReadStore struct {
+	*InMemoryPlayerStore
+}
+
+func (s slowReadStore) GetPlayerScore(name string) int {
+	time.Sleep(time.Millisecond)
+	return s.InMemoryPlayerStore.GetPlayerScore(name)
+}
+
+func TestPlayerServer_PublishesEachScoreOnce(t *testing.T) {
+	server := NewPlayerServer(slowReadStore{NewInMemoryPlayerStore()})
+	server.AutoCreate = true
+	numWins := 50
+	server.Events = NewBroadcaster(numWins, 10)
+	server.Start()
+	sub, _, _ := server.Events.Subscribe("Alice", 0)
+
+	var wg sync.WaitGroup
+	wg.Add(numWins)
+	for range numWins {
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+			server.Handler.ServeHTTP(httptest.NewRecorder(), request)
+		}()
+	}
+	wg.Wait()
+
+	// Concurrent wins are published in the order they were recorded
+	for want := 1; want <= numWins; want++ {
+		if event := <-sub.Events; event.Wins != want {
+			t.Fatalf("got score %d want %d", event.Wins, want)
+		}
+	}
+}
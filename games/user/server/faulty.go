@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Fault configures the faults a FaultyPlayerStore injects into one method.
+// The rates are fractions of calls, checked in the order panic, error, partial
+// failure, and must add up to at most 1.
+type Fault struct {
+	// Latency delays every call, plus a random extra of up to Jitter
+	Latency time.Duration
+	Jitter  time.Duration
+	// PanicRate is the fraction of calls that panic without reaching the store
+	PanicRate float64
+	// ErrorRate is the fraction of calls that fail with Err without reaching the store
+	ErrorRate float64
+	// PartialRate is the fraction of calls that reach the store and then fail with Err,
+	// like a write that is applied but whose reply is lost
+	PartialRate float64
+	// Err is what failed calls return, ErrStoreUnavailable if nil
+	Err error
+}
+
+// FaultConfig configures a FaultyPlayerStore.
+type FaultConfig struct {
+	// Seed seeds the random faults, the same seed injects the same faults into
+	// the same sequence of calls
+	Seed           uint64
+	GetPlayerScore Fault
+	RecordWin      Fault
+	GetLeague      Fault
+}
+
+// FaultCounts counts the faults a FaultyPlayerStore has injected.
+type FaultCounts struct {
+	Calls    int
+	Panics   int
+	Errors   int
+	Partials int
+}
+
+// FaultyPlayerStore wraps a PlayerStoreV2 and injects latency, errors, panics and
+// partial failures into its calls, to test how the server copes with a slow or
+// failing store. Latency is cut short when the call's context is done.
+type FaultyPlayerStore struct {
+	store PlayerStoreV2
+	cfg   FaultConfig
+
+	mu     sync.Mutex
+	rng    *rand.Rand
+	counts FaultCounts
+}
+
+// faultOutcome is what happens to a single call.
+type faultOutcome int
+
+const (
+	faultNone faultOutcome = iota
+	faultPanic
+	faultError
+	faultPartial
+)
+
+// NewFaultyPlayerStore wraps store, injecting the faults in cfg.
+func NewFaultyPlayerStore(store PlayerStoreV2, cfg FaultConfig) *FaultyPlayerStore {
+	return &FaultyPlayerStore{
+		store: store,
+		cfg:   cfg,
+		rng:   rand.New(rand.NewPCG(cfg.Seed, cfg.Seed)),
+	}
+}
+
+// GetPlayerScore reads the player's score through the configured faults.
+func (f *FaultyPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	var score int
+	err := f.call(ctx, "GetPlayerScore", f.cfg.GetPlayerScore, func() error {
+		var err error
+		score, err = f.store.GetPlayerScore(ctx, name)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// RecordWin records a win through the configured faults.
+func (f *FaultyPlayerStore) RecordWin(ctx context.Context, name string) error {
+	return f.call(ctx, "RecordWin", f.cfg.RecordWin, func() error {
+		return f.store.RecordWin(ctx, name)
+	})
+}
+
+// GetLeague reads the league through the configured faults.
+func (f *FaultyPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	var league []Player
+	err := f.call(ctx, "GetLeague", f.cfg.GetLeague, func() error {
+		var err error
+		league, err = f.store.GetLeague(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return league, nil
+}
+
+// Counts returns the faults injected so far.
+func (f *FaultyPlayerStore) Counts() FaultCounts {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counts
+}
+
+// call runs the wrapped store's method through the fault.
+func (f *FaultyPlayerStore) call(ctx context.Context, method string, fault Fault, run func() error) error {
+	outcome, delay := f.decide(fault)
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	failure := fault.Err
+	if failure == nil {
+		failure = ErrStoreUnavailable
+	}
+	switch outcome {
+	case faultPanic:
+		panic(fmt.Sprintf("faulty store: injected panic in %s", method))
+	case faultError:
+		return fmt.Errorf("faulty store: injected error in %s: %w", method, failure)
+	case faultPartial:
+		if err := run(); err != nil {
+			return err
+		}
+		return fmt.Errorf("faulty store: injected failure after %s: %w", method, failure)
+	}
+	return run()
+}
+
+// decide draws the outcome and latency of a call from the seeded RNG.
+func (f *FaultyPlayerStore) decide(fault Fault) (faultOutcome, time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.counts.Calls++
+	delay := fault.Latency
+	if fault.Jitter > 0 {
+		delay += time.Duration(f.rng.Int64N(int64(fault.Jitter)))
+	}
+
+	roll := f.rng.Float64()
+	switch {
+	case roll < fault.PanicRate:
+		f.counts.Panics++
+		return faultPanic, delay
+	case roll < fault.PanicRate+fault.ErrorRate:
+		f.counts.Errors++
+		return faultError, delay
+	case roll < fault.PanicRate+fault.ErrorRate+fault.PartialRate:
+		f.counts.Partials++
+		return faultPartial, delay
+	}
+	return faultNone, delay
+}
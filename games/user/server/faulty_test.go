@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFaultyPlayerStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("the same seed injects the same faults", func(t *testing.T) {
+		outcomes := func(seed uint64) []string {
+			store := NewFaultyPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), FaultConfig{
+				Seed:      seed,
+				RecordWin: Fault{ErrorRate: 0.3, PartialRate: 0.3},
+			})
+			var got []string
+			for range 50 {
+				err := store.RecordWin(ctx, "Alice")
+				got = append(got, fmt.Sprint(err))
+			}
+			return got
+		}
+
+		first, again, other := outcomes(42), outcomes(42), outcomes(7)
+		if fmt.Sprint(first) != fmt.Sprint(again) {
+			t.Error("expected the same seed to inject the same faults")
+		}
+		if fmt.Sprint(first) == fmt.Sprint(other) {
+			t.Error("expected another seed to inject different faults")
+		}
+	})
+
+	t.Run("faults are injected at the configured rates", func(t *testing.T) {
+		store := NewFaultyPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), FaultConfig{
+			Seed:           1,
+			GetPlayerScore: Fault{ErrorRate: 0.2, PanicRate: 0.1},
+		})
+		const calls = 10000
+		for range calls {
+			func() {
+				defer func() { recover() }()
+				store.GetPlayerScore(ctx, "Alice")
+			}()
+		}
+
+		counts := store.Counts()
+		if counts.Calls != calls {
+			t.Errorf("got %d calls want %d", counts.Calls, calls)
+		}
+		for _, rate := range []struct {
+			name string
+			got  int
+			want float64
+		}{{"errors", counts.Errors, 0.2}, {"panics", counts.Panics, 0.1}} {
+			if got := float64(rate.got) / calls; got < rate.want-0.02 || got > rate.want+0.02 {
+				t.Errorf("got %s at rate %.3f want %.2f", rate.name, got, rate.want)
+			}
+		}
+	})
+
+	t.Run("a partial failure applies the write and reports an error", func(t *testing.T) {
+		inner := NewInMemoryPlayerStore()
+		failure := errors.New("reply lost")
+		store := NewFaultyPlayerStore(AdaptPlayerStore(inner), FaultConfig{
+			RecordWin: Fault{PartialRate: 1, Err: failure},
+		})
+
+		if err := store.RecordWin(ctx, "Alice"); !errors.Is(err, failure) {
+			t.Errorf("got error %v want %v", err, failure)
+		}
+		if got := inner.GetPlayerScore("Alice"); got != 1 {
+			t.Errorf("expected the win to be recorded, got score %d", got)
+		}
+	})
+
+	t.Run("an injected error doesn't reach the store", func(t *testing.T) {
+		inner := NewInMemoryPlayerStore()
+		store := NewFaultyPlayerStore(AdaptPlayerStore(inner), FaultConfig{RecordWin: Fault{ErrorRate: 1}})
+
+		if err := store.RecordWin(ctx, "Alice"); !errors.Is(err, ErrStoreUnavailable) {
+			t.Errorf("got error %v want %v", err, ErrStoreUnavailable)
+		}
+		if got := inner.GetPlayerScore("Alice"); got != 0 {
+			t.Errorf("expected no win to be recorded, got score %d", got)
+		}
+	})
+
+	t.Run("latency is cut short by the context", func(t *testing.T) {
+		store := NewFaultyPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), FaultConfig{
+			GetLeague: Fault{Latency: time.Minute},
+		})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		if _, err := store.GetLeague(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got error %v want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestPlayerServer_FaultyStore(t *testing.T) {
+	newServer := func(cfg FaultConfig) *PlayerServer {
+		server := NewPlayerServerV2(NewFaultyPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), cfg))
+		server.Start()
+		return server
+	}
+
+	t.Run("store errors are answered with their status", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			err            error
+			expectedStatus int
+		}{
+			{"unavailable store", nil, http.StatusServiceUnavailable},
+			{"unknown player", ErrUserNotFound, http.StatusNotFound},
+			{"other failure", errors.New("disk on fire"), http.StatusInternalServerError},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				fault := Fault{ErrorRate: 1, Err: tt.err}
+				server := newServer(FaultConfig{GetPlayerScore: fault, RecordWin: fault, GetLeague: fault})
+
+				for _, route := range []struct{ method, path string }{
+					{http.MethodGet, "/user/Alice/score"},
+					{http.MethodPut, "/user/Alice/score"},
+					{http.MethodGet, "/league"},
+				} {
+					request, _ := http.NewRequest(route.method, route.path, nil)
+					response := httptest.NewRecorder()
+					server.Handler.ServeHTTP(response, request)
+					if response.Code != tt.expectedStatus {
+						t.Errorf("%s %s returned %v want %v", route.method, route.path, response.Code, tt.expectedStatus)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("a slow store times out with the request", func(t *testing.T) {
+		server := newServer(FaultConfig{GetPlayerScore: Fault{Latency: time.Minute}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, "/user/Alice/score", nil)
+		response := httptest.NewRecorder()
+
+		start := time.Now()
+		server.Handler.ServeHTTP(response, request)
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("request took %s, expected it to end with its context", elapsed)
+		}
+		if response.Code != http.StatusServiceUnavailable {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusServiceUnavailable)
+		}
+	})
+
+	t.Run("the server survives every kind of fault", func(t *testing.T) {
+		fault := Fault{Jitter: time.Millisecond, PanicRate: 0.1, ErrorRate: 0.2, PartialRate: 0.1}
+		faulty := NewFaultyPlayerStore(AdaptPlayerStore(NewInMemoryPlayerStore()), FaultConfig{
+			Seed: 99, GetPlayerScore: fault, RecordWin: fault, GetLeague: fault,
+		})
+		server := NewPlayerServerV2(faulty)
+		server.Start()
+		httpServer := httptest.NewServer(server)
+		defer httpServer.Close()
+
+		allowed := map[int]bool{
+			http.StatusOK:                  true,
+			http.StatusAccepted:            true,
+			http.StatusInternalServerError: true,
+			http.StatusServiceUnavailable:  true,
+		}
+		routes := []struct{ method, path string }{
+			{http.MethodGet, "/user/Alice/score"},
+			{http.MethodPut, "/user/Alice/score"},
+			{http.MethodGet, "/user/Bob"},
+			{http.MethodGet, "/league"},
+			{http.MethodGet, "/leaderboard"},
+			{http.MethodGet, "/user/Bob/rank"},
+		}
+
+		var wg sync.WaitGroup
+		for c := range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rng := rand.New(rand.NewPCG(uint64(c), 0))
+				for range 50 {
+					route := routes[rng.IntN(len(routes))]
+					request, _ := http.NewRequest(route.method, httpServer.URL+route.path, nil)
+					response, err := httpServer.Client().Do(request)
+					if err != nil {
+						t.Errorf("%s %s failed: %v", route.method, route.path, err)
+						return
+					}
+					response.Body.Close()
+					if !allowed[response.StatusCode] {
+						t.Errorf("%s %s returned unexpected status %v", route.method, route.path, response.StatusCode)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if counts := faulty.Counts(); counts.Panics == 0 || counts.Errors == 0 || counts.Partials == 0 {
+			t.Errorf("expected every kind of fault to be injected, got %+v", counts)
+		}
+		response, err := httpServer.Client().Get(httpServer.URL + "/healthz")
+		if err != nil || response.StatusCode != http.StatusOK {
+			t.Fatalf("expected the server to still be healthy, got %v, %v", response, err)
+		}
+		response.Body.Close()
+	})
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileSystemPlayerStore is a PlayerStoreV2 that persists users to a JSON file.
+// Every write replaces the file atomically (temp file, fsync, rename) so a
+// crash leaves either the old or the new users on disk, never a partial file.
+// A write whose save fails is undone and returned, so callers are never told
+// a change was made that isn't on disk.
+type FileSystemPlayerStore struct {
+	mu    sync.RWMutex
+	path  string
+	users userTable
+	// now is the store's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewFileSystemPlayerStore opens the store at path, loading any users already
+// saved there. A missing file is treated as an empty store.
+func NewFileSystemPlayerStore(path string) (*FileSystemPlayerStore, error) {
+	users, err := loadUsers(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSystemPlayerStore{
+		path:  path,
+		users: users,
+		now:   time.Now,
+	}, nil
+}
+
+// GetPlayerScore returns the score for a player, unknown players have a score of 0.
+func (f *FileSystemPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.score(name), nil
+}
+
+// RecordWin increments the score for a player and saves the users to disk.
+// The win is undone if the save fails.
+func (f *FileSystemPlayerStore) RecordWin(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	before, existed := f.users.user(name)
+	f.users.recordWin(name, f.now())
+	if err := f.save(); err != nil {
+		f.undoWin(name, before, existed)
+		return err
+	}
+	return nil
+}
+
+// GetLeague returns every player with their wins.
+func (f *FileSystemPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.league(), nil
+}
+
+// GetUser returns the named user, the bool is false if the user is unknown.
+func (f *FileSystemPlayerStore) GetUser(name string) (User, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.user(name)
+}
+
+// CreateUser registers a new user with no wins and saves the users to disk.
+// The user isn't registered if the save fails.
+func (f *FileSystemPlayerStore) CreateUser(user User) (User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	created, err := f.users.create(user, f.now())
+	if err != nil {
+		return User{}, err
+	}
+	if err := f.save(); err != nil {
+		f.users.delete(created.Name)
+		return User{}, err
+	}
+	return created, nil
+}
+
+// DeleteUser removes a user and saves the users to disk.
+// The user is kept if the save fails.
+func (f *FileSystemPlayerStore) DeleteUser(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	removed, err := f.users.delete(name)
+	if err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.users.put(removed)
+		return err
+	}
+	return nil
+}
+
+// RecordWinIfRegistered increments the score for a registered player and saves
+// the users to disk. The win is undone if the save fails.
+func (f *FileSystemPlayerStore) RecordWinIfRegistered(ctx context.Context, name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	before, existed := f.users.user(name)
+	if err := f.users.recordWinIfRegistered(name, f.now()); err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.undoWin(name, before, existed)
+		return err
+	}
+	return nil
+}
+
+// GetPlayerScoreVersion returns the score and version of a player, unknown players have version 0.
+func (f *FileSystemPlayerStore) GetPlayerScoreVersion(ctx context.Context, name string) (int, uint64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.score(name), f.users.version(name), nil
+}
+
+// RecordWinIfVersion increments the score for a player if their version is still
+// version and saves the users to disk. The win is undone if the save fails.
+func (f *FileSystemPlayerStore) RecordWinIfVersion(ctx context.Context, name string, version uint64) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	before, existed := f.users.user(name)
+	newVersion, err := f.users.recordWinIfVersion(name, version, f.now())
+	if err != nil {
+		return 0, err
+	}
+	if err := f.save(); err != nil {
+		f.undoWin(name, before, existed)
+		return 0, err
+	}
+	return newVersion, nil
+}
+
+// undoWin puts a player back as they were before a win whose save failed.
+// Callers must hold f.mu.
+func (f *FileSystemPlayerStore) undoWin(name string, before User, existed bool) {
+	if existed {
+		f.users.put(&before)
+	} else {
+		f.users.delete(name)
+	}
+}
+
+// DeleteUserIfVersion removes a user if their version is still version and saves the users to disk.
+// The user is kept if the save fails.
+func (f *FileSystemPlayerStore) DeleteUserIfVersion(ctx context.Context, name string, version uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	removed, err := f.users.deleteIfVersion(name, version)
+	if err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.users.put(removed)
+		return err
+	}
+	return nil
+}
+
+// ResetScores archives every player's wins and resets them to 0 for the end of
+// season, saving the users and the season to disk. If the save fails the scores
+// stay reset in memory and are written by the next successful save.
+// If the process dies before that, LastReset tells the server the archived
+// season still needs its scores reset.
+func (f *FileSystemPlayerStore) ResetScores(ctx context.Context, season int, archive func(league []Player) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := archive(f.users.league()); err != nil {
+		return err
+	}
+	f.users.resetScores(season, f.now())
+	if err := f.save(); err != nil {
+		log.Printf("file store: failed to save users: %v", err)
+	}
+	return nil
+}
+
+// LastReset returns the season the last reset closed.
+func (f *FileSystemPlayerStore) LastReset(ctx context.Context) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.lastReset, nil
+}
+
+// Close flushes the users to disk, writing any change whose save failed earlier.
+func (f *FileSystemPlayerStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.save()
+}
+
+// storeFile is the store file, the season of the last reset and the users keyed by name.
+type storeFile struct {
+	Season int       `json:"season"`
+	Users  userTable `json:"users"`
+}
+
+// save writes the scores to the store file atomically.
+// Callers must hold f.mu.
+func (f *FileSystemPlayerStore) save() error {
+	data, err := json.Marshal(storeFile{Season: f.users.lastReset, Users: f.users})
+	if err != nil {
+		return fmt.Errorf("encoding users: %w", err)
+	}
+	return writeFileAtomic(f.path, data)
+}
+
+// writeFileAtomic writes data to a temp file in the same directory as path and
+// renames it over path, so readers see either the old or the new contents.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	// Remove is a no-op once the rename has succeeded
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", filepath.Base(path), err)
+	}
+	return syncDir(dir)
+}
+
+// loadUsers reads the users saved at path, a missing or empty file gives no users.
+// Files written before users were stored hold a bare score per player, those
+// are loaded as users with just a name and wins, and with no season reset yet.
+func loadUsers(path string) (userTable, error) {
+	users := newUserTable()
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return users, nil
+	}
+	if err != nil {
+		return userTable{}, fmt.Errorf("reading store file: %w", err)
+	}
+	if len(data) == 0 {
+		return users, nil
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return userTable{}, fmt.Errorf("decoding store file %s: %w", path, err)
+	}
+	var file struct {
+		Season int                        `json:"season"`
+		Users  map[string]json.RawMessage `json:"users"`
+	}
+	if len(raw) == 2 && raw["season"] != nil && raw["users"] != nil && json.Unmarshal(data, &file) == nil {
+		users.lastReset = file.Season
+		raw = file.Users
+	}
+	for name, value := range raw {
+		u := &User{Name: name, DisplayName: name}
+		if err := json.Unmarshal(value, &u.Wins); err != nil {
+			if err := json.Unmarshal(value, u); err != nil {
+				return userTable{}, fmt.Errorf("decoding user %q in store file %s: %w", name, path, err)
+			}
+		}
+		// Known users have a version, 0 is reserved for unknown ones
+		u.Version = max(u.Version, 1)
+		u.Name = name
+		users.put(u)
+	}
+	return users, nil
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("opening store directory: %w", err)
+	}
+	defer d.Close()
+	// Some platforms don't support syncing directories, the rename is still atomic there
+	_ = d.Sync()
+	return nil
+}
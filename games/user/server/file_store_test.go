@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSystemPlayerStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("missing file gives an empty store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+
+		store, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+
+		if got, _ := store.GetPlayerScore(ctx, "Alice"); got != 0 {
+			t.Errorf("expected score 0 for unknown player, got %d", got)
+		}
+	})
+
+	t.Run("scores survive reopening the store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+
+		store, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Bob")
+
+		reopened, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %v", err)
+		}
+
+		if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 2 {
+			t.Errorf("expected score 2 for Alice, got %d", got)
+		}
+		if got, _ := reopened.GetPlayerScore(ctx, "Bob"); got != 1 {
+			t.Errorf("expected score 1 for Bob, got %d", got)
+		}
+	})
+
+	t.Run("league survives reopening the store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+
+		store, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		store.RecordWin(ctx, "Alice")
+		store.RecordWin(ctx, "Bob")
+		store.RecordWin(ctx, "Bob")
+
+		reopened, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %v", err)
+		}
+
+		league, _ := reopened.GetLeague(ctx)
+		SortLeague(league)
+
+		want := []Player{{Name: "Bob", Wins: 2}, {Name: "Alice", Wins: 1}}
+		if !reflect.DeepEqual(league, want) {
+			t.Errorf("got league %v want %v", league, want)
+		}
+	})
+
+	t.Run("loads files holding bare scores", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+		if err := os.WriteFile(path, []byte(`{"Alice":3}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		store, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+
+		user, ok := store.GetUser("Alice")
+		if !ok {
+			t.Fatal("expected Alice to be loaded")
+		}
+		want := User{Name: "Alice", DisplayName: "Alice", Wins: 3, Version: 1}
+		if !reflect.DeepEqual(user, want) {
+			t.Errorf("got user %+v want %+v", user, want)
+		}
+	})
+
+	t.Run("created and deleted users survive reopening the store", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+
+		store, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		if _, err := store.CreateUser(User{Name: "Alice", Metadata: map[string]string{"team": "red"}}); err != nil {
+			t.Fatalf("unexpected error creating Alice: %v", err)
+		}
+		if _, err := store.CreateUser(User{Name: "Bob"}); err != nil {
+			t.Fatalf("unexpected error creating Bob: %v", err)
+		}
+		if err := store.DeleteUser("Bob"); err != nil {
+			t.Fatalf("unexpected error deleting Bob: %v", err)
+		}
+
+		reopened, err := NewFileSystemPlayerStore(path)
+		if err != nil {
+			t.Fatalf("unexpected error reopening store: %v", err)
+		}
+		alice, ok := reopened.GetUser("Alice")
+		if !ok || alice.Metadata["team"] != "red" {
+			t.Errorf("expected Alice with metadata to be reloaded, got %+v", alice)
+		}
+		if _, ok := reopened.GetUser("Bob"); ok {
+			t.Error("expected Bob to stay deleted")
+		}
+	})
+
+	t.Run("no temp files are left behind", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		store.RecordWin(ctx, "Alice")
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Errorf("expected only the store file in %s, got %d entries", dir, len(entries))
+		}
+	})
+
+	t.Run("a win whose save fails is undone and returned", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+		if err != nil {
+			t.Fatalf("unexpected error opening store: %v", err)
+		}
+		store.RecordWin(ctx, "Alice")
+		// Saves fail once the store's directory is gone
+		store.path = filepath.Join(dir, "missing", "scores.json")
+
+		for _, name := range []string{"Alice", "Bob"} {
+			if err := store.RecordWin(ctx, name); err == nil {
+				t.Errorf("expected the failed save to be returned for %s", name)
+			}
+		}
+		if got, _ := store.GetPlayerScore(ctx, "Alice"); got != 1 {
+			t.Errorf("expected the win to be undone, got score %d", got)
+		}
+		if _, ok := store.GetUser("Bob"); ok {
+			t.Error("expected Bob not to be created")
+		}
+	})
+
+	t.Run("corrupt file is an error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "scores.json")
+		if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewFileSystemPlayerStore(path); err == nil {
+			t.Error("expected an error opening a corrupt store file")
+		}
+	})
+}
+
+func TestPlayerServer_FileStoreFailedSave(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	server := NewPlayerServerV2(store)
+	server.AutoCreate = true
+	server.Start()
+	store.path = filepath.Join(dir, "missing", "scores.json")
+
+	request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code for a win that wasn't saved: got %v want %v", response.Code, http.StatusInternalServerError)
+	}
+	if got, _ := store.GetPlayerScore(context.Background(), "Alice"); got != 0 {
+		t.Errorf("got score %d for a win that wasn't saved want 0", got)
+	}
+}
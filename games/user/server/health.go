@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// readyTimeout bounds how long a readiness check waits for the store.
+const readyTimeout = 2 * time.Second
+
+// Pinger is implemented by stores that can check their backend is reachable.
+// Stores that don't implement it are always ready.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// healthz reports that the process is alive and serving.
+func (p *PlayerServer) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", mediaText)
+	fmt.Fprint(w, "ok")
+}
+
+// readyz reports whether the store is reachable, orchestrators stop routing
+// traffic to the server while it answers 503.
+func (p *PlayerServer) readyz(w http.ResponseWriter, r *http.Request) {
+	if pinger, ok := storeAs[Pinger](p); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			http.Error(w, fmt.Sprintf("store not ready: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", mediaText)
+	fmt.Fprint(w, "ready")
+}
+
+// Ping checks the directory holding the store file is still there.
+func (f *FileSystemPlayerStore) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Stat(filepath.Dir(f.path))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreUnavailable, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrStoreUnavailable, filepath.Dir(f.path))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// PingingPlayerStore is a SpyPlayerStore whose Ping returns err.
+type PingingPlayerStore struct {
+	*SpyPlayerStore
+	err error
+}
+
+func (p *PingingPlayerStore) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestPlayerServer_Health(t *testing.T) {
+	get := func(server *PlayerServer, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	tests := []struct {
+		name           string
+		pingErr        error
+		path           string
+		expectedStatus int
+	}{
+		{"alive", ErrStoreUnavailable, "/healthz", http.StatusOK},
+		{"ready when the store answers", nil, "/readyz", http.StatusOK},
+		{"not ready when the store is unreachable", ErrStoreUnavailable, "/readyz", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewPlayerServer(&PingingPlayerStore{SpyPlayerStore: NewSpyPlayerStore(t), err: tt.pingErr})
+			server.Start()
+
+			response := get(server, tt.path)
+			if response.Code != tt.expectedStatus {
+				t.Errorf("GET %s returned wrong status code: got %v want %v", tt.path, response.Code, tt.expectedStatus)
+			}
+		})
+	}
+
+	t.Run("store without Ping is always ready", func(t *testing.T) {
+		server, _ := setupTestServer(t)
+
+		response := get(server, "/readyz")
+		if response.Code != http.StatusOK {
+			t.Errorf("GET /readyz returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestFileSystemPlayerStore_Ping(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("unexpected error pinging store: %v", err)
+	}
+
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ping(context.Background()); err == nil {
+		t.Error("expected an error pinging a store whose directory is gone")
+	}
+}
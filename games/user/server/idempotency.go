@@ -0,0 +1,275 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyKeyHeader lets a client retry a request without repeating its effect.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from the IdempotencyCache.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength bounds keys accepted from clients.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the bodies of requests with an Idempotency-Key,
+	// they are read up front to compare them with the first request's.
+	maxIdempotentBodySize = 1 << 20
+)
+
+var (
+	// errIdempotencyKeyReused is returned when a key is sent again with a different body.
+	errIdempotencyKeyReused = errors.New("idempotency key was already used with a different request body")
+	// errIdempotencyCacheFull is returned when every key held is still being served.
+	errIdempotencyCacheFull = errors.New("too many requests with an idempotency key in flight")
+)
+
+// IdempotencyCache remembers the responses to requests sent with an Idempotency-Key
+// so a retry within the retention window gets the original response instead of
+// being served again. Requests with the same key that arrive while the first is
+// still being served wait for it. Only successful responses are kept, a retry of
+// a failed request is served again. A key sent again with a different body is
+// refused, and so are new keys while every key held is still being served.
+type IdempotencyCache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*idempotentEntry
+	order   *list.List // entries oldest first, for eviction
+	// now is the cache's clock, replaced in tests
+	now func() time.Time
+}
+
+// idempotentEntry is the state of one key, response is set once done is closed.
+type idempotentEntry struct {
+	key string
+	// body is the hash of the request body the key was first sent with
+	body     [sha256.Size]byte
+	done     chan struct{}
+	response *recordedResponse // nil if the request failed
+	expires  time.Time
+	elem     *list.Element
+}
+
+// recordedResponse is a response kept for replay.
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// NewIdempotencyCache creates an IdempotencyCache keeping responses for ttl,
+// holding at most maxEntries keys.
+func NewIdempotencyCache(ttl time.Duration, maxEntries int) *IdempotencyCache {
+	return &IdempotencyCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*idempotentEntry),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// serve runs h once per key, replaying its response to repeats of the key sent with the same body.
+func (c *IdempotencyCache) serve(w http.ResponseWriter, r *http.Request, key string, body [sha256.Size]byte, h http.HandlerFunc) {
+	for {
+		entry, first, err := c.claim(key, body)
+		if errors.Is(err, errIdempotencyKeyReused) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if first {
+			c.run(w, r, entry, h)
+			return
+		}
+
+		select {
+		case <-entry.done:
+		case <-r.Context().Done():
+			http.Error(w, "request cancelled waiting for a request with the same idempotency key", http.StatusServiceUnavailable)
+			return
+		}
+		if entry.response != nil {
+			entry.response.replay(w)
+			return
+		}
+		// The first request failed and gave up its claim, try to claim the key again
+	}
+}
+
+// claim returns the live entry for key, creating it if there isn't one.
+// first is true if the caller created the entry and must run the request.
+// Making room evicts the oldest completed entries, entries still being served
+// are never evicted or a retry could run the request twice.
+func (c *IdempotencyCache) claim(key string, body [sha256.Size]byte) (entry *idempotentEntry, first bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.evictExpired(now)
+
+	if entry, ok := c.entries[key]; ok {
+		if entry.body != body {
+			return nil, false, errIdempotencyKeyReused
+		}
+		return entry, false, nil
+	}
+
+	for e := c.order.Front(); e != nil && c.order.Len() >= c.maxEntries; {
+		next := e.Next()
+		if old := e.Value.(*idempotentEntry); !old.expires.IsZero() {
+			c.remove(old)
+		}
+		e = next
+	}
+	if c.order.Len() >= c.maxEntries {
+		return nil, false, errIdempotencyCacheFull
+	}
+
+	entry = &idempotentEntry{key: key, body: body, done: make(chan struct{})}
+	entry.elem = c.order.PushBack(entry)
+	c.entries[key] = entry
+	return entry, true, nil
+}
+
+// run serves the request for a claimed entry, recording the response if it succeeded.
+// The claim is released even if h panics so waiting requests don't hang.
+func (c *IdempotencyCache) run(w http.ResponseWriter, r *http.Request, entry *idempotentEntry, h http.HandlerFunc) {
+	rw := &recordingWriter{ResponseWriter: w}
+	succeeded := false
+	defer func() {
+		c.mu.Lock()
+		if succeeded {
+			entry.response = rw.response()
+			entry.expires = c.now().Add(c.ttl)
+		} else if c.entries[entry.key] == entry {
+			c.remove(entry)
+		}
+		c.mu.Unlock()
+		close(entry.done)
+	}()
+
+	h(rw, r)
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	succeeded = status >= 200 && status < 300
+}
+
+// evictExpired removes completed entries whose retention has passed.
+// Entries are ordered by when they were claimed, so eviction stops at the first
+// live entry. Callers must hold c.mu.
+func (c *IdempotencyCache) evictExpired(now time.Time) {
+	for e := c.order.Front(); e != nil; e = c.order.Front() {
+		entry := e.Value.(*idempotentEntry)
+		if entry.expires.IsZero() || now.Before(entry.expires) {
+			return
+		}
+		c.remove(entry)
+	}
+}
+
+// remove forgets an entry, requests already waiting on it still get its response.
+// Callers must hold c.mu.
+func (c *IdempotencyCache) remove(entry *idempotentEntry) {
+	delete(c.entries, entry.key)
+	c.order.Remove(entry.elem)
+}
+
+// size returns the number of keys held.
+func (c *IdempotencyCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// replay writes a recorded response.
+func (rr *recordedResponse) replay(w http.ResponseWriter) {
+	for key, values := range rr.header {
+		w.Header()[key] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(rr.status)
+	w.Write(rr.body)
+}
+
+// recordingWriter passes a response through to the client while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// response returns the recorded response.
+func (rw *recordingWriter) response() *recordedResponse {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := rw.Header().Clone()
+	// Each response has its own request ID, the replay gets the retry's
+	header.Del(RequestIDHeader)
+	return &recordedResponse{
+		status: status,
+		header: header,
+		body:   bytes.Clone(rw.body.Bytes()),
+	}
+}
+
+// idempotent serves h through p.Idempotency when the request has an Idempotency-Key.
+// Keys are scoped to the method and path so reusing one for another player isn't a replay.
+func (p *PlayerServer) idempotent(w http.ResponseWriter, r *http.Request, h http.HandlerFunc) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if p.Idempotency == nil || key == "" {
+		h(w, r)
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+		return
+	}
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodySize))
+		if err != nil {
+			http.Error(w, "request body is too large for an idempotency key", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	p.Idempotency.serve(w, r, r.Method+" "+r.URL.Path+" "+key, sha256.Sum256(body), h)
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// GatedPlayerStore is a PlayerStoreV2 whose RecordWin blocks until the gate is
+// closed, counting the calls it gets.
+type GatedPlayerStore struct {
+	gate  chan struct{}
+	calls atomic.Int32
+	err   error
+}
+
+func (g *GatedPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	return int(g.calls.Load()), nil
+}
+
+func (g *GatedPlayerStore) RecordWin(ctx context.Context, name string) error {
+	g.calls.Add(1)
+	<-g.gate
+	return g.err
+}
+
+func (g *GatedPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	return nil, nil
+}
+
+func TestPlayerServer_Idempotency(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	newServer := func(t *testing.T, maxEntries int) (*PlayerServer, *SpyPlayerStore) {
+		t.Helper()
+		server, store := setupTestServer(t)
+		server.Idempotency = NewIdempotencyCache(time.Minute, maxEntries)
+		server.Idempotency.now = func() time.Time { return now }
+		server.Start()
+		return server, store
+	}
+
+	put := func(server *PlayerServer, player, key string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPut, "/user/"+player+"/score", nil)
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("retry with the same key is replayed", func(t *testing.T) {
+		server, store := newServer(t, 10)
+
+		first := put(server, "Alice", "k1")
+		retry := put(server, "Alice", "k1")
+
+		if first.Code != http.StatusAccepted || retry.Code != http.StatusAccepted {
+			t.Errorf("got status codes %v and %v want %v", first.Code, retry.Code, http.StatusAccepted)
+		}
+		if retry.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Error("expected retry to be marked as replayed")
+		}
+		if len(store.recordWinCalls) != 1 {
+			t.Errorf("expected RecordWin to be called once, got %v", store.recordWinCalls)
+		}
+	})
+
+	t.Run("different keys and players are separate requests", func(t *testing.T) {
+		server, store := newServer(t, 10)
+
+		put(server, "Alice", "k1")
+		put(server, "Alice", "k2")
+		put(server, "Bob", "k1")
+		put(server, "Alice", "")
+
+		if len(store.recordWinCalls) != 4 {
+			t.Errorf("expected RecordWin to be called 4 times, got %v", store.recordWinCalls)
+		}
+	})
+
+	t.Run("keys expire after the retention window", func(t *testing.T) {
+		server, store := newServer(t, 10)
+
+		put(server, "Alice", "k1")
+		now = now.Add(time.Minute)
+		put(server, "Alice", "k1")
+
+		if len(store.recordWinCalls) != 2 {
+			t.Errorf("expected the expired key to record again, got %v", store.recordWinCalls)
+		}
+	})
+
+	t.Run("cache is bounded", func(t *testing.T) {
+		server, store := newServer(t, 2)
+
+		put(server, "Alice", "k1")
+		put(server, "Alice", "k2")
+		put(server, "Alice", "k3")
+		if server.Idempotency.size() != 2 {
+			t.Errorf("expected 2 keys to be held, got %d", server.Idempotency.size())
+		}
+
+		// k1 was evicted to make room for k3
+		put(server, "Alice", "k1")
+		if len(store.recordWinCalls) != 4 {
+			t.Errorf("expected the evicted key to record again, got %v", store.recordWinCalls)
+		}
+	})
+
+	t.Run("key reused with a different body is refused", func(t *testing.T) {
+		server, store := newServer(t, 10)
+		post := func(body string) *httptest.ResponseRecorder {
+			request, _ := http.NewRequest(http.MethodPost, "/matches", strings.NewReader(body))
+			request.Header.Set(IdempotencyKeyHeader, "m1")
+			response := httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, request)
+			return response
+		}
+
+		if response := post(`{"winner":"Alice","losers":["Bob"]}`); response.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusCreated)
+		}
+		if response := post(`{"winner":"Alice","losers":["Bob"]}`); response.Header().Get(IdempotentReplayedHeader) != "true" {
+			t.Errorf("expected the same body to be replayed, got %v", response.Code)
+		}
+		if response := post(`{"winner":"Bob","losers":["Alice"]}`); response.Code != http.StatusUnprocessableEntity {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusUnprocessableEntity)
+		}
+		if len(store.recordWinCalls) != 1 {
+			t.Errorf("expected one win to be recorded, got %v", store.recordWinCalls)
+		}
+	})
+
+	t.Run("long key is a bad request", func(t *testing.T) {
+		server, _ := newServer(t, 10)
+
+		response := put(server, "Alice", fmt.Sprintf("%0256d", 0))
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusBadRequest)
+		}
+	})
+}
+
+func TestPlayerServer_IdempotencyConcurrentDuplicates(t *testing.T) {
+	serve := func(server *PlayerServer, key string, responses chan<- *httptest.ResponseRecorder, wg *sync.WaitGroup) {
+		defer wg.Done()
+		request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+		request.Header.Set(IdempotencyKeyHeader, key)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		responses <- response
+	}
+
+	t.Run("duplicates in flight wait for the first", func(t *testing.T) {
+		store := &GatedPlayerStore{gate: make(chan struct{})}
+		server := NewPlayerServerV2(store)
+		server.AutoCreate = true
+		server.Idempotency = NewIdempotencyCache(time.Minute, 100)
+		server.Start()
+
+		numRequests := 20
+		responses := make(chan *httptest.ResponseRecorder, numRequests)
+		var wg sync.WaitGroup
+		wg.Add(numRequests)
+		for i := 0; i < numRequests; i++ {
+			go serve(server, "retry-me", responses, &wg)
+		}
+
+		// Let the duplicates pile up behind the first request before it finishes
+		time.Sleep(20 * time.Millisecond)
+		close(store.gate)
+		wg.Wait()
+		close(responses)
+
+		if calls := store.calls.Load(); calls != 1 {
+			t.Errorf("expected RecordWin to be called once, got %d", calls)
+		}
+		replayed := 0
+		for response := range responses {
+			if response.Code != http.StatusAccepted {
+				t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+			}
+			if response.Header().Get(IdempotentReplayedHeader) == "true" {
+				replayed++
+			}
+		}
+		if replayed != numRequests-1 {
+			t.Errorf("expected %d replayed responses, got %d", numRequests-1, replayed)
+		}
+	})
+
+	t.Run("failed request isn't replayed", func(t *testing.T) {
+		store := &GatedPlayerStore{gate: make(chan struct{}), err: ErrStoreUnavailable}
+		close(store.gate)
+		server := NewPlayerServerV2(store)
+		server.AutoCreate = true
+		server.Idempotency = NewIdempotencyCache(time.Minute, 100)
+		server.Start()
+
+		responses := make(chan *httptest.ResponseRecorder, 2)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		serve(server, "retry-me", responses, &wg)
+		serve(server, "retry-me", responses, &wg)
+		close(responses)
+
+		for response := range responses {
+			if response.Code != http.StatusServiceUnavailable {
+				t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusServiceUnavailable)
+			}
+		}
+		if calls := store.calls.Load(); calls != 2 {
+			t.Errorf("expected the retry of a failed request to call RecordWin again, got %d calls", calls)
+		}
+	})
+
+	t.Run("keys in flight aren't evicted", func(t *testing.T) {
+		store := &GatedPlayerStore{gate: make(chan struct{})}
+		server := NewPlayerServerV2(store)
+		server.AutoCreate = true
+		server.Idempotency = NewIdempotencyCache(time.Minute, 1)
+		server.Start()
+
+		responses := make(chan *httptest.ResponseRecorder, 3)
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go serve(server, "k1", responses, &wg)
+		for store.calls.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// k1 fills the cache while it is being served, a new key is refused
+		wg.Add(1)
+		serve(server, "k2", responses, &wg)
+		if response := <-responses; response.Code != http.StatusServiceUnavailable {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusServiceUnavailable)
+		}
+
+		wg.Add(1)
+		go serve(server, "k1", responses, &wg)
+		time.Sleep(20 * time.Millisecond)
+		close(store.gate)
+		wg.Wait()
+		close(responses)
+
+		for response := range responses {
+			if response.Code != http.StatusAccepted {
+				t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+			}
+		}
+		if calls := store.calls.Load(); calls != 1 {
+			t.Errorf("expected the retry of k1 to wait for the first, got %d calls", calls)
+		}
+	})
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"net/http"
+)
+
+// Page sizes of GET /leaderboard.
+const (
+	defaultLeaderboardLimit = 50
+	maxLeaderboardLimit     = 500
+)
+
+// RankedPlayer is a player with their place in the league. Players with the same wins
+// share a rank and the ranks after them are skipped, standard competition ranking.
+type RankedPlayer struct {
+	Rank int    `json:"rank"`
+	Name string `json:"name"`
+	Wins int    `json:"wins"`
+}
+
+// LeaderboardPage is a page of the leaderboard.
+type LeaderboardPage struct {
+	Players []RankedPlayer `json:"players"`
+	// Total is the number of players on every page
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// RankedPlayerStore is implemented by stores that keep players ordered by wins,
+// so ranks are found without sorting the league on every request.
+type RankedPlayerStore interface {
+	// GetRank returns the named player's rank, unknown players are ranked with no wins.
+	GetRank(ctx context.Context, name string) (RankedPlayer, error)
+	// GetLeaderboard returns up to limit players from the 0-based position offset,
+	// ranked by wins with ties ordered by name, and how many players there are.
+	GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error)
+}
+
+// GetRank returns the named player's rank.
+func (i *InMemoryPlayerStore) GetRank(ctx context.Context, name string) (RankedPlayer, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.rank(name), nil
+}
+
+// GetLeaderboard returns a page of players ranked by wins.
+func (i *InMemoryPlayerStore) GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	players, total := i.users.leaderboard(offset, limit)
+	return players, total, nil
+}
+
+// GetRank returns the named player's rank.
+func (f *FileSystemPlayerStore) GetRank(ctx context.Context, name string) (RankedPlayer, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.users.rank(name), nil
+}
+
+// GetLeaderboard returns a page of players ranked by wins.
+func (f *FileSystemPlayerStore) GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	players, total := f.users.leaderboard(offset, limit)
+	return players, total, nil
+}
+
+// rankedPlayerStore returns the store's ranks, sorting its league for stores that
+// don't keep one.
+func (p *PlayerServer) rankedPlayerStore() RankedPlayerStore {
+	if ranked, ok := storeAs[RankedPlayerStore](p); ok {
+		return ranked
+	}
+	return sortedLeague{p.store}
+}
+
+// sortedLeague ranks players by sorting a store's whole league.
+type sortedLeague struct {
+	store PlayerStoreV2
+}
+
+func (s sortedLeague) GetRank(ctx context.Context, name string) (RankedPlayer, error) {
+	score, err := s.store.GetPlayerScore(ctx, name)
+	if err != nil {
+		return RankedPlayer{}, err
+	}
+	league, err := s.store.GetLeague(ctx)
+	if err != nil {
+		return RankedPlayer{}, err
+	}
+	rank := 1
+	for _, player := range league {
+		if player.Wins > score {
+			rank++
+		}
+	}
+	return RankedPlayer{Rank: rank, Name: name, Wins: score}, nil
+}
+
+func (s sortedLeague) GetLeaderboard(ctx context.Context, offset, limit int) ([]RankedPlayer, int, error) {
+	league, err := s.store.GetLeague(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	SortLeague(league)
+
+	ranked := make([]RankedPlayer, len(league))
+	for i, player := range league {
+		ranked[i] = RankedPlayer{Rank: i + 1, Name: player.Name, Wins: player.Wins}
+		if i > 0 && player.Wins == league[i-1].Wins {
+			ranked[i].Rank = ranked[i-1].Rank
+		}
+	}
+	start := min(offset, len(ranked))
+	end := min(start+limit, len(ranked))
+	return ranked[start:end], len(ranked), nil
+}
+
+// getLeaderboard writes a page of players ranked by wins. The query parameters
+// offset and limit select the page.
+func (p *PlayerServer) getLeaderboard(w http.ResponseWriter, r *http.Request) {
+	offset, limit, err := parsePage(r, defaultLeaderboardLimit, maxLeaderboardLimit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	players, total, err := p.rankedPlayerStore().GetLeaderboard(r.Context(), offset, limit)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, LeaderboardPage{Players: players, Total: total, Offset: offset, Limit: limit})
+}
+
+// getRank writes the named player's rank.
+func (p *PlayerServer) getRank(w http.ResponseWriter, r *http.Request) {
+	playerName := r.PathValue("name")
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	ranked, err := p.rankedPlayerStore().GetRank(r.Context(), playerName)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, ranked)
+}
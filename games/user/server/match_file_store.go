@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSystemMatchStore is a MatchStore that appends matches to a JSON lines log.
+// Each match is fsynced before RecordMatch returns and the log is replayed on open.
+// A torn last line from a crash mid-write is dropped. Deleting a match appends
+// a line marking it deleted.
+type FileSystemMatchStore struct {
+	mu      sync.RWMutex
+	log     *appendLog
+	matches matchIndex
+	// now is the store's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewFileSystemMatchStore opens the match log at path, creating it if needed.
+func NewFileSystemMatchStore(path string) (*FileSystemMatchStore, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("opening match log: %w", err)
+	}
+
+	matches, valid, err := replayMatches(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// Drop a torn last line so new matches start on a line of their own
+	log, err := openAppendLog(file, valid)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("opening match log: %w", err)
+	}
+
+	return &FileSystemMatchStore{
+		log:     log,
+		matches: matches,
+		now:     time.Now,
+	}, nil
+}
+
+// matchLogEntry is a line of the match log, a match or the deletion of one.
+type matchLogEntry struct {
+	Match
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// replayMatches reads the match log, returning the index and the length of the
+// log up to the last complete line.
+func replayMatches(file *os.File) (matchIndex, int64, error) {
+	matches := newMatchIndex()
+	var valid int64
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline was torn by a crash
+			return matches, valid, nil
+		}
+		if err != nil {
+			return matchIndex{}, 0, fmt.Errorf("reading match log: %w", err)
+		}
+		var entry matchLogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return matchIndex{}, 0, fmt.Errorf("decoding match log at byte %d: %w", valid, err)
+		}
+		if entry.Deleted {
+			matches.remove(entry.ID)
+		} else {
+			matches.add(&entry.Match)
+		}
+		valid += int64(len(line))
+	}
+}
+
+// RecordMatch appends a match to the log and syncs it to disk.
+func (f *FileSystemMatchStore) RecordMatch(ctx context.Context, match Match) (Match, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, err := f.matches.prepare(match, f.now())
+	if err != nil {
+		return Match{}, err
+	}
+	if err := f.write(m); err != nil {
+		return Match{}, err
+	}
+	f.matches.add(m)
+	return copyMatch(m), nil
+}
+
+// DeleteMatch appends the deletion of the match with the ID to the log and syncs it to disk.
+func (f *FileSystemMatchStore) DeleteMatch(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.matches.byID[id]; !ok {
+		return fmt.Errorf("%s: %w", id, ErrMatchNotFound)
+	}
+	deletion := struct {
+		ID      string `json:"id"`
+		Deleted bool   `json:"deleted"`
+	}{id, true}
+	if err := f.write(deletion); err != nil {
+		return err
+	}
+	f.matches.remove(id)
+	return nil
+}
+
+// write appends a line of the log. Callers must hold f.mu.
+func (f *FileSystemMatchStore) write(entry any) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding match: %w", err)
+	}
+	if err := f.log.append(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing match log: %w", err)
+	}
+	return nil
+}
+
+// GetMatch returns the match with the ID.
+func (f *FileSystemMatchStore) GetMatch(ctx context.Context, id string) (Match, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.matches.get(id)
+}
+
+// GetMatches returns a page of the player's matches.
+func (f *FileSystemMatchStore) GetMatches(ctx context.Context, player string, query MatchQuery) (MatchPage, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.matches.page(player, query), nil
+}
+
+// AllMatches returns every match in the log in the order they were played, to
+// rebuild state derived from them such as ratings.
+func (f *FileSystemMatchStore) AllMatches() []Match {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.matches.all()
+}
+
+// Close closes the match log.
+func (f *FileSystemMatchStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.log.Close()
+}
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Page sizes of GET /user/{name}/matches.
+const (
+	defaultMatchLimit = 20
+	maxMatchLimit     = 100
+)
+
+// maxMatchBodySize bounds the bodies of POST /matches, which are read whole.
+const maxMatchBodySize = 1 << 20
+
+var (
+	// ErrInvalidMatch is returned for a match that can't be recorded.
+	ErrInvalidMatch = errors.New("invalid match")
+	// ErrMatchNotFound is returned for a match ID that isn't in the history.
+	ErrMatchNotFound = errors.New("match not found")
+)
+
+// Match is a game won by one player against one or more others.
+type Match struct {
+	ID       string            `json:"id"`
+	Winner   string            `json:"winner"`
+	Losers   []string          `json:"losers"`
+	Game     string            `json:"game,omitempty"`
+	PlayedAt time.Time         `json:"playedAt"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// players returns everyone who played the match, winner first.
+func (m Match) players() []string {
+	return append([]string{m.Winner}, m.Losers...)
+}
+
+// validate checks the match has a winner and distinct losers.
+func (m Match) validate() error {
+	if m.Winner == "" {
+		return fmt.Errorf("%w: winner is required", ErrInvalidMatch)
+	}
+	if len(m.Losers) == 0 {
+		return fmt.Errorf("%w: at least one loser is required", ErrInvalidMatch)
+	}
+	seen := map[string]bool{}
+	for _, player := range m.players() {
+		if player == "" {
+			return fmt.Errorf("%w: player names must be non-empty", ErrInvalidMatch)
+		}
+		if seen[player] {
+			return fmt.Errorf("%w: %s appears more than once", ErrInvalidMatch, player)
+		}
+		seen[player] = true
+	}
+	return nil
+}
+
+// MatchQuery selects a page of a player's matches.
+type MatchQuery struct {
+	// From and To bound when the match was played, From inclusive and To exclusive.
+	// Zero values leave that end open.
+	From, To time.Time
+	Offset   int
+	Limit    int
+}
+
+// MatchPage is a page of a player's matches, newest first.
+type MatchPage struct {
+	Matches []Match `json:"matches"`
+	// Total is the number of matches the query selects across every page
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+}
+
+// MatchStore keeps the history of matches.
+type MatchStore interface {
+	// RecordMatch stores a match, filling in its ID and PlayedAt if they are empty.
+	RecordMatch(ctx context.Context, match Match) (Match, error)
+	// GetMatch returns the match with the ID, ErrMatchNotFound if there is none.
+	GetMatch(ctx context.Context, id string) (Match, error)
+	// GetMatches returns a page of the matches the player won or lost.
+	GetMatches(ctx context.Context, player string, query MatchQuery) (MatchPage, error)
+	// DeleteMatch removes a match, to undo one whose win couldn't be recorded.
+	DeleteMatch(ctx context.Context, id string) error
+}
+
+// matchIndex holds matches by ID, and by player ordered by when they were played.
+// It does no locking, the owning store guards it.
+type matchIndex struct {
+	byID     map[string]*Match
+	byPlayer map[string][]*Match
+}
+
+func newMatchIndex() matchIndex {
+	return matchIndex{
+		byID:     make(map[string]*Match),
+		byPlayer: make(map[string][]*Match),
+	}
+}
+
+// add indexes a match under its ID and each of its players.
+func (idx matchIndex) add(match *Match) {
+	idx.byID[match.ID] = match
+	for _, player := range match.players() {
+		matches := idx.byPlayer[player]
+		// Matches mostly arrive in order, so this is usually an append
+		i, _ := slices.BinarySearchFunc(matches, match.PlayedAt, func(m *Match, t time.Time) int {
+			if m.PlayedAt.After(t) {
+				return 1
+			}
+			return -1
+		})
+		idx.byPlayer[player] = slices.Insert(matches, i, match)
+	}
+}
+
+// get returns the match with the ID.
+func (idx matchIndex) get(id string) (Match, error) {
+	match, ok := idx.byID[id]
+	if !ok {
+		return Match{}, fmt.Errorf("%s: %w", id, ErrMatchNotFound)
+	}
+	return copyMatch(match), nil
+}
+
+// remove drops the match with the ID, reporting whether there was one.
+func (idx matchIndex) remove(id string) bool {
+	match, ok := idx.byID[id]
+	if !ok {
+		return false
+	}
+	delete(idx.byID, id)
+	for _, player := range match.players() {
+		idx.byPlayer[player] = slices.DeleteFunc(idx.byPlayer[player], func(m *Match) bool {
+			return m == match
+		})
+		if len(idx.byPlayer[player]) == 0 {
+			delete(idx.byPlayer, player)
+		}
+	}
+	return true
+}
+
+// page returns the player's matches selected by query, newest first.
+func (idx matchIndex) page(player string, query MatchQuery) MatchPage {
+	matches := idx.byPlayer[player]
+
+	// matches is oldest first, find the range played in [From, To)
+	start := 0
+	if !query.From.IsZero() {
+		start, _ = slices.BinarySearchFunc(matches, query.From, func(m *Match, t time.Time) int {
+			return m.PlayedAt.Compare(t)
+		})
+	}
+	end := len(matches)
+	if !query.To.IsZero() {
+		end, _ = slices.BinarySearchFunc(matches, query.To, func(m *Match, t time.Time) int {
+			return m.PlayedAt.Compare(t)
+		})
+	}
+	end = max(start, end)
+
+	page := MatchPage{Matches: []Match{}, Total: end - start, Offset: query.Offset, Limit: query.Limit}
+	for i := end - 1 - query.Offset; i >= start && len(page.Matches) < query.Limit; i-- {
+		page.Matches = append(page.Matches, copyMatch(matches[i]))
+	}
+	return page
+}
+
+// all returns every match once, in the order they were played.
+func (idx matchIndex) all() []Match {
+	matches := slices.Collect(maps.Values(idx.byID))
+	slices.SortStableFunc(matches, func(a, b *Match) int {
+		return a.PlayedAt.Compare(b.PlayedAt)
+	})
+
+	all := make([]Match, len(matches))
+	for i, m := range matches {
+		all[i] = copyMatch(m)
+	}
+	return all
+}
+
+// copyMatch returns a copy of a match that is safe to hand to callers.
+func copyMatch(m *Match) Match {
+	c := *m
+	c.Losers = slices.Clone(m.Losers)
+	c.Metadata = maps.Clone(m.Metadata)
+	return c
+}
+
+// prepare validates a match to add to the index and fills in its ID and PlayedAt.
+func (idx matchIndex) prepare(match Match, now time.Time) (*Match, error) {
+	if err := match.validate(); err != nil {
+		return nil, err
+	}
+	if _, ok := idx.byID[match.ID]; ok {
+		return nil, fmt.Errorf("%w: match %s is already recorded", ErrInvalidMatch, match.ID)
+	}
+	m := copyMatch(&match)
+	if m.ID == "" {
+		m.ID = randomHex(8)
+	}
+	if m.PlayedAt.IsZero() {
+		m.PlayedAt = now
+	}
+	return &m, nil
+}
+
+// InMemoryMatchStore is a MatchStore that keeps matches in memory.
+type InMemoryMatchStore struct {
+	mu      sync.RWMutex
+	matches matchIndex
+	// now is the store's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewInMemoryMatchStore initializes an empty InMemoryMatchStore.
+func NewInMemoryMatchStore() *InMemoryMatchStore {
+	return &InMemoryMatchStore{
+		matches: newMatchIndex(),
+		now:     time.Now,
+	}
+}
+
+// RecordMatch stores a match.
+func (i *InMemoryMatchStore) RecordMatch(ctx context.Context, match Match) (Match, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	m, err := i.matches.prepare(match, i.now())
+	if err != nil {
+		return Match{}, err
+	}
+	i.matches.add(m)
+	return copyMatch(m), nil
+}
+
+// GetMatch returns the match with the ID.
+func (i *InMemoryMatchStore) GetMatch(ctx context.Context, id string) (Match, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.matches.get(id)
+}
+
+// GetMatches returns a page of the player's matches.
+func (i *InMemoryMatchStore) GetMatches(ctx context.Context, player string, query MatchQuery) (MatchPage, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.matches.page(player, query), nil
+}
+
+// DeleteMatch removes the match with the ID.
+func (i *InMemoryMatchStore) DeleteMatch(ctx context.Context, id string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.matches.remove(id) {
+		return fmt.Errorf("%s: %w", id, ErrMatchNotFound)
+	}
+	return nil
+}
+
+// --- Routes ---
+
+// recordMatch records the match in the JSON request body, a win for its winner and
+// the players' new ratings. The match is removed again if its win can't be
+// recorded, so the history only holds matches that counted and a retry doesn't
+// record the match twice.
+// A match may only be dated in the current rating period.
+// The caller must be allowed to record wins for the winner.
+func (p *PlayerServer) recordMatch(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMatchBodySize))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, fmt.Sprintf("match is larger than %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("reading match: %v", err), http.StatusBadRequest)
+		return
+	}
+	// Retries with an Idempotency-Key are compared with this body
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var request Match
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid match: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := request.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A match dated in another rating period would be rated in a different one
+	// when the ratings are rebuilt from the history
+	if start, end := p.Ratings.CurrentPeriod(); !request.PlayedAt.IsZero() && (request.PlayedAt.Before(start) || !request.PlayedAt.Before(end)) {
+		http.Error(w, fmt.Sprintf("%v: playedAt must be in the current rating period, from %s to %s",
+			ErrInvalidMatch, start.Format(time.RFC3339), end.Format(time.RFC3339)), http.StatusBadRequest)
+		return
+	}
+	r, ok := p.admit(w, r, request.Winner)
+	if !ok {
+		return
+	}
+	for _, player := range request.players() {
+		if !p.registered(player) {
+			http.Error(w, fmt.Sprintf("%s: %v", player, ErrUserNotFound), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	p.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		match, err := p.Matches.RecordMatch(r.Context(), request)
+		if errors.Is(err, ErrInvalidMatch) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		err = p.recordAndPublishWin(r.Context(), match.Winner, func() error {
+			return p.storeWin(r.Context(), match.Winner)
+		})
+		if err != nil {
+			if derr := p.Matches.DeleteMatch(context.WithoutCancel(r.Context()), match.ID); derr != nil {
+				log.Printf("matches: undoing match %s whose win failed: %v", match.ID, derr)
+			}
+			if errors.Is(err, ErrUserNotFound) {
+				// The winner was deleted since they were checked
+				http.Error(w, fmt.Sprintf("%s: %v", match.Winner, err), http.StatusUnprocessableEntity)
+				return
+			}
+			writeStoreError(w, err)
+			return
+		}
+		p.Ratings.RecordAt(match.Winner, match.Losers, match.PlayedAt)
+
+		w.Header().Set("Location", "/matches/"+match.ID)
+		w.Header().Set("Content-Type", mediaJSON)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(match)
+	})
+}
+
+// getMatch writes the match with the ID in the path.
+func (p *PlayerServer) getMatch(w http.ResponseWriter, r *http.Request) {
+	match, err := p.Matches.GetMatch(r.Context(), r.PathValue("id"))
+	if errors.Is(err, ErrMatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, match)
+}
+
+// getMatches writes a page of the named player's matches, newest first.
+// The query parameters from and to (RFC 3339) bound when they were played,
+// offset and limit select the page.
+func (p *PlayerServer) getMatches(w http.ResponseWriter, r *http.Request) {
+	playerName := r.PathValue("name")
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	query, err := parseMatchQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := p.Matches.GetMatches(r.Context(), playerName, query)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, page)
+}
+
+// parseMatchQuery reads a MatchQuery from the request's query parameters.
+func parseMatchQuery(r *http.Request) (MatchQuery, error) {
+	values := r.URL.Query()
+	var query MatchQuery
+
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if v := values.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return MatchQuery{}, fmt.Errorf("invalid %s: want an RFC 3339 time", bound.name)
+			}
+			*bound.dest = t
+		}
+	}
+
+	var err error
+	query.Offset, query.Limit, err = parsePage(r, defaultMatchLimit, maxMatchLimit)
+	if err != nil {
+		return MatchQuery{}, err
+	}
+	return query, nil
+}
+
+// parsePage reads the offset and limit query parameters of a paginated route.
+func parsePage(r *http.Request, defaultLimit, maxLimit int) (offset, limit int, err error) {
+	values := r.URL.Query()
+	offset, limit = 0, defaultLimit
+	if v := values.Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("invalid offset %q", v)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 || limit > maxLimit {
+			return 0, 0, fmt.Errorf("invalid limit %q, want 0 to %d", v, maxLimit)
+		}
+	}
+	return offset, limit, nil
+}
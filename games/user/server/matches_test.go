@@ -0,0 +1,478 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchStores(t *testing.T) {
+	start := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	stores := map[string]func(t *testing.T) MatchStore{
+		"memory": func(t *testing.T) MatchStore { return NewInMemoryMatchStore() },
+		"file": func(t *testing.T) MatchStore {
+			store, err := NewFileSystemMatchStore(filepath.Join(t.TempDir(), "matches.jsonl"))
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %v", err)
+			}
+			t.Cleanup(func() { store.Close() })
+			return store
+		},
+	}
+
+	ids := func(page MatchPage) []string {
+		var got []string
+		for _, m := range page.Matches {
+			got = append(got, m.ID)
+		}
+		return got
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+
+			// Recorded out of order, m3 is played last
+			for _, m := range []Match{
+				{ID: "m1", Winner: "Alice", Losers: []string{"Bob"}, PlayedAt: start},
+				{ID: "m3", Winner: "Bob", Losers: []string{"Alice", "Carol"}, PlayedAt: start.Add(2 * time.Hour)},
+				{ID: "m2", Winner: "Carol", Losers: []string{"Alice"}, PlayedAt: start.Add(time.Hour), Game: "chess"},
+			} {
+				if _, err := store.RecordMatch(ctx, m); err != nil {
+					t.Fatalf("unexpected error recording %s: %v", m.ID, err)
+				}
+			}
+
+			tests := []struct {
+				name      string
+				player    string
+				query     MatchQuery
+				wantIDs   []string
+				wantTotal int
+			}{
+				{"newest first", "Alice", MatchQuery{Limit: 10}, []string{"m3", "m2", "m1"}, 3},
+				{"only the player's matches", "Bob", MatchQuery{Limit: 10}, []string{"m3", "m1"}, 2},
+				{"limit", "Alice", MatchQuery{Limit: 2}, []string{"m3", "m2"}, 3},
+				{"offset", "Alice", MatchQuery{Offset: 2, Limit: 2}, []string{"m1"}, 3},
+				{"offset past the end", "Alice", MatchQuery{Offset: 5, Limit: 2}, nil, 3},
+				{"from is inclusive", "Alice", MatchQuery{From: start.Add(time.Hour), Limit: 10}, []string{"m3", "m2"}, 2},
+				{"to is exclusive", "Alice", MatchQuery{To: start.Add(time.Hour), Limit: 10}, []string{"m1"}, 1},
+				{"empty range", "Alice", MatchQuery{From: start.Add(time.Hour), To: start, Limit: 10}, nil, 0},
+				{"unknown player", "Dave", MatchQuery{Limit: 10}, nil, 0},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					page, err := store.GetMatches(ctx, tt.player, tt.query)
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if got := ids(page); !slices.Equal(got, tt.wantIDs) {
+						t.Errorf("got matches %v want %v", got, tt.wantIDs)
+					}
+					if page.Total != tt.wantTotal {
+						t.Errorf("got total %d want %d", page.Total, tt.wantTotal)
+					}
+				})
+			}
+
+			t.Run("fills in ID and time", func(t *testing.T) {
+				match, err := store.RecordMatch(ctx, Match{Winner: "Dave", Losers: []string{"Erin"}})
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if match.ID == "" || match.PlayedAt.IsZero() {
+					t.Errorf("expected an ID and time to be filled in, got %+v", match)
+				}
+			})
+
+			t.Run("get and delete", func(t *testing.T) {
+				match, err := store.GetMatch(ctx, "m2")
+				if err != nil || match.Winner != "Carol" || match.Game != "chess" {
+					t.Errorf("got %+v, %v want m2", match, err)
+				}
+				if _, err := store.GetMatch(ctx, "missing"); !errors.Is(err, ErrMatchNotFound) {
+					t.Errorf("got error %v want %v", err, ErrMatchNotFound)
+				}
+
+				recorded, _ := store.RecordMatch(ctx, Match{Winner: "Frank", Losers: []string{"Alice"}})
+				if err := store.DeleteMatch(ctx, recorded.ID); err != nil {
+					t.Fatalf("unexpected error deleting match: %v", err)
+				}
+				if _, err := store.GetMatch(ctx, recorded.ID); !errors.Is(err, ErrMatchNotFound) {
+					t.Errorf("expected the deleted match to be gone, got %v", err)
+				}
+				if page, _ := store.GetMatches(ctx, "Frank", MatchQuery{Limit: 10}); page.Total != 0 {
+					t.Errorf("expected the deleted match to leave Frank's history, got %+v", page)
+				}
+				if page, _ := store.GetMatches(ctx, "Alice", MatchQuery{Limit: 10}); page.Total != 3 {
+					t.Errorf("expected Alice's other matches to stay, got %+v", page)
+				}
+				if err := store.DeleteMatch(ctx, recorded.ID); !errors.Is(err, ErrMatchNotFound) {
+					t.Errorf("got error %v deleting again want %v", err, ErrMatchNotFound)
+				}
+			})
+
+			t.Run("rejects invalid matches", func(t *testing.T) {
+				for _, m := range []Match{
+					{Losers: []string{"Bob"}},
+					{Winner: "Alice"},
+					{Winner: "Alice", Losers: []string{"Alice"}},
+					{Winner: "Alice", Losers: []string{"Bob", "Bob"}},
+					{Winner: "Alice", Losers: []string{""}},
+					{ID: "m1", Winner: "Alice", Losers: []string{"Bob"}},
+				} {
+					if _, err := store.RecordMatch(ctx, m); err == nil {
+						t.Errorf("expected an error recording %+v", m)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestFileSystemMatchStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "matches.jsonl")
+	played := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	store, err := NewFileSystemMatchStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	want, err := store.RecordMatch(ctx, Match{Winner: "Alice", Losers: []string{"Bob"}, Game: "chess",
+		PlayedAt: played, Metadata: map[string]string{"table": "3"}})
+	if err != nil {
+		t.Fatalf("unexpected error recording match: %v", err)
+	}
+	store.Close()
+
+	// Simulate a crash midway through writing the next match
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	file.WriteString(`{"id":"torn","winner":"Bo`)
+	file.Close()
+
+	store, err = NewFileSystemMatchStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store: %v", err)
+	}
+	defer store.Close()
+
+	page, _ := store.GetMatches(ctx, "Bob", MatchQuery{Limit: 10})
+	if len(page.Matches) != 1 {
+		t.Fatalf("expected the recorded match to survive reopening, got %+v", page.Matches)
+	}
+	got := page.Matches[0]
+	if got.ID != want.ID || !got.PlayedAt.Equal(played) || got.Metadata["table"] != "3" || got.Game != "chess" {
+		t.Errorf("got %+v want %+v", got, want)
+	}
+
+	// The torn line is dropped and new matches are appended after the good ones
+	if _, err := store.RecordMatch(ctx, Match{Winner: "Bob", Losers: []string{"Alice"}}); err != nil {
+		t.Fatalf("unexpected error recording match: %v", err)
+	}
+	store.Close()
+	store, err = NewFileSystemMatchStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store after the torn line: %v", err)
+	}
+	defer store.Close()
+	page, _ = store.GetMatches(ctx, "Alice", MatchQuery{Limit: 10})
+	if page.Total != 2 {
+		t.Errorf("expected 2 matches after reopening, got %+v", page.Matches)
+	}
+	if all := store.AllMatches(); len(all) != 2 || all[0].ID != want.ID {
+		t.Errorf("expected every match oldest first, got %+v", all)
+	}
+
+	// Deleted matches stay deleted
+	if err := store.DeleteMatch(ctx, want.ID); err != nil {
+		t.Fatalf("unexpected error deleting match: %v", err)
+	}
+	store.Close()
+	store, err = NewFileSystemMatchStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening store after deleting: %v", err)
+	}
+	defer store.Close()
+	if all := store.AllMatches(); len(all) != 1 || all[0].ID == want.ID {
+		t.Errorf("expected the deleted match to stay deleted, got %+v", all)
+	}
+}
+
+// failingFile is a logFile whose next write stops halfway or whose next sync fails.
+type failingFile struct {
+	*os.File
+	tornWrite, failSync bool
+}
+
+func (f *failingFile) Write(b []byte) (int, error) {
+	if f.tornWrite {
+		f.tornWrite = false
+		n, _ := f.File.Write(b[:len(b)/2])
+		return n, errors.New("disk full")
+	}
+	return f.File.Write(b)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		f.failSync = false
+		return errors.New("I/O error")
+	}
+	return f.File.Sync()
+}
+
+func TestFileSystemMatchStore_FailedWrite(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		file failingFile
+	}{
+		{"torn write", failingFile{tornWrite: true}},
+		{"failed sync", failingFile{failSync: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			path := filepath.Join(t.TempDir(), "matches.jsonl")
+			store, err := NewFileSystemMatchStore(path)
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %v", err)
+			}
+			if _, err := store.RecordMatch(ctx, Match{ID: "m1", Winner: "Alice", Losers: []string{"Bob"}}); err != nil {
+				t.Fatalf("unexpected error recording match: %v", err)
+			}
+
+			file := tt.file
+			file.File = store.log.file.(*os.File)
+			store.log.file = &file
+			if _, err := store.RecordMatch(ctx, Match{ID: "failed", Winner: "Alice", Losers: []string{"Bob"}}); err == nil {
+				t.Fatal("expected the failed write to be an error")
+			}
+			if _, err := store.GetMatch(ctx, "failed"); !errors.Is(err, ErrMatchNotFound) {
+				t.Errorf("expected the failed match not to be recorded, got %v", err)
+			}
+			if _, err := store.RecordMatch(ctx, Match{ID: "m2", Winner: "Bob", Losers: []string{"Alice"}}); err != nil {
+				t.Fatalf("unexpected error recording after the failed write: %v", err)
+			}
+			store.Close()
+
+			store, err = NewFileSystemMatchStore(path)
+			if err != nil {
+				t.Fatalf("unexpected error reopening store: %v", err)
+			}
+			defer store.Close()
+			var ids []string
+			for _, m := range store.AllMatches() {
+				ids = append(ids, m.ID)
+			}
+			if !slices.Equal(ids, []string{"m1", "m2"}) {
+				t.Errorf("got matches %v want [m1 m2]", ids)
+			}
+		})
+	}
+}
+
+func TestPlayerServer_Matches(t *testing.T) {
+	newServer := func(t *testing.T) (*PlayerServer, *InMemoryPlayerStore) {
+		t.Helper()
+		store := NewInMemoryPlayerStore()
+		for _, name := range []string{"Alice", "Bob", "Carol"} {
+			if _, err := store.CreateUser(User{Name: name}); err != nil {
+				t.Fatalf("unexpected error creating user: %v", err)
+			}
+		}
+		server := NewPlayerServer(store)
+		server.Start()
+		return server, store
+	}
+
+	serve := func(server *PlayerServer, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("POST records the match and a win for the winner", func(t *testing.T) {
+		server, store := newServer(t)
+
+		response := serve(server, http.MethodPost, "/matches",
+			`{"winner":"Alice","losers":["Bob","Carol"],"game":"chess","playedAt":"`+time.Now().Format(time.RFC3339Nano)+`","metadata":{"table":"3"}}`)
+		if response.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body %q", response.Code, http.StatusCreated, response.Body.String())
+		}
+		var match Match
+		if err := json.NewDecoder(response.Body).Decode(&match); err != nil {
+			t.Fatalf("unable to parse match %q: %v", response.Body.String(), err)
+		}
+		if match.ID == "" || response.Header().Get("Location") != "/matches/"+match.ID {
+			t.Errorf("expected Location of the new match, got %q for %+v", response.Header().Get("Location"), match)
+		}
+
+		if got := store.GetPlayerScore("Alice"); got != 1 {
+			t.Errorf("got Alice's score %d want 1", got)
+		}
+		if got := store.GetPlayerScore("Bob"); got != 0 {
+			t.Errorf("got Bob's score %d want 0", got)
+		}
+
+		response = serve(server, http.MethodGet, "/user/Carol/matches", "")
+		var page MatchPage
+		if err := json.NewDecoder(response.Body).Decode(&page); err != nil {
+			t.Fatalf("unable to parse page %q: %v", response.Body.String(), err)
+		}
+		if page.Total != 1 || len(page.Matches) != 1 || page.Matches[0].ID != match.ID || page.Matches[0].Metadata["table"] != "3" {
+			t.Errorf("expected Carol's match history to hold the match, got %+v", page)
+		}
+		if page.Limit != defaultMatchLimit {
+			t.Errorf("got limit %d want %d", page.Limit, defaultMatchLimit)
+		}
+	})
+
+	t.Run("POST errors", func(t *testing.T) {
+		server, store := newServer(t)
+
+		tests := []struct {
+			name           string
+			body           string
+			expectedStatus int
+		}{
+			{"malformed JSON", `{"winner":`, http.StatusBadRequest},
+			{"no losers", `{"winner":"Alice","losers":[]}`, http.StatusBadRequest},
+			{"winner also lost", `{"winner":"Alice","losers":["Alice"]}`, http.StatusBadRequest},
+			{"unregistered loser", `{"winner":"Alice","losers":["Mallory"]}`, http.StatusUnprocessableEntity},
+			{"unregistered winner", `{"winner":"Mallory","losers":["Alice"]}`, http.StatusUnprocessableEntity},
+			{"played before the current rating period", `{"winner":"Alice","losers":["Bob"],"playedAt":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+			{"played after the current rating period", `{"winner":"Alice","losers":["Bob"],"playedAt":"3000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+			{"too large", `{"winner":"Alice","losers":["Bob"],"game":"` + strings.Repeat("x", maxMatchBodySize) + `"}`, http.StatusRequestEntityTooLarge},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response := serve(server, http.MethodPost, "/matches", tt.body)
+				if response.Code != tt.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v, body %q", response.Code, tt.expectedStatus, response.Body.String())
+				}
+			})
+		}
+		if league := store.GetLeague(); slices.ContainsFunc(league, func(p Player) bool { return p.Wins > 0 }) {
+			t.Errorf("expected rejected matches not to record wins, got %v", league)
+		}
+	})
+
+	t.Run("POST needs credentials for the winner", func(t *testing.T) {
+		server, _ := newServer(t)
+		server.Auth = NewAPIKeyAuthenticator(map[string]Principal{
+			"bob-key": {Subject: "bob-client", Players: []string{"Bob"}},
+		})
+		server.Start()
+
+		body := `{"winner":"Alice","losers":["Bob"]}`
+		if response := serve(server, http.MethodPost, "/matches", body); response.Code != http.StatusUnauthorized {
+			t.Errorf("got status %v without credentials want %v", response.Code, http.StatusUnauthorized)
+		}
+		request, _ := http.NewRequest(http.MethodPost, "/matches", strings.NewReader(body))
+		request.Header.Set(APIKeyHeader, "bob-key")
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		if response.Code != http.StatusForbidden {
+			t.Errorf("got status %v for a loser's key want %v", response.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("POST undoes the match if the win fails", func(t *testing.T) {
+		store := &GatedPlayerStore{gate: make(chan struct{}), err: ErrStoreUnavailable}
+		close(store.gate)
+		server := NewPlayerServerV2(store)
+		server.Start()
+
+		body := `{"id":"m1","winner":"Alice","losers":["Bob"]}`
+		if response := serve(server, http.MethodPost, "/matches", body); response.Code != http.StatusServiceUnavailable {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusServiceUnavailable)
+		}
+		if page, _ := server.Matches.GetMatches(context.Background(), "Alice", MatchQuery{Limit: 10}); page.Total != 0 {
+			t.Errorf("expected the match whose win failed to be removed, got %+v", page)
+		}
+
+		// The retry records the match once
+		store.err = nil
+		if response := serve(server, http.MethodPost, "/matches", body); response.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusCreated)
+		}
+		if page, _ := server.Matches.GetMatches(context.Background(), "Alice", MatchQuery{Limit: 10}); page.Total != 1 {
+			t.Errorf("expected the retried match to be recorded once, got %+v", page)
+		}
+	})
+
+	t.Run("GET by ID", func(t *testing.T) {
+		server, _ := newServer(t)
+		response := serve(server, http.MethodPost, "/matches", `{"winner":"Alice","losers":["Bob"],"game":"chess"}`)
+		location := response.Header().Get("Location")
+
+		response = serve(server, http.MethodGet, location, "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		var match Match
+		json.NewDecoder(response.Body).Decode(&match)
+		if "/matches/"+match.ID != location || match.Game != "chess" {
+			t.Errorf("expected the match at %s, got %+v", location, match)
+		}
+
+		if response := serve(server, http.MethodGet, "/matches/missing", ""); response.Code != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("GET filters and pages", func(t *testing.T) {
+		server, _ := newServer(t)
+		// Matches must be played in the current rating period, a day by default
+		start, _ := server.Ratings.CurrentPeriod()
+		for i := range 5 {
+			body := `{"winner":"Alice","losers":["Bob"],"playedAt":"` + start.Add(time.Duration(i)*time.Hour).Format(time.RFC3339) + `"}`
+			if response := serve(server, http.MethodPost, "/matches", body); response.Code != http.StatusCreated {
+				t.Fatalf("unexpected status recording match: %v", response.Code)
+			}
+		}
+
+		response := serve(server, http.MethodGet, "/user/Bob/matches?from="+start.Add(time.Hour).Format(time.RFC3339)+"&to="+start.Add(4*time.Hour).Format(time.RFC3339)+"&offset=1&limit=1", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		var page MatchPage
+		json.NewDecoder(response.Body).Decode(&page)
+		if page.Total != 3 || len(page.Matches) != 1 || !page.Matches[0].PlayedAt.Equal(start.Add(2*time.Hour)) {
+			t.Errorf("expected the second newest of 3 matches from 1 to 4 hours into the period, got %+v", page)
+		}
+	})
+
+	t.Run("GET errors", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		tests := []struct {
+			name           string
+			path           string
+			expectedStatus int
+		}{
+			{"unknown player", "/user/Mallory/matches", http.StatusNotFound},
+			{"invalid from", "/user/Alice/matches?from=yesterday", http.StatusBadRequest},
+			{"negative offset", "/user/Alice/matches?offset=-1", http.StatusBadRequest},
+			{"limit too large", "/user/Alice/matches?limit=1000", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response := serve(server, http.MethodGet, tt.path, "")
+				if response.Code != tt.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", response.Code, tt.expectedStatus)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request latency histogram.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// unmatchedRoute labels requests that didn't match any route.
+const unmatchedRoute = "unmatched"
+
+// httpMetrics counts requests, errors and latencies per route and writes them
+// in the Prometheus text exposition format.
+type httpMetrics struct {
+	mu     sync.Mutex
+	routes map[string]*routeMetrics
+}
+
+// routeMetrics are the metrics of a single route pattern.
+type routeMetrics struct {
+	codes   map[int]uint64
+	errors  uint64
+	buckets []uint64 // cumulative counts per latencyBuckets entry
+	count   uint64
+	sum     float64
+}
+
+func newHTTPMetrics() *httpMetrics {
+	return &httpMetrics{routes: make(map[string]*routeMetrics)}
+}
+
+// instrument wraps next so every request it serves is recorded by route pattern.
+func (m *httpMetrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		route, _ := routeOf(r)
+		m.observe(route, sw.Status(), time.Since(start))
+	})
+}
+
+// observe records one request, responses with a 5xx status are counted as errors.
+func (m *httpMetrics) observe(route string, status int, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rm, ok := m.routes[route]
+	if !ok {
+		rm = &routeMetrics{
+			codes:   make(map[int]uint64),
+			buckets: make([]uint64, len(latencyBuckets)),
+		}
+		m.routes[route] = rm
+	}
+
+	rm.codes[status]++
+	if status >= http.StatusInternalServerError {
+		rm.errors++
+	}
+	seconds := latency.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			rm.buckets[i]++
+		}
+	}
+	rm.count++
+	rm.sum += seconds
+}
+
+// serveHTTP writes the metrics for the /metrics route.
+func (m *httpMetrics) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.writeTo(w)
+}
+
+// writeTo writes the metrics in the Prometheus text format, sorted by route so the output is stable.
+func (m *httpMetrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routes := make([]string, 0, len(m.routes))
+	for route := range m.routes {
+		routes = append(routes, route)
+	}
+	slices.Sort(routes)
+
+	fmt.Fprintln(w, "# HELP player_http_requests_total Requests served, by route and status code.")
+	fmt.Fprintln(w, "# TYPE player_http_requests_total counter")
+	for _, route := range routes {
+		rm := m.routes[route]
+		codes := make([]int, 0, len(rm.codes))
+		for code := range rm.codes {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "player_http_requests_total{route=%s,code=\"%d\"} %d\n", quoteLabel(route), code, rm.codes[code])
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP player_http_request_errors_total Requests answered with a 5xx status, by route.")
+	fmt.Fprintln(w, "# TYPE player_http_request_errors_total counter")
+	for _, route := range routes {
+		fmt.Fprintf(w, "player_http_request_errors_total{route=%s} %d\n", quoteLabel(route), m.routes[route].errors)
+	}
+
+	fmt.Fprintln(w, "# HELP player_http_request_duration_seconds Request latency, by route.")
+	fmt.Fprintln(w, "# TYPE player_http_request_duration_seconds histogram")
+	for _, route := range routes {
+		rm := m.routes[route]
+		label := quoteLabel(route)
+		for i, bound := range latencyBuckets {
+			fmt.Fprintf(w, "player_http_request_duration_seconds_bucket{route=%s,le=\"%s\"} %d\n",
+				label, strconv.FormatFloat(bound, 'g', -1, 64), rm.buckets[i])
+		}
+		fmt.Fprintf(w, "player_http_request_duration_seconds_bucket{route=%s,le=\"+Inf\"} %d\n", label, rm.count)
+		fmt.Fprintf(w, "player_http_request_duration_seconds_sum{route=%s} %s\n", label, strconv.FormatFloat(rm.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "player_http_request_duration_seconds_count{route=%s} %d\n", label, rm.count)
+	}
+}
+
+// labelEscaper escapes a label value as the Prometheus text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel returns a quoted and escaped label value.
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
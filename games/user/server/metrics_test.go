@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayerServer_Metrics(t *testing.T) {
+	server := NewPlayerServerV2(&StubPlayerStoreV2{err: ErrStoreUnavailable})
+	server.AutoCreate = true
+	server.Start()
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	serve(http.MethodGet, "/user/Alice/score")
+	serve(http.MethodGet, "/user/Bob/score")
+	serve(http.MethodGet, "/healthz")
+	serve(http.MethodGet, "/no/such/route")
+
+	response := serve(http.MethodGet, "/metrics")
+	if response.Code != http.StatusOK {
+		t.Fatalf("GET /metrics returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+	}
+	body := response.Body.String()
+
+	expectedLines := []string{
+		`# TYPE player_http_requests_total counter`,
+		`player_http_requests_total{route="GET /user/{name}/score",code="503"} 2`,
+		`player_http_requests_total{route="GET /healthz",code="200"} 1`,
+		`player_http_requests_total{route="unmatched",code="404"} 1`,
+		`player_http_request_errors_total{route="GET /user/{name}/score"} 2`,
+		`player_http_request_errors_total{route="GET /healthz"} 0`,
+		`# TYPE player_http_request_duration_seconds histogram`,
+		`player_http_request_duration_seconds_bucket{route="GET /user/{name}/score",le="+Inf"} 2`,
+		`player_http_request_duration_seconds_count{route="GET /user/{name}/score"} 2`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected metrics to contain %q, got\n%s", line, body)
+		}
+	}
+}
+
+func TestHTTPMetrics_Buckets(t *testing.T) {
+	metrics := newHTTPMetrics()
+	metrics.observe("GET /league", http.StatusOK, 20*time.Millisecond)
+	metrics.observe("GET /league", http.StatusOK, 3*time.Second)
+
+	var out strings.Builder
+	metrics.writeTo(&out)
+
+	expectedLines := []string{
+		`player_http_request_duration_seconds_bucket{route="GET /league",le="0.01"} 0`,
+		`player_http_request_duration_seconds_bucket{route="GET /league",le="0.025"} 1`,
+		`player_http_request_duration_seconds_bucket{route="GET /league",le="2.5"} 1`,
+		`player_http_request_duration_seconds_bucket{route="GET /league",le="5"} 2`,
+		`player_http_request_duration_seconds_sum{route="GET /league"} 3.02`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected metrics to contain %q, got\n%s", line, out.String())
+		}
+	}
+}
+
+func TestQuoteLabel(t *testing.T) {
+	got := quoteLabel("a\"b\\c\nd")
+	want := `"a\"b\\c\nd"`
+	if got != want {
+		t.Errorf("got %s want %s", got, want)
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// RequestIDHeader carries the ID of a request, it is propagated from the
+// client when present and generated otherwise.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds request IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// Middleware wraps an http.Handler with extra behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in the middleware, the first middleware is the outermost.
+func Chain(h http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// requestIDKey is the context key of the request ID.
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request ID set by the RequestID middleware, "" if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID propagates the client's X-Request-ID, or generates one, echoes it
+// on the response and adds it to the request context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID reports whether a client supplied ID is safe to log and echo.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128 bit hex ID.
+func newRequestID() string {
+	return randomHex(16)
+}
+
+// routeInfo is filled in by the route that serves a request so middleware
+// wrapping the mux can label it, even if inner middleware replaced the request.
+type routeInfo struct {
+	pattern string
+	player  string
+}
+
+// routeInfoKey is the context key of the routeInfo.
+type routeInfoKey struct{}
+
+// trackRoute adds an empty routeInfo to the request for the matched route to fill in.
+func trackRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeInfoKey{}, &routeInfo{})))
+	})
+}
+
+// routed wraps the handler of a route so it records its pattern in the routeInfo.
+func routed(pattern string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(routeInfoKey{}).(*routeInfo); ok {
+			info.pattern = pattern
+			info.player = r.PathValue("name")
+		}
+		h(w, r)
+	})
+}
+
+// routeOf returns the route pattern and player name of a served request.
+// Without a routeInfo it falls back to what the mux set on r.
+func routeOf(r *http.Request) (pattern, player string) {
+	if info, ok := r.Context().Value(routeInfoKey{}).(*routeInfo); ok && info.pattern != "" {
+		pattern, player = info.pattern, info.player
+	} else {
+		pattern, player = r.Pattern, r.PathValue("name")
+	}
+	if pattern == "" {
+		pattern = unmatchedRoute
+	}
+	return pattern, player
+}
+
+// AccessLog writes a structured log entry for every request once it has been served.
+func AccessLog(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			route, player := routeOf(r)
+			attrs := []slog.Attr{
+				slog.String("request_id", RequestIDFromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("route", route),
+				slog.Int("status", sw.Status()),
+				slog.Int("bytes", sw.bytes),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if player != "" {
+				attrs = append(attrs, slog.String("player", player))
+			}
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+		})
+	}
+}
+
+// Recover turns a panicking handler into a logged 500 response.
+// http.ErrAbortHandler is re-panicked so net/http can abort the response as intended.
+func Recover(logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				logger.LogAttrs(r.Context(), slog.LevelError, "panic serving request",
+					slog.String("request_id", RequestIDFromContext(r.Context())),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("panic", fmt.Sprint(v)),
+					slog.String("stack", string(debug.Stack())),
+				)
+				// Too late to change the status once the handler started writing
+				if sw.status == 0 {
+					http.Error(sw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// statusWriter records the status code and body size written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// Status returns the status code written, 200 if the handler wrote nothing.
+func (s *statusWriter) Status() int {
+	if s.status == 0 {
+		return http.StatusOK
+	}
+	return s.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush.
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
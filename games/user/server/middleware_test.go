@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// PanickingPlayerStore is a PlayerStoreV2 that panics on every call.
+type PanickingPlayerStore struct{}
+
+func (PanickingPlayerStore) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	panic("score table corrupted")
+}
+
+func (PanickingPlayerStore) RecordWin(ctx context.Context, name string) error {
+	panic("score table corrupted")
+}
+
+func (PanickingPlayerStore) GetLeague(ctx context.Context) ([]Player, error) {
+	panic("score table corrupted")
+}
+
+// logEntries decodes the JSON log lines written to buf.
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("unable to parse log line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestPlayerServer_AccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewPlayerServer(NewSpyPlayerStore(t))
+	server.AutoCreate = true
+	server.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	server.Start()
+
+	request, _ := http.NewRequest(http.MethodGet, "/user/Alice/score", nil)
+	request.Header.Set(RequestIDHeader, "abc-123")
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, request)
+
+	if got := response.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("expected request ID to be propagated, got %q", got)
+	}
+
+	entries := logEntries(t, &logs)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 log entry, got %d: %s", len(entries), logs.String())
+	}
+	entry := entries[0]
+
+	expected := map[string]any{
+		"msg":        "request",
+		"request_id": "abc-123",
+		"method":     "GET",
+		"route":      "GET /user/{name}/score",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(1),
+		"player":     "Alice",
+	}
+	for key, want := range expected {
+		if entry[key] != want {
+			t.Errorf("log entry %s: got %v want %v", key, entry[key], want)
+		}
+	}
+	if _, ok := entry["duration"]; !ok {
+		t.Errorf("expected log entry to have a duration, got %v", entry)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		generate bool
+	}{
+		{"generated when missing", "", true},
+		{"propagated when valid", "req-42", false},
+		{"replaced when it has spaces", "not valid", true},
+		{"replaced when too long", strings.Repeat("a", maxRequestIDLength+1), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				request.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, request)
+
+			got := response.Header().Get(RequestIDHeader)
+			if got != seen {
+				t.Errorf("response ID %q doesn't match context ID %q", got, seen)
+			}
+			if tt.generate && (got == tt.incoming || len(got) != 32) {
+				t.Errorf("expected a generated ID, got %q", got)
+			}
+			if !tt.generate && got != tt.incoming {
+				t.Errorf("expected ID %q to be propagated, got %q", tt.incoming, got)
+			}
+		})
+	}
+}
+
+func TestPlayerServer_RecoversFromPanics(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewPlayerServerV2(PanickingPlayerStore{})
+	server.AutoCreate = true
+	server.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	server.Start()
+
+	request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, request)
+
+	if response.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusInternalServerError)
+	}
+
+	entries := logEntries(t, &logs)
+	if len(entries) != 2 {
+		t.Fatalf("expected a panic and an access log entry, got %d: %s", len(entries), logs.String())
+	}
+
+	panicEntry, accessEntry := entries[0], entries[1]
+	if panicEntry["level"] != "ERROR" || panicEntry["panic"] != "score table corrupted" {
+		t.Errorf("unexpected panic log entry %v", panicEntry)
+	}
+	if stack, _ := panicEntry["stack"].(string); !strings.Contains(stack, "RecordWin") {
+		t.Errorf("expected panic log entry to have a stack trace, got %v", panicEntry["stack"])
+	}
+	if accessEntry["status"] != float64(http.StatusInternalServerError) {
+		t.Errorf("expected access log to record the 500, got %v", accessEntry)
+	}
+	if panicEntry["request_id"] != accessEntry["request_id"] {
+		t.Errorf("expected both entries to share a request ID, got %v and %v", panicEntry["request_id"], accessEntry["request_id"])
+	}
+}
+
+func TestPlayerServer_CustomMiddlewareKeepsRouteLabels(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewPlayerServer(NewSpyPlayerStore(t))
+	server.AutoCreate = true
+	server.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	// Middleware that replaces the request, as anything adding to the context does
+	type key struct{}
+	server.Middleware = []Middleware{func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), key{}, true)))
+		})
+	}}
+	server.Start()
+
+	request, _ := http.NewRequest(http.MethodGet, "/league", nil)
+	server.Handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	entries := logEntries(t, &logs)
+	if len(entries) != 1 || entries[0]["route"] != "GET /league" {
+		t.Errorf("expected access log for route GET /league, got %s", logs.String())
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), tag("outer"), tag("inner"))
+
+	request, _ := http.NewRequest(http.MethodGet, "/", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	if strings.Join(order, ",") != "outer,inner,handler" {
+		t.Errorf("got order %v want [outer inner handler]", order)
+	}
+}
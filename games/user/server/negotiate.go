@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media types PlayerServer can represent its resources as.
+const (
+	mediaText = "text/plain"
+	mediaJSON = "application/json"
+	mediaCSV  = "text/csv"
+)
+
+// negotiate picks the media type to answer r with from offers, in the server's
+// order of preference. The first offer is used when the request has no Accept
+// header. ok is false if the client accepts none of the offers. The response
+// is marked as varying with Accept so caches keep each representation apart.
+func negotiate(w http.ResponseWriter, r *http.Request, offers ...string) (mediaType string, ok bool) {
+	w.Header().Add("Vary", "Accept")
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	bestQ := 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			mediaType, bestQ = offer, q
+		}
+	}
+	return mediaType, bestQ > 0
+}
+
+// mediaRange is a single entry of an Accept header, e.g. text/* with q=0.5.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses an Accept header, malformed entries are skipped.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+		mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "q") {
+				if q, err := strconv.ParseFloat(value, 64); err == nil {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value the most specific matching range gives mediaType,
+// 0 if no range matches.
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+// notAcceptable answers a request whose Accept header matches none of the offers.
+func notAcceptable(w http.ResponseWriter, offers ...string) {
+	http.Error(w, "not acceptable, available types are "+strings.Join(offers, ", "), http.StatusNotAcceptable)
+}
+
+// writeScore writes a player's score in the negotiated media type.
+func writeScore(w http.ResponseWriter, mediaType string, name string, score int) {
+	switch mediaType {
+	case mediaJSON:
+		writeJSON(w, Player{Name: name, Wins: score})
+	case mediaCSV:
+		writeCSV(w, []string{"name", "wins"}, [][]string{{name, strconv.Itoa(score)}})
+	default:
+		w.Header().Set("Content-Type", mediaText)
+		fmt.Fprint(w, score)
+	}
+}
+
+// writeUser writes a user in the negotiated media type.
+func writeUser(w http.ResponseWriter, mediaType string, user User) {
+	switch mediaType {
+	case mediaCSV:
+		writeCSV(w, []string{"name", "displayName", "wins", "createdAt", "updatedAt"}, [][]string{{
+			user.Name,
+			user.DisplayName,
+			strconv.Itoa(user.Wins),
+			user.CreatedAt.Format(time.RFC3339),
+			user.UpdatedAt.Format(time.RFC3339),
+		}})
+	case mediaText:
+		w.Header().Set("Content-Type", mediaText)
+		fmt.Fprintf(w, "name: %s\ndisplayName: %s\nwins: %d\ncreatedAt: %s\nupdatedAt: %s\n",
+			user.Name, user.DisplayName, user.Wins,
+			user.CreatedAt.Format(time.RFC3339), user.UpdatedAt.Format(time.RFC3339))
+	default:
+		writeJSON(w, user)
+	}
+}
+
+// writeLeague writes the league in the negotiated media type.
+func writeLeague(w http.ResponseWriter, mediaType string, league []Player) {
+	switch mediaType {
+	case mediaCSV:
+		rows := make([][]string, 0, len(league))
+		for _, player := range league {
+			rows = append(rows, []string{player.Name, strconv.Itoa(player.Wins)})
+		}
+		writeCSV(w, []string{"name", "wins"}, rows)
+	case mediaText:
+		w.Header().Set("Content-Type", mediaText)
+		for _, player := range league {
+			fmt.Fprintf(w, "%s %d\n", player.Name, player.Wins)
+		}
+	default:
+		writeJSON(w, league)
+	}
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", mediaJSON)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// writeCSV writes a header row and rows as a CSV response.
+func writeCSV(w http.ResponseWriter, header []string, rows [][]string) {
+	w.Header().Set("Content-Type", mediaCSV)
+	cw := csv.NewWriter(w)
+	cw.Write(header)
+	cw.WriteAll(rows)
+}
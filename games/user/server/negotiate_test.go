@@ -0,0 +1,168 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name       string
+		accept     string
+		offers     []string
+		expected   string
+		acceptable bool
+	}{
+		{"no Accept header uses the default", "", scoreTypes, mediaText, true},
+		{"exact match", "application/json", scoreTypes, mediaJSON, true},
+		{"wildcard uses the default", "*/*", userTypes, mediaJSON, true},
+		{"type wildcard", "text/*", userTypes, mediaText, true},
+		{"highest quality wins", "text/plain;q=0.5, text/csv", scoreTypes, mediaCSV, true},
+		{"specific range overrides wildcard", "*/*;q=0.1, text/csv;q=0", scoreTypes, mediaText, true},
+		{"media types are case insensitive", "Application/JSON", scoreTypes, mediaJSON, true},
+		{"unsupported type", "application/xml", scoreTypes, "", false},
+		{"refused with q=0", "application/json;q=0", userTypes, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			response := httptest.NewRecorder()
+
+			got, ok := negotiate(response, request, tt.offers...)
+			if ok != tt.acceptable || got != tt.expected {
+				t.Errorf("negotiate(%q) = %q, %v want %q, %v", tt.accept, got, ok, tt.expected, tt.acceptable)
+			}
+			if vary := response.Header().Get("Vary"); vary != "Accept" {
+				t.Errorf("got Vary %q want %q", vary, "Accept")
+			}
+		})
+	}
+}
+
+func TestPlayerServer_ContentNegotiation(t *testing.T) {
+	server, store := setupTestServer(t)
+	store.StubScore("Alice", 5)
+	store.StubScore("Bob", 10)
+
+	tests := []struct {
+		name                string
+		path                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "score as text by default",
+			path:                "/user/Alice/score",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaText,
+			expectedBody:        "5",
+		},
+		{
+			name:                "score as JSON",
+			path:                "/user/Alice/score",
+			accept:              "application/json",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaJSON,
+			expectedBody:        "{\"name\":\"Alice\",\"wins\":5}\n",
+		},
+		{
+			name:                "score as CSV",
+			path:                "/user/Alice/score",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaCSV,
+			expectedBody:        "name,wins\nAlice,5\n",
+		},
+		{
+			name:           "score as XML is not acceptable",
+			path:           "/user/Alice/score",
+			accept:         "application/xml",
+			expectedStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:                "user as CSV",
+			path:                "/user/Alice",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaCSV,
+			expectedBody:        "name,displayName,wins,createdAt,updatedAt\nAlice,Alice,5,0001-01-01T00:00:00Z,0001-01-01T00:00:00Z\n",
+		},
+		{
+			name:                "user as text",
+			path:                "/user/Alice",
+			accept:              "text/plain",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaText,
+			expectedBody:        "name: Alice\ndisplayName: Alice\nwins: 5\ncreatedAt: 0001-01-01T00:00:00Z\nupdatedAt: 0001-01-01T00:00:00Z\n",
+		},
+		{
+			name:           "user as XML is not acceptable",
+			path:           "/user/Alice",
+			accept:         "application/xml",
+			expectedStatus: http.StatusNotAcceptable,
+		},
+		{
+			name:                "league as JSON by default",
+			path:                "/league",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaJSON,
+			expectedBody:        "[{\"name\":\"Bob\",\"wins\":10},{\"name\":\"Alice\",\"wins\":5}]\n",
+		},
+		{
+			name:                "league as CSV",
+			path:                "/league",
+			accept:              "text/csv",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaCSV,
+			expectedBody:        "name,wins\nBob,10\nAlice,5\n",
+		},
+		{
+			name:                "league as text",
+			path:                "/league",
+			accept:              "text/plain",
+			expectedStatus:      http.StatusOK,
+			expectedContentType: mediaText,
+			expectedBody:        "Bob 10\nAlice 5\n",
+		},
+		{
+			name:           "league as XML is not acceptable",
+			path:           "/league",
+			accept:         "application/xml",
+			expectedStatus: http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := http.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			response := httptest.NewRecorder()
+			server.Handler.ServeHTTP(response, request)
+
+			if response.Code != tt.expectedStatus {
+				t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, tt.expectedStatus)
+			}
+			if got := response.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("expected responses to vary with Accept, got Vary %q", got)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if got := response.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("handler returned wrong content type: got %q want %q", got, tt.expectedContentType)
+			}
+			if response.Body.String() != tt.expectedBody {
+				t.Errorf("handler returned unexpected body: got %q want %q", response.Body.String(), tt.expectedBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"math/rand/v2"
+	"strings"
+)
+
+// Skip list parameters, with p = 1/4 a list of maxRankLevel levels indexes far
+// more players than fit in memory.
+const (
+	maxRankLevel = 24
+	rankLevelP   = 4
+)
+
+// rankKey orders players by wins descending, then by name.
+type rankKey struct {
+	wins int
+	name string
+}
+
+func (k rankKey) less(other rankKey) bool {
+	if k.wins != other.wins {
+		return k.wins > other.wins
+	}
+	return strings.Compare(k.name, other.name) < 0
+}
+
+// rankNode is a player in the rank index. span[i] is how many places the
+// link next[i] skips, so summing spans along a search gives a player's position.
+type rankNode struct {
+	key  rankKey
+	next []*rankNode
+	span []int
+}
+
+// rankIndex is an indexable skip list of players ordered by rankKey. Finding,
+// adding and removing a player and finding a position are O(log n).
+// It does no locking, the owning store guards it.
+type rankIndex struct {
+	head   *rankNode
+	level  int
+	length int
+}
+
+func newRankIndex() *rankIndex {
+	return &rankIndex{
+		head:  &rankNode{next: make([]*rankNode, maxRankLevel), span: make([]int, maxRankLevel)},
+		level: 1,
+	}
+}
+
+// randomLevel picks a new node's level, each level up is rankLevelP times less likely.
+func randomLevel() int {
+	level := 1
+	for level < maxRankLevel && rand.IntN(rankLevelP) == 0 {
+		level++
+	}
+	return level
+}
+
+// insert adds a player, their key must not already be in the index.
+func (idx *rankIndex) insert(key rankKey) {
+	var update [maxRankLevel]*rankNode
+	// position[i] is the position of update[i], the last node before key on level i
+	var position [maxRankLevel]int
+
+	x := idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		if i < idx.level-1 {
+			position[i] = position[i+1]
+		}
+		for x.next[i] != nil && x.next[i].key.less(key) {
+			position[i] += x.span[i]
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	level := randomLevel()
+	for i := idx.level; i < level; i++ {
+		update[i] = idx.head
+		idx.head.span[i] = idx.length
+	}
+	idx.level = max(idx.level, level)
+
+	node := &rankNode{key: key, next: make([]*rankNode, level), span: make([]int, level)}
+	for i := range level {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+		node.span[i] = update[i].span[i] - (position[0] - position[i])
+		update[i].span[i] = position[0] - position[i] + 1
+	}
+	for i := level; i < idx.level; i++ {
+		update[i].span[i]++
+	}
+	idx.length++
+}
+
+// remove removes a player, it does nothing if their key isn't in the index.
+func (idx *rankIndex) remove(key rankKey) {
+	var update [maxRankLevel]*rankNode
+	x := idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key.less(key) {
+			x = x.next[i]
+		}
+		update[i] = x
+	}
+
+	node := update[0].next[0]
+	if node == nil || node.key != key {
+		return
+	}
+	for i := range idx.level {
+		if update[i].next[i] == node {
+			update[i].span[i] += node.span[i] - 1
+			update[i].next[i] = node.next[i]
+		} else {
+			update[i].span[i]--
+		}
+	}
+	for idx.level > 1 && idx.head.next[idx.level-1] == nil {
+		idx.level--
+	}
+	idx.length--
+}
+
+// countBefore returns how many players are ordered before key.
+func (idx *rankIndex) countBefore(key rankKey) int {
+	count := 0
+	x := idx.head
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key.less(key) {
+			count += x.span[i]
+			x = x.next[i]
+		}
+	}
+	return count
+}
+
+// rank returns the competition rank of a player with the given wins, one more
+// than the number of players with more wins. Ties share a rank and the next
+// rank is skipped, 1224.
+func (idx *rankIndex) rank(wins int) int {
+	// The empty name is ordered before every player with the same wins
+	return idx.countBefore(rankKey{wins: wins}) + 1
+}
+
+// page returns up to limit players starting at the 0-based position offset, ranked.
+func (idx *rankIndex) page(offset, limit int) []RankedPlayer {
+	if offset >= idx.length || limit <= 0 {
+		return []RankedPlayer{}
+	}
+
+	// Walk down to the node at offset, positions are 1-based along the spans
+	x := idx.head
+	traversed := 0
+	for i := idx.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && traversed+x.span[i] <= offset+1 {
+			traversed += x.span[i]
+			x = x.next[i]
+		}
+	}
+
+	page := make([]RankedPlayer, 0, min(limit, idx.length-offset))
+	rank := idx.rank(x.key.wins)
+	for position := offset; x != nil && len(page) < limit; position, x = position+1, x.next[0] {
+		if len(page) > 0 && x.key.wins != page[len(page)-1].Wins {
+			rank = position + 1
+		}
+		page = append(page, RankedPlayer{Rank: rank, Name: x.key.name, Wins: x.key.wins})
+	}
+	return page
+}
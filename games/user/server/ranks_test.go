@@ -0,0 +1,199 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRankIndex(t *testing.T) {
+	// Check the index against sorting a plain map after random wins and deletions
+	rng := rand.New(rand.NewPCG(1, 2))
+	users := newUserTable()
+	wins := map[string]int{}
+
+	for step := range 5000 {
+		name := fmt.Sprintf("player-%d", rng.IntN(300))
+		switch {
+		case rng.IntN(10) == 0:
+			users.delete(name)
+			delete(wins, name)
+		default:
+			users.recordWin(name, time.Now())
+			wins[name]++
+		}
+
+		if step%250 != 0 {
+			continue
+		}
+		want := rankedBySorting(wins)
+		got, total := users.leaderboard(0, len(wins)+1)
+		if total != len(wins) || !reflect.DeepEqual(got, want) {
+			t.Fatalf("step %d: leaderboard doesn't match sorting the league", step)
+		}
+		for _, player := range want {
+			if got := users.rank(player.Name); got != player {
+				t.Fatalf("step %d: got rank %+v want %+v", step, got, player)
+			}
+		}
+		for _, offset := range []int{0, 1, 7, len(want) / 2, len(want) - 1} {
+			offset = max(min(offset, len(want)), 0)
+			page, _ := users.leaderboard(offset, 5)
+			if !reflect.DeepEqual(page, want[offset:min(offset+5, len(want))]) {
+				t.Fatalf("step %d: page at offset %d doesn't match", step, offset)
+			}
+		}
+	}
+}
+
+// rankedBySorting ranks players by sorting them.
+func rankedBySorting(wins map[string]int) []RankedPlayer {
+	var league []Player
+	for name, w := range wins {
+		league = append(league, Player{Name: name, Wins: w})
+	}
+	ranked, _, _ := sortedLeague{AdaptPlayerStore(staticLeague(league))}.GetLeaderboard(context.Background(), 0, len(league))
+	return ranked
+}
+
+// staticLeague is a PlayerStore serving a fixed league.
+type staticLeague []Player
+
+func (s staticLeague) GetPlayerScore(name string) int {
+	if i := slices.IndexFunc(s, func(p Player) bool { return p.Name == name }); i >= 0 {
+		return s[i].Wins
+	}
+	return 0
+}
+func (s staticLeague) RecordWin(name string) {}
+func (s staticLeague) GetLeague() []Player   { return slices.Clone(s) }
+
+func TestPlayerServer_Leaderboard(t *testing.T) {
+	league := staticLeague{{"Alice", 5}, {"Bob", 3}, {"Carol", 3}, {"Dave", 1}, {"Erin", 0}}
+	want := []RankedPlayer{{1, "Alice", 5}, {2, "Bob", 3}, {2, "Carol", 3}, {4, "Dave", 1}, {5, "Erin", 0}}
+
+	indexed := NewInMemoryPlayerStore()
+	for _, player := range league {
+		indexed.CreateUser(User{Name: player.Name})
+		for range player.Wins {
+			indexed.RecordWin(player.Name)
+		}
+	}
+
+	stores := map[string]PlayerStore{
+		"indexed store":          indexed,
+		"store without an index": league,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			server := NewPlayerServer(store)
+			server.Start()
+			serve := func(path string) *httptest.ResponseRecorder {
+				request, _ := http.NewRequest(http.MethodGet, path, nil)
+				response := httptest.NewRecorder()
+				server.Handler.ServeHTTP(response, request)
+				return response
+			}
+
+			pages := []struct {
+				query string
+				want  LeaderboardPage
+			}{
+				{"", LeaderboardPage{Players: want, Total: 5, Limit: defaultLeaderboardLimit}},
+				{"?offset=2&limit=2", LeaderboardPage{Players: want[2:4], Total: 5, Offset: 2, Limit: 2}},
+				{"?offset=9", LeaderboardPage{Players: []RankedPlayer{}, Total: 5, Offset: 9, Limit: defaultLeaderboardLimit}},
+			}
+			for _, page := range pages {
+				response := serve("/leaderboard" + page.query)
+				var got LeaderboardPage
+				if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+					t.Fatalf("unable to parse leaderboard %q: %v", response.Body.String(), err)
+				}
+				if !reflect.DeepEqual(got, page.want) {
+					t.Errorf("GET /leaderboard%s got %+v want %+v", page.query, got, page.want)
+				}
+			}
+
+			for _, player := range want {
+				response := serve("/user/" + player.Name + "/rank")
+				var got RankedPlayer
+				json.NewDecoder(response.Body).Decode(&got)
+				if got != player {
+					t.Errorf("got rank %+v want %+v", got, player)
+				}
+			}
+
+			for _, path := range []string{"/leaderboard?limit=5000", "/leaderboard?offset=-1"} {
+				if response := serve(path); response.Code != http.StatusBadRequest {
+					t.Errorf("GET %s returned %v want %v", path, response.Code, http.StatusBadRequest)
+				}
+			}
+		})
+	}
+
+	t.Run("unregistered player has no rank", func(t *testing.T) {
+		server := NewPlayerServer(indexed)
+		server.Start()
+		request, _ := http.NewRequest(http.MethodGet, "/user/Mallory/rank", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		if response.Code != http.StatusNotFound {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusNotFound)
+		}
+	})
+}
+
+// benchmarkPlayers is how many players the rank benchmarks are run against.
+const benchmarkPlayers = 1_000_000
+
+func newBenchmarkStore(b *testing.B) *InMemoryPlayerStore {
+	b.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	store := NewInMemoryPlayerStore()
+	for i := range benchmarkPlayers {
+		// Few distinct scores so there are plenty of ties
+		store.users.put(&User{Name: fmt.Sprintf("player-%d", i), Wins: rng.IntN(1000)})
+	}
+	b.ResetTimer()
+	return store
+}
+
+func BenchmarkInMemoryPlayerStore_GetRank(b *testing.B) {
+	store := newBenchmarkStore(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		store.GetRank(ctx, fmt.Sprintf("player-%d", i%benchmarkPlayers))
+	}
+}
+
+func BenchmarkInMemoryPlayerStore_GetLeaderboard(b *testing.B) {
+	store := newBenchmarkStore(b)
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		store.GetLeaderboard(ctx, (i*7919)%benchmarkPlayers, defaultLeaderboardLimit)
+	}
+}
+
+func BenchmarkInMemoryPlayerStore_RecordWin(b *testing.B) {
+	store := newBenchmarkStore(b)
+	for i := 0; i < b.N; i++ {
+		store.RecordWin(fmt.Sprintf("player-%d", i%benchmarkPlayers))
+	}
+}
+
+// BenchmarkSortedLeague_GetRank is the cost of ranking a player without an index.
+func BenchmarkSortedLeague_GetRank(b *testing.B) {
+	store := newBenchmarkStore(b)
+	ranked := sortedLeague{AdaptPlayerStore(store)}
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		ranked.GetRank(ctx, fmt.Sprintf("player-%d", i%benchmarkPlayers))
+	}
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitKey picks the bucket a request is counted against.
+type RateLimitKey func(r *http.Request) string
+
+// KeyByClientIP counts requests per client IP. X-Forwarded-For isn't trusted,
+// put the limiter behind a proxy that rewrites RemoteAddr if there is one.
+func KeyByClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByAPIKey counts requests per authenticated principal, falling back to the
+// client IP when the server has no Authenticator. Requests are only limited once
+// authenticated, so forged credentials can't create buckets.
+func KeyByAPIKey(r *http.Request) string {
+	if principal, ok := PrincipalFromContext(r.Context()); ok {
+		return "principal:" + principal.Subject
+	}
+	return "ip:" + KeyByClientIP(r)
+}
+
+// KeyByPlayer counts requests per player being changed. Requests are only
+// limited once authorized, so others can't use up a player's bucket.
+func KeyByPlayer(r *http.Request) string {
+	return r.PathValue("name")
+}
+
+// RateLimiter is a token bucket per key: each bucket holds up to burst tokens,
+// refills at rate tokens per second and every request takes one.
+// Buckets that have refilled completely are the same as new ones and are evicted.
+// At most maxBuckets are held, past that the least recently used bucket is
+// evicted, so a client sending many keys can't grow the limiter without bound.
+type RateLimiter struct {
+	rate       float64
+	burst      float64
+	key        RateLimitKey
+	maxBuckets int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	order   *list.List // buckets least recently used first
+	// now is the limiter's clock, replaced in tests
+	now func() time.Time
+}
+
+// tokenBucket is the state of one key.
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	elem   *list.Element
+}
+
+// NewRateLimiter creates a RateLimiter allowing rate requests per second per key,
+// with bursts of up to burst requests, holding at most maxBuckets keys.
+// It panics if rate, burst or maxBuckets isn't positive.
+func NewRateLimiter(rate float64, burst, maxBuckets int, key RateLimitKey) *RateLimiter {
+	if !(rate > 0) || math.IsInf(rate, 1) || burst < 1 {
+		panic(fmt.Sprintf("server: invalid rate limit of %v per second with bursts of %d", rate, burst))
+	}
+	if maxBuckets < 1 {
+		panic(fmt.Sprintf("server: invalid rate limit of %d buckets", maxBuckets))
+	}
+	return &RateLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		key:        key,
+		maxBuckets: maxBuckets,
+		buckets:    make(map[string]*tokenBucket),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Allow takes a token for the request. If there are none it returns false and
+// how long until one is available.
+func (l *RateLimiter) Allow(r *http.Request) (bool, time.Duration) {
+	return l.allow(l.key(r))
+}
+
+func (l *RateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if ok {
+		l.order.MoveToBack(b.elem)
+	} else {
+		b = l.add(key, now)
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// refund gives back a token taken for key, for a request another limiter refused.
+func (l *RateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = math.Min(l.burst, b.tokens+1)
+	}
+}
+
+// refillTime is how long an empty bucket takes to fill up.
+func (l *RateLimiter) refillTime() time.Duration {
+	return time.Duration(l.burst / l.rate * float64(time.Second))
+}
+
+// sweep evicts buckets that have refilled completely. Buckets are ordered by
+// when they were last used, so it stops at the first that hasn't refilled.
+// Callers must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	idle := l.refillTime()
+	for l.order.Len() > 0 {
+		b := l.order.Front().Value.(*tokenBucket)
+		if now.Sub(b.last) < idle {
+			return
+		}
+		l.remove(b)
+	}
+}
+
+// add creates a full bucket for key, evicting the least recently used buckets
+// over the bound. Callers must hold l.mu.
+func (l *RateLimiter) add(key string, now time.Time) *tokenBucket {
+	b := &tokenBucket{key: key, tokens: l.burst, last: now}
+	b.elem = l.order.PushBack(b)
+	l.buckets[key] = b
+	for l.order.Len() > l.maxBuckets {
+		l.remove(l.order.Front().Value.(*tokenBucket))
+	}
+	return b
+}
+
+// remove drops a bucket. Callers must hold l.mu.
+func (l *RateLimiter) remove(b *tokenBucket) {
+	l.order.Remove(b.elem)
+	delete(l.buckets, b.key)
+}
+
+// size returns the number of buckets held.
+func (l *RateLimiter) size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// admit authorizes a request to change the named player, then rate limits it so
+// limiters can key on who sent it. It returns r carrying the authenticated principal.
+func (p *PlayerServer) admit(w http.ResponseWriter, r *http.Request, player string) (*http.Request, bool) {
+	principal, ok := p.authenticate(w, r, player)
+	if !ok {
+		return r, false
+	}
+	if p.Auth != nil {
+		r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+	}
+	return r, p.rateLimit(w, r)
+}
+
+// rateLimit checks every limiter allows the request, writing a 429 with
+// Retry-After and returning false if one doesn't. Tokens taken from the
+// limiters before the one that refused are given back.
+func (p *PlayerServer) rateLimit(w http.ResponseWriter, r *http.Request) bool {
+	keys := make([]string, 0, len(p.RateLimits))
+	for _, limiter := range p.RateLimits {
+		key := limiter.key(r)
+		ok, wait := limiter.allow(key)
+		if ok {
+			keys = append(keys, key)
+			continue
+		}
+		for j, key := range keys {
+			p.RateLimits[j].refund(key)
+		}
+		seconds := int(math.Ceil(wait.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+		http.Error(w, fmt.Sprintf("too many requests, retry in %s", wait.Round(time.Millisecond)), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	t.Run("allows a burst then refills at the rate", func(t *testing.T) {
+		limiter := NewRateLimiter(2, 3, 1000, KeyByPlayer)
+		limiter.now = clock
+
+		for i := 0; i < 3; i++ {
+			if ok, _ := limiter.allow("Alice"); !ok {
+				t.Fatalf("request %d of the burst was refused", i+1)
+			}
+		}
+
+		ok, wait := limiter.allow("Alice")
+		if ok {
+			t.Fatal("expected request after the burst to be refused")
+		}
+		if wait != 500*time.Millisecond {
+			t.Errorf("got wait %s want %s", wait, 500*time.Millisecond)
+		}
+
+		now = now.Add(500 * time.Millisecond)
+		if ok, _ := limiter.allow("Alice"); !ok {
+			t.Error("expected a token to have refilled")
+		}
+	})
+
+	t.Run("keys have separate buckets", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 1, 1000, KeyByPlayer)
+		limiter.now = clock
+
+		limiter.allow("Alice")
+		if ok, _ := limiter.allow("Bob"); !ok {
+			t.Error("expected Bob not to be limited by Alice's requests")
+		}
+	})
+
+	t.Run("idle buckets are evicted", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 5, 1000, KeyByPlayer)
+		limiter.now = clock
+
+		for i := 0; i < 100; i++ {
+			limiter.allow(fmt.Sprintf("player-%d", i))
+		}
+		if limiter.size() != 100 {
+			t.Fatalf("expected 100 buckets, got %d", limiter.size())
+		}
+
+		now = now.Add(5 * time.Second)
+		limiter.allow("Alice")
+		if limiter.size() != 1 {
+			t.Errorf("expected refilled buckets to be evicted, got %d left", limiter.size())
+		}
+	})
+
+	t.Run("the least recently used buckets are evicted over the bound", func(t *testing.T) {
+		limiter := NewRateLimiter(1, 1, 3, KeyByPlayer)
+		limiter.now = clock
+
+		limiter.allow("Alice")
+		limiter.allow("Bob")
+		limiter.allow("Carol")
+		limiter.allow("Alice")
+		for i := 0; i < 100; i++ {
+			limiter.allow(fmt.Sprintf("player-%d", i))
+			if i == 0 {
+				// Bob was used least recently, Alice's bucket is kept
+				if ok, _ := limiter.allow("Alice"); ok {
+					t.Error("expected Alice to still be limited")
+				}
+			}
+		}
+		if limiter.size() != 3 {
+			t.Errorf("expected 3 buckets, got %d", limiter.size())
+		}
+	})
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+	request.RemoteAddr = "203.0.113.7:51234"
+	request.SetPathValue("name", "Alice")
+
+	if got := KeyByClientIP(request); got != "203.0.113.7" {
+		t.Errorf("KeyByClientIP got %q", got)
+	}
+	if got := KeyByPlayer(request); got != "Alice" {
+		t.Errorf("KeyByPlayer got %q", got)
+	}
+	request.Header.Set(APIKeyHeader, "k1")
+	if got := KeyByAPIKey(request); got != "ip:203.0.113.7" {
+		t.Errorf("KeyByAPIKey of an unauthenticated request got %q", got)
+	}
+	request = request.WithContext(context.WithValue(request.Context(), principalKey{}, Principal{Subject: "league"}))
+	if got := KeyByAPIKey(request); got != "principal:league" {
+		t.Errorf("KeyByAPIKey got %q", got)
+	}
+}
+
+func TestNewRateLimiter_Invalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		rate       float64
+		burst      int
+		maxBuckets int
+	}{
+		{"zero rate", 0, 1, 1},
+		{"negative rate", -1, 1, 1},
+		{"NaN rate", math.NaN(), 1, 1},
+		{"infinite rate", math.Inf(1), 1, 1},
+		{"zero burst", 1, 0, 1},
+		{"zero buckets", 1, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected NewRateLimiter(%v, %d, %d) to panic", tt.rate, tt.burst, tt.maxBuckets)
+				}
+			}()
+			NewRateLimiter(tt.rate, tt.burst, tt.maxBuckets, KeyByPlayer)
+		})
+	}
+}
+
+func TestPlayerServer_RateLimit(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(0.5, 2, 1000, KeyByClientIP)
+	limiter.now = func() time.Time { return now }
+
+	server, store := setupTestServer(t)
+	server.RateLimits = []*RateLimiter{limiter}
+	server.Start()
+
+	put := func() *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPut, "/user/Alice/score", nil)
+		request.RemoteAddr = "203.0.113.7:51234"
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	put()
+	put()
+	response := put()
+	if response.Code != http.StatusTooManyRequests {
+		t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusTooManyRequests)
+	}
+	if got := response.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("got Retry-After %q want %q", got, "2")
+	}
+	if len(store.recordWinCalls) != 2 {
+		t.Errorf("expected the limited request not to record a win, got %v", store.recordWinCalls)
+	}
+
+	// GET isn't limited
+	request, _ := http.NewRequest(http.MethodGet, "/user/Alice/score", nil)
+	request.RemoteAddr = "203.0.113.7:51234"
+	getResponse := httptest.NewRecorder()
+	server.Handler.ServeHTTP(getResponse, request)
+	if getResponse.Code != http.StatusOK {
+		t.Errorf("GET returned wrong status code: got %v want %v", getResponse.Code, http.StatusOK)
+	}
+
+	now = now.Add(2 * time.Second)
+	if response := put(); response.Code != http.StatusAccepted {
+		t.Errorf("handler returned wrong status code after refill: got %v want %v", response.Code, http.StatusAccepted)
+	}
+}
+
+func TestPlayerServer_RateLimitAfterAuth(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	newLimiter := func(rate float64, burst int, key RateLimitKey) *RateLimiter {
+		limiter := NewRateLimiter(rate, burst, 1000, key)
+		limiter.now = func() time.Time { return now }
+		return limiter
+	}
+	put := func(server *PlayerServer, player, apiKey string) int {
+		request, _ := http.NewRequest(http.MethodPut, "/user/"+player+"/score", nil)
+		request.RemoteAddr = "203.0.113.7:51234"
+		if apiKey != "" {
+			request.Header.Set(APIKeyHeader, apiKey)
+		}
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response.Code
+	}
+	auth := NewAPIKeyAuthenticator(map[string]Principal{
+		"alice-key": {Subject: "alice-client", Players: []string{"Alice"}},
+	})
+
+	t.Run("unauthenticated requests don't use up a player's bucket", func(t *testing.T) {
+		server, _ := setupTestServer(t)
+		server.Auth = auth
+		server.RateLimits = []*RateLimiter{newLimiter(1, 1, KeyByPlayer)}
+		server.Start()
+
+		for range 5 {
+			if code := put(server, "Alice", "forged"); code != http.StatusUnauthorized {
+				t.Fatalf("got status %d want %d", code, http.StatusUnauthorized)
+			}
+		}
+		if code := put(server, "Alice", "alice-key"); code != http.StatusAccepted {
+			t.Errorf("expected Alice's own request to be allowed, got %d", code)
+		}
+	})
+
+	t.Run("forged keys don't create buckets", func(t *testing.T) {
+		limiter := newLimiter(1, 1, KeyByAPIKey)
+		server, _ := setupTestServer(t)
+		server.Auth = auth
+		server.RateLimits = []*RateLimiter{limiter}
+		server.Start()
+
+		for i := range 100 {
+			put(server, "Alice", fmt.Sprintf("forged-%d", i))
+		}
+		if limiter.size() != 0 {
+			t.Errorf("expected no buckets for forged keys, got %d", limiter.size())
+		}
+		put(server, "Alice", "alice-key")
+		if code := put(server, "Alice", "alice-key"); code != http.StatusTooManyRequests {
+			t.Errorf("expected the principal to be limited, got %d", code)
+		}
+	})
+
+	t.Run("a refused request gives back the tokens it took", func(t *testing.T) {
+		server, store := setupTestServer(t)
+		server.RateLimits = []*RateLimiter{newLimiter(1, 2, KeyByClientIP), newLimiter(1, 1, KeyByPlayer)}
+		server.Start()
+
+		put(server, "Alice", "")
+		if code := put(server, "Alice", ""); code != http.StatusTooManyRequests {
+			t.Fatalf("expected Alice's second win to be limited, got %d", code)
+		}
+		if code := put(server, "Bob", ""); code != http.StatusAccepted {
+			t.Errorf("expected the client to have a token left for Bob, got %d", code)
+		}
+		if len(store.recordWinCalls) != 2 {
+			t.Errorf("expected 2 wins to be recorded, got %v", store.recordWinCalls)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"games/rating"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Rating systems the rating league can be sorted by.
+const (
+	systemGlicko2 = "glicko2"
+	systemElo     = "elo"
+)
+
+// getRating writes the named player's ratings. Players who haven't played a match
+// have the ratings of a new player.
+func (p *PlayerServer) getRating(w http.ResponseWriter, r *http.Request) {
+	playerName := r.PathValue("name")
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	rated, ok := p.Ratings.Get(playerName)
+	if !ok {
+		rated = rating.PlayerRating{Name: playerName, Elo: rating.DefaultRating, Glicko2: rating.NewRating()}
+	}
+	writeJSON(w, rated)
+}
+
+// getRatingLeague writes every rated player ranked by rating, highest first with ties
+// ordered by name. The system query parameter picks the rating, glicko2 (the default) or elo.
+func (p *PlayerServer) getRatingLeague(w http.ResponseWriter, r *http.Request) {
+	system := r.URL.Query().Get("system")
+	if system == "" {
+		system = systemGlicko2
+	}
+	var score func(rating.PlayerRating) float64
+	switch system {
+	case systemGlicko2:
+		score = func(pr rating.PlayerRating) float64 { return pr.Glicko2.Rating }
+	case systemElo:
+		score = func(pr rating.PlayerRating) float64 { return pr.Elo }
+	default:
+		http.Error(w, fmt.Sprintf("unknown rating system %q, want %s or %s", system, systemGlicko2, systemElo), http.StatusBadRequest)
+		return
+	}
+
+	league := p.Ratings.League()
+	slices.SortFunc(league, func(a, b rating.PlayerRating) int {
+		if c := cmp.Compare(score(b), score(a)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	writeJSON(w, league)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"games/rating"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlayerServer_Ratings(t *testing.T) {
+	store := NewInMemoryPlayerStore()
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if _, err := store.CreateUser(User{Name: name}); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+	}
+	server := NewPlayerServer(store)
+	// Glicko-2 ratings change when the period ends, keep it short
+	server.Ratings = rating.NewTable(rating.Config{Period: 50 * time.Millisecond})
+	server.Start()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	for _, body := range []string{
+		`{"winner":"Alice","losers":["Bob"]}`,
+		`{"winner":"Alice","losers":["Bob"]}`,
+		`{"winner":"Bob","losers":["Alice"]}`,
+	} {
+		if response := serve(http.MethodPost, "/matches", body); response.Code != http.StatusCreated {
+			t.Fatalf("unexpected status recording match: %v", response.Code)
+		}
+	}
+	_, end := server.Ratings.CurrentPeriod()
+	time.Sleep(time.Until(end))
+
+	t.Run("GET rating", func(t *testing.T) {
+		response := serve(http.MethodGet, "/user/Alice/rating", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		var got rating.PlayerRating
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse rating %q: %v", response.Body.String(), err)
+		}
+		if got.Name != "Alice" || got.Matches != 3 || got.Elo <= rating.DefaultRating || got.Glicko2.Rating <= rating.DefaultRating {
+			t.Errorf("expected Alice rated above a new player on 3 matches, got %+v", got)
+		}
+	})
+
+	t.Run("GET rating of a player who hasn't played", func(t *testing.T) {
+		response := serve(http.MethodGet, "/user/Carol/rating", "")
+		var got rating.PlayerRating
+		json.NewDecoder(response.Body).Decode(&got)
+		want := rating.PlayerRating{Name: "Carol", Elo: rating.DefaultRating, Glicko2: rating.NewRating()}
+		if got != want {
+			t.Errorf("got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("GET rating league", func(t *testing.T) {
+		for _, system := range []string{"", "?system=glicko2", "?system=elo"} {
+			response := serve(http.MethodGet, "/league/ratings"+system, "")
+			var league []rating.PlayerRating
+			if err := json.NewDecoder(response.Body).Decode(&league); err != nil {
+				t.Fatalf("unable to parse league %q: %v", response.Body.String(), err)
+			}
+			if len(league) != 2 || league[0].Name != "Alice" || league[1].Name != "Bob" {
+				t.Errorf("expected Alice ahead of Bob by %q, got %+v", system, league)
+			}
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			path           string
+			expectedStatus int
+		}{
+			{"unknown player", "/user/Mallory/rating", http.StatusNotFound},
+			{"unknown rating system", "/league/ratings?system=trueskill", http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if response := serve(http.MethodGet, tt.path, ""); response.Code != tt.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", response.Code, tt.expectedStatus)
+				}
+			})
+		}
+	})
+}
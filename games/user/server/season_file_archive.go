@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSystemSeasonArchive is a SeasonArchive that persists seasons to a JSON file,
+// replacing it atomically when a season is archived.
+type FileSystemSeasonArchive struct {
+	mu   sync.RWMutex
+	path string
+	list seasonList
+}
+
+// NewFileSystemSeasonArchive opens the archive at path. A missing file is created
+// with its first season starting now.
+func NewFileSystemSeasonArchive(path string) (*FileSystemSeasonArchive, error) {
+	archive := &FileSystemSeasonArchive{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		archive.list.StartedAt = time.Now()
+		if err := archive.save(); err != nil {
+			return nil, err
+		}
+		return archive, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading season archive: %w", err)
+	}
+	if err := json.Unmarshal(data, &archive.list); err != nil {
+		return nil, fmt.Errorf("decoding season archive: %w", err)
+	}
+	return archive, nil
+}
+
+// CurrentSeason returns the season being played.
+func (f *FileSystemSeasonArchive) CurrentSeason(ctx context.Context) (Season, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.list.current(), nil
+}
+
+// Seasons returns every closed season without their leagues.
+func (f *FileSystemSeasonArchive) Seasons(ctx context.Context) ([]Season, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.list.seasons(), nil
+}
+
+// Season returns a closed season with its league.
+func (f *FileSystemSeasonArchive) Season(ctx context.Context, id int) (Season, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.list.season(id)
+}
+
+// Archive closes the current season and saves the archive to disk.
+// The season stays open if the save fails.
+func (f *FileSystemSeasonArchive) Archive(ctx context.Context, season Season) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pending := f.list.Pending
+	if err := f.list.archive(season); err != nil {
+		return err
+	}
+	if err := f.save(); err != nil {
+		f.list.Closed = f.list.Closed[:len(f.list.Closed)-1]
+		f.list.Pending = pending
+		return err
+	}
+	return nil
+}
+
+// PendingReset returns the closed season whose scores are yet to be reset.
+func (f *FileSystemSeasonArchive) PendingReset(ctx context.Context) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.list.Pending, nil
+}
+
+// FinishReset records that the closed season's scores were reset and saves the
+// archive to disk. The reset stays pending if the save fails.
+func (f *FileSystemSeasonArchive) FinishReset(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pending := f.list.Pending
+	f.list.finishReset(id)
+	if f.list.Pending == pending {
+		return nil
+	}
+	if err := f.save(); err != nil {
+		f.list.Pending = pending
+		return err
+	}
+	return nil
+}
+
+// save writes the archive to disk. Callers must hold f.mu.
+func (f *FileSystemSeasonArchive) save() error {
+	data, err := json.Marshal(f.list)
+	if err != nil {
+		return fmt.Errorf("encoding season archive: %w", err)
+	}
+	return writeFileAtomic(f.path, data)
+}
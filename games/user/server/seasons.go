@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSeasonNotFound is returned for a season that doesn't exist.
+	ErrSeasonNotFound = errors.New("season not found")
+	// ErrSeasonExists is returned when archiving a season that is already archived.
+	ErrSeasonExists = errors.New("season already archived")
+	// ErrSeasonsUnsupported is returned when closing a season of a store that can't reset scores.
+	ErrSeasonsUnsupported = errors.New("store does not support seasons")
+)
+
+// Season is a season of play. Seasons are numbered from 1, the current season has no
+// EndedAt. A closed season's league is archived when it closes and never changes.
+type Season struct {
+	ID        int        `json:"id"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+	League    []Player   `json:"league,omitempty"`
+}
+
+// SeasonalPlayerStore is implemented by stores whose scores can be reset for a new season.
+// Stores record the season each reset closed, so a season archived by a close
+// that failed before its scores were reset can have them reset later.
+type SeasonalPlayerStore interface {
+	// ResetScores calls archive with every player's wins and, if it succeeds, resets
+	// every score to 0 for the end of season. No win can be recorded in between.
+	ResetScores(ctx context.Context, season int, archive func(league []Player) error) error
+	// LastReset returns the season the last reset closed, 0 before the first.
+	LastReset(ctx context.Context) (int, error)
+}
+
+// SeasonArchive keeps the leagues of closed seasons.
+type SeasonArchive interface {
+	// CurrentSeason returns the season being played, which started when the last one
+	// closed or, before any has, when the archive was created.
+	CurrentSeason(ctx context.Context) (Season, error)
+	// Seasons returns every closed season, oldest first, without their leagues.
+	Seasons(ctx context.Context) ([]Season, error)
+	// Season returns a closed season with its league.
+	Season(ctx context.Context, id int) (Season, error)
+	// Archive closes the current season, which must be the given one, and
+	// records that its scores are yet to be reset.
+	Archive(ctx context.Context, season Season) error
+	// PendingReset returns the closed season whose scores are yet to be reset,
+	// 0 if there is none.
+	PendingReset(ctx context.Context) (int, error)
+	// FinishReset records that the scores of the closed season were reset.
+	FinishReset(ctx context.Context, id int) error
+}
+
+// seasonList holds the closed seasons of an archive, oldest first.
+// It does no locking, the owning archive guards it.
+type seasonList struct {
+	StartedAt time.Time `json:"startedAt"`
+	Closed    []Season  `json:"seasons"`
+	// Pending is the closed season whose scores are yet to be reset, 0 if none
+	Pending int `json:"pendingReset,omitempty"`
+}
+
+func (l *seasonList) current() Season {
+	if len(l.Closed) == 0 {
+		return Season{ID: 1, StartedAt: l.StartedAt}
+	}
+	last := l.Closed[len(l.Closed)-1]
+	return Season{ID: last.ID + 1, StartedAt: *last.EndedAt}
+}
+
+func (l *seasonList) seasons() []Season {
+	seasons := make([]Season, len(l.Closed))
+	for i, s := range l.Closed {
+		s.League = nil
+		seasons[i] = s
+	}
+	return seasons
+}
+
+func (l *seasonList) season(id int) (Season, error) {
+	if id < 1 || id > len(l.Closed) {
+		return Season{}, ErrSeasonNotFound
+	}
+	season := l.Closed[id-1]
+	season.League = slices.Clone(season.League)
+	return season, nil
+}
+
+// archive appends season, which must be the current one and have ended.
+func (l *seasonList) archive(season Season) error {
+	if season.ID != l.current().ID {
+		return fmt.Errorf("%w: season %d, the current season is %d", ErrSeasonExists, season.ID, l.current().ID)
+	}
+	if season.EndedAt == nil {
+		return fmt.Errorf("season %d has not ended", season.ID)
+	}
+	season.League = slices.Clone(season.League)
+	l.Closed = append(l.Closed, season)
+	l.Pending = season.ID
+	return nil
+}
+
+// finishReset records that the closed season's scores were reset.
+func (l *seasonList) finishReset(id int) {
+	if l.Pending == id {
+		l.Pending = 0
+	}
+}
+
+// InMemorySeasonArchive is a SeasonArchive that keeps seasons in memory.
+type InMemorySeasonArchive struct {
+	mu   sync.RWMutex
+	list seasonList
+}
+
+// NewInMemorySeasonArchive creates an archive whose first season starts now.
+func NewInMemorySeasonArchive() *InMemorySeasonArchive {
+	return &InMemorySeasonArchive{list: seasonList{StartedAt: time.Now()}}
+}
+
+// CurrentSeason returns the season being played.
+func (i *InMemorySeasonArchive) CurrentSeason(ctx context.Context) (Season, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.list.current(), nil
+}
+
+// Seasons returns every closed season without their leagues.
+func (i *InMemorySeasonArchive) Seasons(ctx context.Context) ([]Season, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.list.seasons(), nil
+}
+
+// Season returns a closed season with its league.
+func (i *InMemorySeasonArchive) Season(ctx context.Context, id int) (Season, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.list.season(id)
+}
+
+// Archive closes the current season.
+func (i *InMemorySeasonArchive) Archive(ctx context.Context, season Season) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.list.archive(season)
+}
+
+// PendingReset returns the closed season whose scores are yet to be reset.
+func (i *InMemorySeasonArchive) PendingReset(ctx context.Context) (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.list.Pending, nil
+}
+
+// FinishReset records that the closed season's scores were reset.
+func (i *InMemorySeasonArchive) FinishReset(ctx context.Context, id int) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.list.finishReset(id)
+	return nil
+}
+
+// CloseSeason ends the current season, archiving every player's wins in p.Seasons
+// and starting the next season with every score at 0. If the last close archived
+// its season but failed to reset the scores, the scores are reset and that
+// season is returned instead, so retrying a failed close doesn't close two seasons.
+func (p *PlayerServer) CloseSeason(ctx context.Context) (Season, error) {
+	store, ok := storeAs[SeasonalPlayerStore](p)
+	if !ok {
+		return Season{}, ErrSeasonsUnsupported
+	}
+
+	p.seasonMu.Lock()
+	defer p.seasonMu.Unlock()
+	current, err := p.Seasons.CurrentSeason(ctx)
+	if err != nil {
+		return Season{}, err
+	}
+
+	// Wins wait for the reset to be published, so a 0 is never published after a later win
+	unlock := p.lockAllPlayers()
+	defer unlock()
+	if closed, finished, err := p.finishReset(ctx, store); finished || err != nil {
+		return closed, err
+	}
+	closed := current
+	err = store.ResetScores(ctx, current.ID, func(league []Player) error {
+		SortLeague(league)
+		ended := time.Now()
+		closed.EndedAt = &ended
+		closed.League = league
+		return p.Seasons.Archive(ctx, closed)
+	})
+	if err != nil {
+		return Season{}, err
+	}
+	p.publishReset(closed.League)
+	p.recordReset(ctx, closed.ID)
+	return closed, nil
+}
+
+// ResumeSeason resets the scores of the last closed season if the archive says
+// they weren't, such as after a crash between archiving the season and
+// resetting them. Call it after Start() and before serving.
+func (p *PlayerServer) ResumeSeason(ctx context.Context) error {
+	store, ok := storeAs[SeasonalPlayerStore](p)
+	if !ok {
+		return nil
+	}
+
+	p.seasonMu.Lock()
+	defer p.seasonMu.Unlock()
+	unlock := p.lockAllPlayers()
+	defer unlock()
+	closed, finished, err := p.finishReset(ctx, store)
+	if finished {
+		log.Printf("reset the scores of season %d, which was archived but not reset", closed.ID)
+	}
+	return err
+}
+
+// finishReset resets the scores of the season the archive has a reset pending
+// for if the store hasn't, reporting whether it had to. The season's league is
+// already archived. Callers must hold p.seasonMu and every player's lock.
+func (p *PlayerServer) finishReset(ctx context.Context, store SeasonalPlayerStore) (Season, bool, error) {
+	pending, err := p.Seasons.PendingReset(ctx)
+	if err != nil || pending == 0 {
+		return Season{}, false, err
+	}
+	last, err := store.LastReset(ctx)
+	if err != nil {
+		return Season{}, false, err
+	}
+	if last >= pending {
+		// The scores were reset, only recording it failed
+		return Season{}, false, p.Seasons.FinishReset(ctx, pending)
+	}
+	closed, err := p.Seasons.Season(ctx, pending)
+	if err != nil {
+		return Season{}, false, err
+	}
+	err = store.ResetScores(ctx, closed.ID, func([]Player) error { return nil })
+	if err != nil {
+		return Season{}, false, err
+	}
+	p.publishReset(closed.League)
+	p.recordReset(ctx, closed.ID)
+	return closed, true, nil
+}
+
+// recordReset records in the archive that the closed season's scores were reset.
+// They already are, so a failure is only logged, the next close or resume
+// records it again.
+func (p *PlayerServer) recordReset(ctx context.Context, id int) {
+	if err := p.Seasons.FinishReset(ctx, id); err != nil {
+		log.Printf("recording the reset of season %d: %v", id, err)
+	}
+}
+
+// publishReset publishes the 0 score of every player who had wins in a closed season's league.
+func (p *PlayerServer) publishReset(league []Player) {
+	for _, player := range league {
+		if player.Wins > 0 {
+			p.publishScore(player.Name, 0)
+		}
+	}
+}
+
+// closeSeason closes the current season, it needs a principal allowed to change any player.
+func (p *PlayerServer) closeSeason(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, AnyPlayer) {
+		return
+	}
+	p.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		season, err := p.CloseSeason(r.Context())
+		if errors.Is(err, ErrSeasonsUnsupported) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/seasons/%d", season.ID))
+		w.Header().Set("Content-Type", mediaJSON)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(season)
+	})
+}
+
+// listSeasons writes every closed season, oldest first, followed by the current one.
+func (p *PlayerServer) listSeasons(w http.ResponseWriter, r *http.Request) {
+	seasons, err := p.Seasons.Seasons(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	current, err := p.Seasons.CurrentSeason(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, append(seasons, current))
+}
+
+// getSeasonLeague writes the league of a season, the live league for the current one.
+func (p *PlayerServer) getSeasonLeague(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, userTypes...)
+	if !ok {
+		notAcceptable(w, userTypes...)
+		return
+	}
+
+	season, current, err := p.season(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeSeasonError(w, err)
+		return
+	}
+	if current {
+		p.getLeague(w, r)
+		return
+	}
+	writeLeague(w, mediaType, season.League)
+}
+
+// getSeasonScore writes the named player's wins in a closed season. Players
+// who didn't play in it have a score of 0.
+func (p *PlayerServer) getSeasonScore(w http.ResponseWriter, mediaType string, season Season, name string) {
+	score := 0
+	if i := slices.IndexFunc(season.League, func(player Player) bool { return player.Name == name }); i >= 0 {
+		score = season.League[i].Wins
+	}
+	writeScore(w, mediaType, name, score)
+}
+
+// season returns the season with the given ID, which must be a season number.
+// The bool is true for the current season, which isn't archived yet.
+func (p *PlayerServer) season(ctx context.Context, id string) (Season, bool, error) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return Season{}, false, fmt.Errorf("%w: %q is not a season number", ErrSeasonNotFound, id)
+	}
+	current, err := p.Seasons.CurrentSeason(ctx)
+	if err != nil {
+		return Season{}, false, err
+	}
+	if n == current.ID {
+		return current, true, nil
+	}
+	season, err := p.Seasons.Season(ctx, n)
+	return season, false, err
+}
+
+// writeSeasonError writes a 404 for an unknown season and the store status otherwise.
+func writeSeasonError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrSeasonNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeStoreError(w, err)
+}
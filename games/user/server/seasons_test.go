@@ -0,0 +1,333 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// FailingSeasonArchive is an InMemorySeasonArchive that can't archive seasons.
+type FailingSeasonArchive struct {
+	*InMemorySeasonArchive
+}
+
+func (FailingSeasonArchive) Archive(ctx context.Context, season Season) error {
+	return ErrStoreUnavailable
+}
+
+func TestPlayerServer_Seasons(t *testing.T) {
+	newServer := func(t *testing.T, store *InMemoryPlayerStore) *PlayerServer {
+		t.Helper()
+		for _, name := range []string{"Alice", "Bob"} {
+			if _, err := store.CreateUser(User{Name: name}); err != nil {
+				t.Fatalf("unexpected error creating user: %v", err)
+			}
+		}
+		store.RecordWin("Alice")
+		store.RecordWin("Alice")
+		store.RecordWin("Bob")
+		server := NewPlayerServer(store)
+		server.Start()
+		return server
+	}
+
+	serve := func(server *PlayerServer, method, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("closing a season archives the league and resets scores", func(t *testing.T) {
+		store := NewInMemoryPlayerStore()
+		server := newServer(t, store)
+
+		response := serve(server, http.MethodPost, "/seasons")
+		if response.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v, body %q", response.Code, http.StatusCreated, response.Body.String())
+		}
+		var closed Season
+		json.NewDecoder(response.Body).Decode(&closed)
+		wantLeague := []Player{{"Alice", 2}, {"Bob", 1}}
+		if closed.ID != 1 || closed.EndedAt == nil || !reflect.DeepEqual(closed.League, wantLeague) {
+			t.Errorf("got closed season %+v want season 1 with league %v", closed, wantLeague)
+		}
+		if got := response.Header().Get("Location"); got != "/seasons/1" {
+			t.Errorf("got Location %q want %q", got, "/seasons/1")
+		}
+
+		if got := store.GetPlayerScore("Alice"); got != 0 {
+			t.Errorf("expected Alice's score to be reset, got %d", got)
+		}
+		if _, ok := store.GetUser("Alice"); !ok {
+			t.Error("expected Alice to stay registered")
+		}
+
+		response = serve(server, http.MethodGet, "/seasons")
+		var seasons []Season
+		json.NewDecoder(response.Body).Decode(&seasons)
+		if len(seasons) != 2 || seasons[0].ID != 1 || seasons[0].League != nil || seasons[1].ID != 2 || seasons[1].EndedAt != nil {
+			t.Errorf("expected closed season 1 without its league then current season 2, got %+v", seasons)
+		}
+		if !seasons[1].StartedAt.Equal(*seasons[0].EndedAt) {
+			t.Errorf("expected season 2 to start when season 1 ended, got %+v", seasons)
+		}
+
+		response = serve(server, http.MethodGet, "/seasons/1/league")
+		var league []Player
+		json.NewDecoder(response.Body).Decode(&league)
+		if !reflect.DeepEqual(league, wantLeague) {
+			t.Errorf("got season 1 league %v want %v", league, wantLeague)
+		}
+	})
+
+	t.Run("season query parameter", func(t *testing.T) {
+		server := newServer(t, NewInMemoryPlayerStore())
+		serve(server, http.MethodPost, "/seasons")
+		serve(server, http.MethodPut, "/user/Bob/score")
+
+		tests := []struct {
+			name           string
+			method         string
+			path           string
+			expectedStatus int
+			expectedBody   string
+		}{
+			{"archived score", http.MethodGet, "/user/Alice/score?season=1", http.StatusOK, "2"},
+			{"current score by season", http.MethodGet, "/user/Bob/score?season=2", http.StatusOK, "1"},
+			{"current score", http.MethodGet, "/user/Bob/score", http.StatusOK, "1"},
+			{"unknown season", http.MethodGet, "/user/Alice/score?season=7", http.StatusNotFound, ""},
+			{"season that isn't a number", http.MethodGet, "/user/Alice/score?season=spring", http.StatusNotFound, ""},
+			{"win in a closed season", http.MethodPut, "/user/Alice/score?season=1", http.StatusConflict, ""},
+			{"win in the current season", http.MethodPut, "/user/Alice/score?season=2", http.StatusAccepted, ""},
+			{"current season league", http.MethodGet, "/seasons/2/league", http.StatusOK, ""},
+			{"unknown season league", http.MethodGet, "/seasons/9/league", http.StatusNotFound, ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response := serve(server, tt.method, tt.path)
+				if response.Code != tt.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", response.Code, tt.expectedStatus)
+				}
+				if tt.expectedBody != "" && response.Body.String() != tt.expectedBody {
+					t.Errorf("handler returned unexpected body: got %q want %q", response.Body.String(), tt.expectedBody)
+				}
+			})
+		}
+	})
+
+	t.Run("closing needs an admin", func(t *testing.T) {
+		server := newServer(t, NewInMemoryPlayerStore())
+		server.Auth = NewAPIKeyAuthenticator(map[string]Principal{
+			"alice-key": {Subject: "alice-client", Players: []string{"Alice"}},
+		})
+		server.Start()
+
+		request, _ := http.NewRequest(http.MethodPost, "/seasons", nil)
+		request.Header.Set(APIKeyHeader, "alice-key")
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		if response.Code != http.StatusForbidden {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("scores are kept if archiving fails", func(t *testing.T) {
+		store := NewInMemoryPlayerStore()
+		server := newServer(t, store)
+		server.Seasons = FailingSeasonArchive{NewInMemorySeasonArchive()}
+		server.Start()
+
+		if response := serve(server, http.MethodPost, "/seasons"); response.Code != http.StatusServiceUnavailable {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusServiceUnavailable)
+		}
+		if got := store.GetPlayerScore("Alice"); got != 2 {
+			t.Errorf("expected Alice's score to be kept, got %d", got)
+		}
+	})
+
+	t.Run("store without seasons", func(t *testing.T) {
+		server, _ := setupTestServer(t)
+		if response := serve(server, http.MethodPost, "/seasons"); response.Code != http.StatusNotImplemented {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusNotImplemented)
+		}
+	})
+
+	t.Run("a season archived but not reset is finished, not closed again", func(t *testing.T) {
+		for _, resume := range []bool{false, true} {
+			store := NewInMemoryPlayerStore()
+			server := newServer(t, store)
+			ctx := context.Background()
+
+			// As if the process died between archiving season 1 and resetting the scores
+			ended := time.Now()
+			archived := Season{ID: 1, EndedAt: &ended, League: []Player{{"Alice", 2}, {"Bob", 1}}}
+			if err := server.Seasons.Archive(ctx, archived); err != nil {
+				t.Fatalf("unexpected error archiving season: %v", err)
+			}
+
+			if resume {
+				if err := server.ResumeSeason(ctx); err != nil {
+					t.Fatalf("unexpected error resuming season: %v", err)
+				}
+			} else {
+				closed, err := server.CloseSeason(ctx)
+				if err != nil || closed.ID != 1 {
+					t.Errorf("got season %+v, %v want the archived season 1", closed, err)
+				}
+			}
+			if got := store.GetPlayerScore("Alice"); got != 0 {
+				t.Errorf("expected Alice's score to be reset, got %d", got)
+			}
+			if seasons, _ := server.Seasons.Seasons(ctx); len(seasons) != 1 {
+				t.Errorf("expected only season 1 to be closed, got %+v", seasons)
+			}
+
+			store.RecordWin("Bob")
+			closed, err := server.CloseSeason(ctx)
+			if err != nil || closed.ID != 2 || !reflect.DeepEqual(closed.League, []Player{{"Bob", 1}, {"Alice", 0}}) {
+				t.Errorf("got season %+v, %v want season 2 with Bob's win", closed, err)
+			}
+		}
+	})
+
+	t.Run("a new store isn't reset for seasons closed before it", func(t *testing.T) {
+		ctx := context.Background()
+		first := newServer(t, NewInMemoryPlayerStore())
+		if _, err := first.CloseSeason(ctx); err != nil {
+			t.Fatalf("unexpected error closing season: %v", err)
+		}
+
+		// As if restarted with a memory store and the archive kept on disk
+		store := NewInMemoryPlayerStore()
+		server := newServer(t, store)
+		server.Seasons = first.Seasons
+		sub, _, _ := server.Events.Subscribe("Alice", 0)
+		defer server.Events.Unsubscribe(sub)
+
+		if err := server.ResumeSeason(ctx); err != nil {
+			t.Fatalf("unexpected error resuming season: %v", err)
+		}
+		if got := store.GetPlayerScore("Alice"); got != 2 {
+			t.Errorf("expected Alice's score to be kept, got %d", got)
+		}
+		select {
+		case event := <-sub.Events:
+			t.Errorf("expected no reset to be published, got %+v", event)
+		default:
+		}
+	})
+
+	t.Run("subscribers see the reset", func(t *testing.T) {
+		server := newServer(t, NewInMemoryPlayerStore())
+		sub, _, _ := server.Events.Subscribe("Alice", 0)
+		defer server.Events.Unsubscribe(sub)
+
+		if _, err := server.CloseSeason(context.Background()); err != nil {
+			t.Fatalf("unexpected error closing season: %v", err)
+		}
+		if event := <-sub.Events; event.Wins != 0 {
+			t.Errorf("expected an event resetting Alice's score, got %+v", event)
+		}
+	})
+}
+
+func TestFileSystemSeasonArchive(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "seasons.json")
+
+	archive, err := NewFileSystemSeasonArchive(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening archive: %v", err)
+	}
+	first, _ := archive.CurrentSeason(ctx)
+	if first.ID != 1 || first.StartedAt.IsZero() {
+		t.Fatalf("expected season 1 to have started, got %+v", first)
+	}
+
+	ended := first.StartedAt.Add(1)
+	first.EndedAt = &ended
+	first.League = []Player{{"Alice", 3}}
+	if err := archive.Archive(ctx, first); err != nil {
+		t.Fatalf("unexpected error archiving: %v", err)
+	}
+	if err := archive.Archive(ctx, first); !errors.Is(err, ErrSeasonExists) {
+		t.Errorf("expected archiving season 1 again to fail with ErrSeasonExists, got %v", err)
+	}
+
+	reopened, err := NewFileSystemSeasonArchive(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening archive: %v", err)
+	}
+	if pending, _ := reopened.PendingReset(ctx); pending != 1 {
+		t.Errorf("expected the reset of season 1 to be pending, got %d", pending)
+	}
+	if err := reopened.FinishReset(ctx, 1); err != nil {
+		t.Fatalf("unexpected error finishing reset: %v", err)
+	}
+	reopened, err = NewFileSystemSeasonArchive(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening archive: %v", err)
+	}
+	if pending, _ := reopened.PendingReset(ctx); pending != 0 {
+		t.Errorf("expected the finished reset to be saved, got pending season %d", pending)
+	}
+	got, err := reopened.Season(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error reading season 1: %v", err)
+	}
+	if !reflect.DeepEqual(got.League, first.League) || !got.EndedAt.Equal(ended) {
+		t.Errorf("got %+v want %+v", got, first)
+	}
+	if current, _ := reopened.CurrentSeason(ctx); current.ID != 2 || !current.StartedAt.Equal(ended) {
+		t.Errorf("expected season 2 to start when season 1 ended, got %+v", current)
+	}
+	if _, err := reopened.Season(ctx, 2); !errors.Is(err, ErrSeasonNotFound) {
+		t.Errorf("expected the current season not to be archived, got %v", err)
+	}
+
+	// Archived leagues can't be changed through what the archive hands out
+	got.League[0].Wins = 100
+	if again, _ := reopened.Season(ctx, 1); again.League[0].Wins != 3 {
+		t.Errorf("expected the archived league to be immutable, got %+v", again.League)
+	}
+}
+
+func TestFileSystemPlayerStore_ResetScores(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "scores.json")
+	store, err := NewFileSystemPlayerStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	store.RecordWin(ctx, "Alice")
+
+	var archived []Player
+	err = store.ResetScores(ctx, 1, func(league []Player) error {
+		archived = league
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error resetting scores: %v", err)
+	}
+	if !reflect.DeepEqual(archived, []Player{{"Alice", 1}}) {
+		t.Errorf("got archived league %v", archived)
+	}
+
+	reopened, _ := NewFileSystemPlayerStore(path)
+	if got, _ := reopened.GetPlayerScore(ctx, "Alice"); got != 0 {
+		t.Errorf("expected the reset to be saved, got score %d", got)
+	}
+	if league, _ := reopened.GetLeague(ctx); !reflect.DeepEqual(league, []Player{{"Alice", 0}}) {
+		t.Errorf("expected Alice to stay in the league with no wins, got %v", league)
+	}
+	if season, _ := reopened.LastReset(ctx); season != 1 {
+		t.Errorf("got last reset %d want 1", season)
+	}
+}
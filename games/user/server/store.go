@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// InMemoryPlayerStore is a PlayerStore that keeps scores in memory.
+// It is safe for concurrent use, net/http serves requests on many goroutines.
+type InMemoryPlayerStore struct {
+	mu    sync.RWMutex
+	users userTable
+	// now is the store's clock, replaced in tests
+	now func() time.Time
+}
+
+// NewInMemoryPlayerStore initializes an empty InMemoryPlayerStore.
+func NewInMemoryPlayerStore() *InMemoryPlayerStore {
+	return &InMemoryPlayerStore{
+		users: newUserTable(),
+		now:   time.Now,
+	}
+}
+
+// GetPlayerScore returns the score for a player, unknown players have a score of 0.
+func (i *InMemoryPlayerStore) GetPlayerScore(name string) int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.score(name)
+}
+
+// RecordWin increments the score for a player.
+func (i *InMemoryPlayerStore) RecordWin(name string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.users.recordWin(name, i.now())
+}
+
+// GetLeague returns every player with their wins.
+func (i *InMemoryPlayerStore) GetLeague() []Player {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.league()
+}
+
+// GetUser returns the named user, the bool is false if the user is unknown.
+func (i *InMemoryPlayerStore) GetUser(name string) (User, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.user(name)
+}
+
+// CreateUser registers a new user with no wins.
+func (i *InMemoryPlayerStore) CreateUser(user User) (User, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.users.create(user, i.now())
+}
+
+// DeleteUser removes a user and their score.
+func (i *InMemoryPlayerStore) DeleteUser(name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := i.users.delete(name)
+	return err
+}
+
+// RecordWinIfRegistered increments the score for a registered player.
+func (i *InMemoryPlayerStore) RecordWinIfRegistered(ctx context.Context, name string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.users.recordWinIfRegistered(name, i.now())
+}
+
+// GetPlayerScoreVersion returns the score and version of a player, unknown players have version 0.
+func (i *InMemoryPlayerStore) GetPlayerScoreVersion(ctx context.Context, name string) (int, uint64, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.score(name), i.users.version(name), nil
+}
+
+// RecordWinIfVersion increments the score for a player if their version is still version.
+func (i *InMemoryPlayerStore) RecordWinIfVersion(ctx context.Context, name string, version uint64) (uint64, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.users.recordWinIfVersion(name, version, i.now())
+}
+
+// DeleteUserIfVersion removes a user if their version is still version.
+func (i *InMemoryPlayerStore) DeleteUserIfVersion(ctx context.Context, name string, version uint64) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, err := i.users.deleteIfVersion(name, version)
+	return err
+}
+
+// ResetScores archives every player's wins and resets them to 0 for the end of season.
+func (i *InMemoryPlayerStore) ResetScores(ctx context.Context, season int, archive func(league []Player) error) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := archive(i.users.league()); err != nil {
+		return err
+	}
+	i.users.resetScores(season, i.now())
+	return nil
+}
+
+// LastReset returns the season the last reset closed.
+func (i *InMemoryPlayerStore) LastReset(ctx context.Context) (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.users.lastReset, nil
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestInMemoryPlayerStore(t *testing.T) {
+	t.Run("unknown player has a score of 0", func(t *testing.T) {
+		store := NewInMemoryPlayerStore()
+
+		if got := store.GetPlayerScore("Alice"); got != 0 {
+			t.Errorf("expected score 0 for unknown player, got %d", got)
+		}
+	})
+
+	t.Run("RecordWin increments the score", func(t *testing.T) {
+		store := NewInMemoryPlayerStore()
+		store.RecordWin("Alice")
+		store.RecordWin("Alice")
+		store.RecordWin("Bob")
+
+		if got := store.GetPlayerScore("Alice"); got != 2 {
+			t.Errorf("expected score 2 for Alice, got %d", got)
+		}
+		if got := store.GetPlayerScore("Bob"); got != 1 {
+			t.Errorf("expected score 1 for Bob, got %d", got)
+		}
+	})
+
+	// Run with -race to check for data races
+	t.Run("concurrent RecordWin and GetPlayerScore", func(t *testing.T) {
+		store := NewInMemoryPlayerStore()
+
+		numRoutines := 100
+		numWins := 100
+		players := []string{"Alice", "Bob", "Charlie"}
+
+		var wg sync.WaitGroup
+		wg.Add(numRoutines)
+
+		for i := 0; i < numRoutines; i++ {
+			go func(player string) {
+				defer wg.Done()
+				for j := 0; j < numWins; j++ {
+					store.RecordWin(player)
+					store.GetPlayerScore(player)
+				}
+			}(players[i%len(players)])
+		}
+
+		wg.Wait()
+
+		total := 0
+		for _, player := range players {
+			total += store.GetPlayerScore(player)
+		}
+		if total != numRoutines*numWins {
+			t.Errorf("expected %d wins in total, got %d", numRoutines*numWins, total)
+		}
+	})
+}
+
+func TestPlayerServer_InMemoryPlayerStore(t *testing.T) {
+	store := NewInMemoryPlayerStore()
+	server := NewPlayerServer(store)
+	server.Start()
+
+	playerName := "Alice"
+	if _, err := store.CreateUser(User{Name: playerName}); err != nil {
+		t.Fatalf("unexpected error creating user: %v", err)
+	}
+	requestPath := fmt.Sprintf("/user/%s/score", playerName)
+
+	numRequests := 50
+	var wg sync.WaitGroup
+	wg.Add(numRequests)
+
+	for i := 0; i < numRequests; i++ {
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest(http.MethodPut, requestPath, nil)
+			server.ServeHTTP(httptest.NewRecorder(), request)
+		}()
+	}
+
+	wg.Wait()
+
+	request, _ := http.NewRequest(http.MethodGet, requestPath, nil)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	expected := fmt.Sprint(numRequests)
+	if response.Body.String() != expected {
+		t.Errorf("handler returned unexpected body: got %q want %q", response.Body.String(), expected)
+	}
+}
+
+func TestInMemoryPlayerStore_GetLeague(t *testing.T) {
+	store := NewInMemoryPlayerStore()
+	store.RecordWin("Alice")
+	store.RecordWin("Bob")
+	store.RecordWin("Bob")
+
+	league := store.GetLeague()
+	SortLeague(league)
+
+	want := []Player{{Name: "Bob", Wins: 2}, {Name: "Alice", Wins: 1}}
+	if !reflect.DeepEqual(league, want) {
+		t.Errorf("got league %v want %v", league, want)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// ErrStoreUnavailable is returned by stores that can't currently reach their backend.
+// PlayerServer answers it with 503 Service Unavailable.
+var ErrStoreUnavailable = errors.New("player store unavailable")
+
+// PlayerStoreV2 is a PlayerStore that honours cancellation and reports failures.
+// Stores that hit disk or the network should implement it, PlayerServer maps
+// the errors they return to HTTP statuses:
+//   - ErrUserNotFound is 404 Not Found
+//   - ErrStoreUnavailable, context cancellation and deadlines are 503 Service Unavailable
+//   - anything else is 500 Internal Server Error
+type PlayerStoreV2 interface {
+	GetPlayerScore(ctx context.Context, name string) (int, error)
+	RecordWin(ctx context.Context, name string) error
+	// GetLeague returns every player with their wins, in no particular order.
+	GetLeague(ctx context.Context) ([]Player, error)
+}
+
+// AdaptPlayerStore wraps a PlayerStore so it can be used as a PlayerStoreV2.
+// The wrapped store can't fail, the adapter only reports a context that is
+// already done before calling it. PlayerServer still finds the optional
+// interfaces of the wrapped store, such as UserStore, and the adapter closes
+// it if it is an io.Closer.
+func AdaptPlayerStore(store PlayerStore) PlayerStoreV2 {
+	return playerStoreAdapter{store: store}
+}
+
+// playerStoreAdapter implements PlayerStoreV2 on top of a PlayerStore.
+type playerStoreAdapter struct {
+	store PlayerStore
+}
+
+// unadapt returns the PlayerStore an adapter wraps, other stores are returned as they are.
+func unadapt(store any) any {
+	if adapter, ok := store.(playerStoreAdapter); ok {
+		return adapter.store
+	}
+	return store
+}
+
+func (a playerStoreAdapter) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.store.GetPlayerScore(name), nil
+}
+
+func (a playerStoreAdapter) RecordWin(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	a.store.RecordWin(name)
+	return nil
+}
+
+func (a playerStoreAdapter) GetLeague(ctx context.Context) ([]Player, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.store.GetLeague(), nil
+}
+
+func (a playerStoreAdapter) Close() error {
+	if closer, ok := a.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// storeErrorStatus maps an error from a PlayerStoreV2 to an HTTP status code.
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrStoreUnavailable),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeStoreError answers a request that failed because of a store error.
+func writeStoreError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), storeErrorStatus(err))
+}
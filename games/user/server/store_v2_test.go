@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// StubPlayerStoreV2 is a PlayerStoreV2 that fails every call with err.
+type StubPlayerStoreV2 struct {
+	err error
+}
+
+func (s *StubPlayerStoreV2) GetPlayerScore(ctx context.Context, name string) (int, error) {
+	return 0, s.err
+}
+
+func (s *StubPlayerStoreV2) RecordWin(ctx context.Context, name string) error {
+	return s.err
+}
+
+func (s *StubPlayerStoreV2) GetLeague(ctx context.Context) ([]Player, error) {
+	return nil, s.err
+}
+
+func TestPlayerServer_StoreErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+	}{
+		{
+			name:           "unknown player",
+			err:            fmt.Errorf("looking up Alice: %w", ErrUserNotFound),
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "store unavailable",
+			err:            ErrStoreUnavailable,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "deadline exceeded",
+			err:            context.DeadlineExceeded,
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "unexpected failure",
+			err:            errors.New("disk on fire"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/user/Alice/score"},
+		{http.MethodPut, "/user/Alice/score"},
+		{http.MethodGet, "/user/Alice"},
+		{http.MethodGet, "/league"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewPlayerServerV2(&StubPlayerStoreV2{err: tt.err})
+			server.AutoCreate = true
+			server.Start()
+
+			for _, route := range routes {
+				request, _ := http.NewRequest(route.method, route.path, nil)
+				response := httptest.NewRecorder()
+				server.Handler.ServeHTTP(response, request)
+
+				if response.Code != tt.expectedStatus {
+					t.Errorf("%s %s returned wrong status code: got %v want %v", route.method, route.path, response.Code, tt.expectedStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestAdaptPlayerStore(t *testing.T) {
+	t.Run("passes calls through to the v1 store", func(t *testing.T) {
+		spy := NewSpyPlayerStore(t)
+		spy.StubScore("Alice", 3)
+		store := AdaptPlayerStore(spy)
+
+		if err := store.RecordWin(context.Background(), "Alice"); err != nil {
+			t.Fatalf("unexpected error recording win: %v", err)
+		}
+		spy.AssertRecordWinCalledWith("Alice")
+
+		score, err := store.GetPlayerScore(context.Background(), "Alice")
+		if err != nil {
+			t.Fatalf("unexpected error getting score: %v", err)
+		}
+		if score != 4 {
+			t.Errorf("got score %d want %d", score, 4)
+		}
+	})
+
+	t.Run("cancelled context doesn't reach the v1 store", func(t *testing.T) {
+		spy := NewSpyPlayerStore(t)
+		store := AdaptPlayerStore(spy)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := store.RecordWin(ctx, "Alice"); !errors.Is(err, context.Canceled) {
+			t.Errorf("got error %v want %v", err, context.Canceled)
+		}
+		if len(spy.recordWinCalls) != 0 {
+			t.Errorf("expected no RecordWin calls, got %v", spy.recordWinCalls)
+		}
+	})
+}
@@ -0,0 +1,454 @@
+// Package storetest checks that a PlayerStore behaves the way PlayerServer expects.
+//
+// A new backend runs the suite from its tests:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.RunPlayerStoreSuite(t, storetest.Factory{
+//			OpenV2: func(t *testing.T, dir string) server.PlayerStoreV2 {
+//				return mystore.Open(filepath.Join(dir, "scores"))
+//			},
+//			Persistent: true,
+//		})
+//	}
+//
+// The optional interfaces PlayerServer uses, UserStore, VersionedPlayerStore,
+// SeasonalPlayerStore and RankedPlayerStore, are checked on stores that
+// implement them and skipped on the others.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"games/user/server"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// Factory opens the stores under test, set Open for a PlayerStore or OpenV2 for a PlayerStoreV2.
+type Factory struct {
+	// Open returns a store keeping its data in dir, every test gets a new empty dir.
+	// Stores implementing io.Closer are closed when the test ends.
+	Open func(t *testing.T, dir string) server.PlayerStore
+	// OpenV2 returns a store that reports failures, the same way as Open
+	OpenV2 func(t *testing.T, dir string) server.PlayerStoreV2
+	// Persistent stores are closed and opened again on the same dir to check
+	// nothing recorded is lost.
+	Persistent bool
+}
+
+// store is a store under test. The suite drives it as a PlayerStoreV2, a
+// PlayerStore is adapted, and finds its optional interfaces on raw, the store
+// the factory returned.
+type store struct {
+	server.PlayerStoreV2
+	raw any
+}
+
+// open returns the store the factory opens in dir.
+func (f Factory) open(t *testing.T, dir string) store {
+	t.Helper()
+	if f.OpenV2 != nil {
+		s := f.OpenV2(t, dir)
+		return store{PlayerStoreV2: s, raw: s}
+	}
+	s := f.Open(t, dir)
+	return store{PlayerStoreV2: server.AdaptPlayerStore(s), raw: s}
+}
+
+// close closes the store if it is an io.Closer.
+func (s store) close(t *testing.T) {
+	t.Helper()
+	if closer, ok := s.raw.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			t.Fatalf("unexpected error closing store: %v", err)
+		}
+	}
+}
+
+// as returns the store as the optional interface T, skipping the test if it isn't one.
+func as[T any](t *testing.T, s store) T {
+	t.Helper()
+	v, ok := s.raw.(T)
+	if !ok {
+		t.Skipf("store isn't a %s", reflect.TypeFor[T]().Name())
+	}
+	return v
+}
+
+// unicodeNames are player names a store must keep exactly as given.
+var unicodeNames = []string{"Zoë", "李雷", "Ελένη", "🎲 dice", "Ǆemal", "ö", "ö", "name with spaces"}
+
+// RunPlayerStoreSuite runs every check of the suite against stores from factory.
+func RunPlayerStoreSuite(t *testing.T, factory Factory) {
+	t.Helper()
+	ctx := context.Background()
+
+	open := func(t *testing.T, dir string) store {
+		t.Helper()
+		s := factory.open(t, dir)
+		if closer, ok := s.raw.(io.Closer); ok {
+			t.Cleanup(func() { closer.Close() })
+		}
+		return s
+	}
+	newStore := func(t *testing.T) store {
+		t.Helper()
+		return open(t, t.TempDir())
+	}
+
+	t.Run("unknown players have a score of 0", func(t *testing.T) {
+		store := newStore(t)
+		assertScores(t, store, map[string]int{"Nobody": 0})
+		assertLeague(t, store, map[string]int{})
+	})
+
+	t.Run("wins increment the score", func(t *testing.T) {
+		store := newStore(t)
+		recordWins(t, store, map[string]int{"Alice": 3, "Bob": 1})
+
+		assertScores(t, store, map[string]int{"Alice": 3, "Bob": 1, "Carol": 0})
+	})
+
+	t.Run("concurrent wins are all recorded", func(t *testing.T) {
+		store := newStore(t)
+		const goroutines, wins = 20, 25
+
+		var wg sync.WaitGroup
+		for g := range goroutines {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// Half the goroutines share a player, the rest have their own
+				name := "Shared"
+				if g%2 == 1 {
+					name = fmt.Sprintf("Own %d", g)
+				}
+				for range wins {
+					if err := store.RecordWin(ctx, name); err != nil {
+						t.Errorf("unexpected error recording a win: %v", err)
+					}
+					store.GetPlayerScore(ctx, name)
+					store.GetLeague(ctx)
+				}
+			}()
+		}
+		wg.Wait()
+
+		want := map[string]int{"Shared": goroutines / 2 * wins}
+		for g := 1; g < goroutines; g += 2 {
+			want[fmt.Sprintf("Own %d", g)] = wins
+		}
+		assertScores(t, store, want)
+		assertLeague(t, store, want)
+	})
+
+	t.Run("unicode names are kept exactly", func(t *testing.T) {
+		store := newStore(t)
+		want := map[string]int{}
+		for i, name := range unicodeNames {
+			want[name] = i + 1
+		}
+		recordWins(t, store, want)
+
+		// o followed by a combining diaeresis and ö look alike but are different players
+		assertScores(t, store, want)
+		assertLeague(t, store, want)
+	})
+
+	t.Run("league has every player with their wins", func(t *testing.T) {
+		store := newStore(t)
+		recordWins(t, store, map[string]int{"Alice": 2, "Bob": 5, "Carol": 2, "Dave": 1})
+
+		league := getLeague(t, store)
+		server.SortLeague(league)
+		wantLeague := []server.Player{{Name: "Bob", Wins: 5}, {Name: "Alice", Wins: 2}, {Name: "Carol", Wins: 2}, {Name: "Dave", Wins: 1}}
+		if !reflect.DeepEqual(league, wantLeague) {
+			t.Errorf("got ranked league %v want %v", league, wantLeague)
+		}
+
+		// Callers own the league they're given
+		league[0].Wins = 100
+		assertScores(t, store, map[string]int{"Bob": 5})
+	})
+
+	t.Run("users are registered and deleted", func(t *testing.T) {
+		store := newStore(t)
+		users := as[server.UserStore](t, store)
+
+		created, err := users.CreateUser(server.User{Name: "Alice", Metadata: map[string]string{"team": "red"}})
+		if err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		if created.Name != "Alice" || created.DisplayName != "Alice" || created.Wins != 0 || created.Metadata["team"] != "red" {
+			t.Errorf("got created user %+v", created)
+		}
+		if _, err := users.CreateUser(server.User{Name: "Alice"}); !errors.Is(err, server.ErrUserExists) {
+			t.Errorf("got error %v creating Alice again want %v", err, server.ErrUserExists)
+		}
+
+		recordWins(t, store, map[string]int{"Alice": 2})
+		if got, ok := users.GetUser("Alice"); !ok || got.Wins != 2 || got.Metadata["team"] != "red" {
+			t.Errorf("got user %+v, %v after 2 wins", got, ok)
+		}
+		// Callers own the user they're given
+		created.Metadata["team"] = "blue"
+		if got, _ := users.GetUser("Alice"); got.Metadata["team"] != "red" {
+			t.Errorf("changing the returned user changed the store, got %+v", got)
+		}
+
+		if err := users.DeleteUser("Alice"); err != nil {
+			t.Fatalf("unexpected error deleting user: %v", err)
+		}
+		if _, ok := users.GetUser("Alice"); ok {
+			t.Error("expected Alice to be deleted")
+		}
+		if err := users.DeleteUser("Alice"); !errors.Is(err, server.ErrUserNotFound) {
+			t.Errorf("got error %v deleting Alice again want %v", err, server.ErrUserNotFound)
+		}
+		assertScores(t, store, map[string]int{"Alice": 0})
+		assertLeague(t, store, map[string]int{})
+	})
+
+	t.Run("every change moves the version on", func(t *testing.T) {
+		store := newStore(t)
+		versioned := as[server.VersionedPlayerStore](t, store)
+
+		assertVersion(t, versioned, "Alice", 0, 0)
+		version, err := versioned.RecordWinIfVersion(ctx, "Alice", 0)
+		if err != nil {
+			t.Fatalf("unexpected error recording a win: %v", err)
+		}
+		assertVersion(t, versioned, "Alice", 1, version)
+		if _, err := versioned.RecordWinIfVersion(ctx, "Alice", 0); !errors.Is(err, server.ErrVersionConflict) {
+			t.Errorf("got error %v for a stale version want %v", err, server.ErrVersionConflict)
+		}
+		assertScores(t, store, map[string]int{"Alice": 1})
+
+		recordWins(t, store, map[string]int{"Alice": 1})
+		_, after, _ := versioned.GetPlayerScoreVersion(ctx, "Alice")
+		if after == version {
+			t.Errorf("expected a win to change version %d", version)
+		}
+
+		if err := versioned.DeleteUserIfVersion(ctx, "Alice", version); !errors.Is(err, server.ErrVersionConflict) {
+			t.Errorf("got error %v deleting a stale version want %v", err, server.ErrVersionConflict)
+		}
+		if err := versioned.DeleteUserIfVersion(ctx, "Nobody", 0); !errors.Is(err, server.ErrUserNotFound) {
+			t.Errorf("got error %v deleting an unknown player want %v", err, server.ErrUserNotFound)
+		}
+		if err := versioned.DeleteUserIfVersion(ctx, "Alice", after); err != nil {
+			t.Fatalf("unexpected error deleting the current version: %v", err)
+		}
+		assertVersion(t, versioned, "Alice", 0, 0)
+	})
+
+	t.Run("only registered players are given wins", func(t *testing.T) {
+		store := newStore(t)
+		users := as[server.UserStore](t, store)
+		recorder := as[server.RegisteredWinRecorder](t, store)
+
+		if err := recorder.RecordWinIfRegistered(ctx, "Alice"); !errors.Is(err, server.ErrUserNotFound) {
+			t.Errorf("got error %v for an unregistered player want %v", err, server.ErrUserNotFound)
+		}
+		if _, ok := users.GetUser("Alice"); ok {
+			t.Error("expected a win not to register Alice")
+		}
+
+		if _, err := users.CreateUser(server.User{Name: "Alice"}); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		if err := recorder.RecordWinIfRegistered(ctx, "Alice"); err != nil {
+			t.Fatalf("unexpected error recording a win: %v", err)
+		}
+		assertScores(t, store, map[string]int{"Alice": 1})
+	})
+
+	t.Run("seasons reset every score", func(t *testing.T) {
+		store := newStore(t)
+		seasonal := as[server.SeasonalPlayerStore](t, store)
+
+		assertLastReset(t, seasonal, 0)
+		recordWins(t, store, map[string]int{"Alice": 2, "Bob": 1})
+
+		failed := errors.New("archive failed")
+		if err := seasonal.ResetScores(ctx, 1, func([]server.Player) error { return failed }); !errors.Is(err, failed) {
+			t.Errorf("got error %v from a failed archive want %v", err, failed)
+		}
+		assertScores(t, store, map[string]int{"Alice": 2, "Bob": 1})
+		assertLastReset(t, seasonal, 0)
+
+		var archived []server.Player
+		err := seasonal.ResetScores(ctx, 1, func(league []server.Player) error {
+			archived = league
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error resetting scores: %v", err)
+		}
+		server.SortLeague(archived)
+		if want := []server.Player{{Name: "Alice", Wins: 2}, {Name: "Bob", Wins: 1}}; !reflect.DeepEqual(archived, want) {
+			t.Errorf("got archived league %v want %v", archived, want)
+		}
+		assertScores(t, store, map[string]int{"Alice": 0, "Bob": 0})
+		assertLastReset(t, seasonal, 1)
+	})
+
+	t.Run("players are ranked by wins", func(t *testing.T) {
+		store := newStore(t)
+		ranked := as[server.RankedPlayerStore](t, store)
+		recordWins(t, store, map[string]int{"Alice": 3, "Bob": 1, "Carol": 1})
+
+		// Ties share a rank and the next is skipped, unknown players rank with no wins
+		for name, want := range map[string]int{"Alice": 1, "Bob": 2, "Carol": 2, "Nobody": 4} {
+			got, err := ranked.GetRank(ctx, name)
+			if err != nil {
+				t.Fatalf("unexpected error ranking %s: %v", name, err)
+			}
+			if got.Rank != want {
+				t.Errorf("got %s ranked %d want %d", name, got.Rank, want)
+			}
+		}
+
+		tests := []struct {
+			offset, limit int
+			want          []server.RankedPlayer
+		}{
+			{0, 2, []server.RankedPlayer{{Rank: 1, Name: "Alice", Wins: 3}, {Rank: 2, Name: "Bob", Wins: 1}}},
+			{1, 5, []server.RankedPlayer{{Rank: 2, Name: "Bob", Wins: 1}, {Rank: 2, Name: "Carol", Wins: 1}}},
+			{3, 5, []server.RankedPlayer{}},
+		}
+		for _, tt := range tests {
+			page, total, err := ranked.GetLeaderboard(ctx, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatalf("unexpected error reading the leaderboard: %v", err)
+			}
+			if total != 3 || !reflect.DeepEqual(page, tt.want) {
+				t.Errorf("got page %v of %d from %d want %v of 3", page, total, tt.offset, tt.want)
+			}
+		}
+	})
+
+	t.Run("scores persist across reopening", func(t *testing.T) {
+		if !factory.Persistent {
+			t.Skip("store doesn't persist")
+		}
+		dir := t.TempDir()
+		store := factory.open(t, dir)
+		want := map[string]int{"Alice": 2, unicodeNames[1]: 1}
+		recordWins(t, store, want)
+		store.close(t)
+
+		reopened := open(t, dir)
+		assertScores(t, reopened, want)
+		assertLeague(t, reopened, want)
+
+		recordWins(t, reopened, map[string]int{"Alice": 1})
+		assertScores(t, reopened, map[string]int{"Alice": 3})
+	})
+
+	t.Run("users and seasons persist across reopening", func(t *testing.T) {
+		if !factory.Persistent {
+			t.Skip("store doesn't persist")
+		}
+		dir := t.TempDir()
+		store := factory.open(t, dir)
+		users := as[server.UserStore](t, store)
+		seasonal := as[server.SeasonalPlayerStore](t, store)
+		if _, err := users.CreateUser(server.User{Name: "Alice", DisplayName: "Alice A"}); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		if err := seasonal.ResetScores(ctx, 4, func([]server.Player) error { return nil }); err != nil {
+			t.Fatalf("unexpected error resetting scores: %v", err)
+		}
+		recordWins(t, store, map[string]int{"Alice": 1})
+		before, _ := users.GetUser("Alice")
+		store.close(t)
+
+		reopened := open(t, dir)
+		after, ok := as[server.UserStore](t, reopened).GetUser("Alice")
+		// Times are compared with Equal, reading them back drops the monotonic clock
+		if !ok || after.DisplayName != before.DisplayName || after.Wins != before.Wins || after.Version != before.Version ||
+			!after.CreatedAt.Equal(before.CreatedAt) || !after.UpdatedAt.Equal(before.UpdatedAt) {
+			t.Errorf("got user %+v, %v after reopening want %+v", after, ok, before)
+		}
+		assertLastReset(t, as[server.SeasonalPlayerStore](t, reopened), 4)
+	})
+}
+
+// recordWins records wins for every player in wins.
+func recordWins(t *testing.T, store server.PlayerStoreV2, wins map[string]int) {
+	t.Helper()
+	for name, n := range wins {
+		for range n {
+			if err := store.RecordWin(context.Background(), name); err != nil {
+				t.Fatalf("unexpected error recording a win for %q: %v", name, err)
+			}
+		}
+	}
+}
+
+// getLeague returns the store's league.
+func getLeague(t *testing.T, store server.PlayerStoreV2) []server.Player {
+	t.Helper()
+	league, err := store.GetLeague(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error reading the league: %v", err)
+	}
+	return league
+}
+
+// assertScores checks every player in want has their wins.
+func assertScores(t *testing.T, store server.PlayerStoreV2, want map[string]int) {
+	t.Helper()
+	for name, wins := range want {
+		got, err := store.GetPlayerScore(context.Background(), name)
+		if err != nil {
+			t.Fatalf("unexpected error reading the score of %q: %v", name, err)
+		}
+		if got != wins {
+			t.Errorf("got score %d for %q want %d", got, name, wins)
+		}
+	}
+}
+
+// assertLeague checks the league holds exactly the players in want.
+func assertLeague(t *testing.T, store server.PlayerStoreV2, want map[string]int) {
+	t.Helper()
+	got := map[string]int{}
+	for _, player := range getLeague(t, store) {
+		if _, dup := got[player.Name]; dup {
+			t.Errorf("%q is in the league more than once", player.Name)
+		}
+		got[player.Name] = player.Wins
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got league %v want %v", got, want)
+	}
+}
+
+// assertVersion checks a player's score and version.
+func assertVersion(t *testing.T, store server.VersionedPlayerStore, name string, score int, version uint64) {
+	t.Helper()
+	gotScore, gotVersion, err := store.GetPlayerScoreVersion(context.Background(), name)
+	if err != nil {
+		t.Fatalf("unexpected error reading the version of %q: %v", name, err)
+	}
+	if gotScore != score || gotVersion != version {
+		t.Errorf("got %q on %d wins at version %d want %d at version %d", name, gotScore, gotVersion, score, version)
+	}
+}
+
+// assertLastReset checks the season the store last reset.
+func assertLastReset(t *testing.T, store server.SeasonalPlayerStore, season int) {
+	t.Helper()
+	got, err := store.LastReset(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error reading the last reset: %v", err)
+	}
+	if got != season {
+		t.Errorf("got last reset %d want %d", got, season)
+	}
+}
@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"games/user/server"
+	"games/user/server/storetest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestInMemoryPlayerStore_Suite(t *testing.T) {
+	storetest.RunPlayerStoreSuite(t, storetest.Factory{
+		Open: func(t *testing.T, dir string) server.PlayerStore {
+			return server.NewInMemoryPlayerStore()
+		},
+	})
+}
+
+func TestFileSystemPlayerStore_Suite(t *testing.T) {
+	storetest.RunPlayerStoreSuite(t, storetest.Factory{
+		OpenV2: func(t *testing.T, dir string) server.PlayerStoreV2 {
+			store, err := server.NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %v", err)
+			}
+			return store
+		},
+		Persistent: true,
+	})
+}
+
+func TestCachingPlayerStore_Suite(t *testing.T) {
+	storetest.RunPlayerStoreSuite(t, storetest.Factory{
+		OpenV2: func(t *testing.T, dir string) server.PlayerStoreV2 {
+			store, err := server.NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %v", err)
+			}
+			return server.NewCachingPlayerStore(store, 100, time.Minute)
+		},
+		Persistent: true,
+	})
+}
+
+func TestEventSourcedPlayerStore_Suite(t *testing.T) {
+	storetest.RunPlayerStoreSuite(t, storetest.Factory{
+		OpenV2: func(t *testing.T, dir string) server.PlayerStoreV2 {
+			// Small segments and frequent snapshots so the suite crosses both
+			store, err := server.NewEventSourcedPlayerStore(dir, server.EventStoreConfig{SegmentEvents: 7, SnapshotEvery: 5})
+			if err != nil {
+				t.Fatalf("unexpected error opening store: %v", err)
+			}
+			return store
+		},
+		Persistent: true,
+	})
+}
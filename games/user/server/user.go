@@ -1,6 +1,18 @@
 package server
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"games/rating"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
 
 // --- Interface Definition (Requirement) ---
 
@@ -9,30 +21,448 @@ import "net/http"
 type PlayerStore interface {
 	GetPlayerScore(name string) int
 	RecordWin(name string)
-	// Maybe add context later: e.g., RecordWin(ctx context.Context, name string)
+	// GetLeague returns every player with their wins, in no particular order.
+	GetLeague() []Player
+	// Stores that need context or can fail implement PlayerStoreV2 instead
 }
 
-// --- PlayerServer Definition (Minimal structure assumed for tests) ---
+// Player is a single entry in the league table.
+type Player struct {
+	Name string `json:"name"`
+	Wins int    `json:"wins"`
+}
+
+// --- PlayerServer Definition ---
 
 // PlayerServer holds dependencies like the PlayerStore and handles HTTP requests.
-// (This would be defined in your actual server code)
 type PlayerServer struct {
 	Store PlayerStore
-	// Assume Start() configures this handler
+	// StoreV2 is used instead of Store when set
+	StoreV2 PlayerStoreV2
+	// AutoCreate serves unknown players as registered with a score of 0 and
+	// lets a PUT create them. When false players must be registered with POST /user.
+	AutoCreate bool
+	// Auth authenticates requests that change a player's score, nil leaves them open.
+	// Reading scores is always public.
+	Auth Authenticator
+	// RateLimits throttle authorized requests that change a player's score, a request must be allowed by all of them
+	RateLimits []*RateLimiter
+	// Idempotency replays the response to a retried score change with the same
+	// Idempotency-Key instead of recording another win, nil disables it
+	Idempotency *IdempotencyCache
+	// Events publishes score changes to the event stream routes, Start() creates one if nil
+	Events *Broadcaster
+	// Webhooks delivers score changes to registered webhooks and serves the
+	// /webhooks routes, which need a principal allowed to change any player.
+	// The routes are only served when Auth is set. Nil disables them.
+	Webhooks *WebhookDispatcher
+	// Matches keeps the match history, Start() creates an InMemoryMatchStore if nil
+	Matches MatchStore
+	// Ratings rates players on the matches recorded with POST /matches,
+	// Start() creates one with the default parameters if nil
+	Ratings *rating.Table
+	// Seasons archives the league when a season closes, Start() creates an
+	// InMemorySeasonArchive if nil. Closing a season needs a SeasonalPlayerStore.
+	Seasons SeasonArchive
+	// Logger receives access logs and recovered panics, slog.Default() is used if nil
+	Logger *slog.Logger
+	// Middleware is applied around the routes, inside the server's own request ID,
+	// access log, metrics and panic recovery middleware
+	Middleware []Middleware
+	// Handler is configured by Start()
 	Handler http.Handler
+
+	// store is the store the handlers use, Store is adapted to it if StoreV2 isn't set
+	store PlayerStoreV2
+	// metrics are served from /metrics
+	metrics *httpMetrics
+	// seasonMu serializes closing seasons
+	seasonMu sync.Mutex
+	// playerLocks serialize recording and publishing each player's score changes
+	playerLocks [playerLockStripes]sync.Mutex
 }
 
-// NewPlayerServer creates a server (actual implementation detail)
+// NewPlayerServer creates a PlayerServer backed by the given store.
+// Call Start() to configure the routes before serving requests.
 func NewPlayerServer(store PlayerStore) *PlayerServer {
-	return &PlayerServer{}
+	return &PlayerServer{
+		Store: store,
+	}
 }
 
-// Start configures routes (actual implementation detail)
+// NewPlayerServerV2 creates a PlayerServer backed by a context-aware store.
+// Call Start() to configure the routes before serving requests.
+func NewPlayerServerV2(store PlayerStoreV2) *PlayerServer {
+	return &PlayerServer{
+		StoreV2: store,
+	}
+}
+
+// Start configures the server's routes.
 func (p *PlayerServer) Start() {
+	p.startHttp()
+}
+
+// startHttp defines the paths served by the PlayerServer.
+func (p *PlayerServer) startHttp() {
+	p.store = p.StoreV2
+	if p.store == nil {
+		p.store = AdaptPlayerStore(p.Store)
+	}
+
+	if p.Matches == nil {
+		p.Matches = NewInMemoryMatchStore()
+	}
+	if p.Ratings == nil {
+		p.Ratings = rating.NewTable(rating.Config{})
+	}
+	if p.Seasons == nil {
+		p.Seasons = NewInMemorySeasonArchive()
+	}
+	if p.Events == nil {
+		p.Events = NewBroadcaster(defaultEventBuffer, defaultEventHistory)
+	}
+
 	mux := http.NewServeMux()
-	//... routes ...;
-	p.Handler = mux
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, routed(pattern, h))
+	}
+	handle("POST /user", p.createUser)
+	handle("GET /user/{name}", p.getUser)
+	handle("DELETE /user/{name}", p.deleteUser)
+	handle("GET /user/{name}/score", p.getScore)
+	handle("PUT /user/{name}/score", p.recordWin)
+	handle("GET /league", p.getLeague)
+	handle("GET /leaderboard", p.getLeaderboard)
+	handle("GET /user/{name}/rank", p.getRank)
+	handle("GET /user/{name}/matches", p.getMatches)
+	handle("POST /matches", p.recordMatch)
+	handle("GET /matches/{id}", p.getMatch)
+	handle("GET /user/{name}/rating", p.getRating)
+	handle("GET /league/ratings", p.getRatingLeague)
+	handle("POST /seasons", p.closeSeason)
+	handle("GET /seasons", p.listSeasons)
+	handle("GET /seasons/{id}/league", p.getSeasonLeague)
+	handle("GET /user/{name}/score/events", p.streamPlayerEvents)
+	handle("GET /league/events", p.streamLeagueEvents)
+	// Anyone could point webhooks at the server's network if they weren't authenticated
+	if p.Webhooks != nil && p.Auth != nil {
+		handle("POST /webhooks", p.createWebhook)
+		handle("GET /webhooks", p.listWebhooks)
+		handle("DELETE /webhooks/{id}", p.deleteWebhook)
+		handle("GET /webhooks/{id}/deliveries", p.listWebhookDeliveries)
+	}
+	handle("GET /healthz", p.healthz)
+	handle("GET /readyz", p.readyz)
+
+	p.metrics = newHTTPMetrics()
+	handle("GET /metrics", p.metrics.serveHTTP)
+
+	logger := p.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	middleware := []Middleware{
+		trackRoute,
+		RequestID,
+		AccessLog(logger),
+		p.metrics.instrument,
+		Recover(logger),
+	}
+	p.Handler = Chain(mux, append(middleware, p.Middleware...)...)
+}
+
+// ServeHTTP makes PlayerServer usable as an http.Handler once Start() has been called.
+func (p *PlayerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Handler.ServeHTTP(w, r)
 }
 
-// ServeHTTP makes PlayerServer usable with httptest (actual implementation detail)
-// func (p *PlayerServer) ServeHTTP(w http.ResponseWriter, r *http.Request) { p.Handler.ServeHTTP(w,r) }
+// wrappingStore is implemented by stores that wrap another, such as CachingPlayerStore.
+// They forward every optional interface but only offer the ones the wrapped store has.
+type wrappingStore interface {
+	unwrapStore() any
+}
+
+// storeAs returns the configured store as a T if it implements it, this is how
+// PlayerServer finds the optional capabilities of a store such as UserStore.
+func storeAs[T any](p *PlayerServer) (T, bool) {
+	var store any = p.Store
+	if p.StoreV2 != nil {
+		store = p.StoreV2
+	}
+	return asStore[T](store)
+}
+
+// asStore returns store as a T if it implements it. A PlayerStore adapted with
+// AdaptPlayerStore is looked through, and a wrapping store is only a T if every
+// store it wraps is.
+func asStore[T any](store any) (T, bool) {
+	store = unadapt(store)
+	t, ok := store.(T)
+	for ok {
+		wrapper, wraps := store.(wrappingStore)
+		if !wraps {
+			break
+		}
+		store = unadapt(wrapper.unwrapStore())
+		_, ok = store.(T)
+	}
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return t, true
+}
+
+// registered reports whether the named player can be served. In AutoCreate mode,
+// or when the store can't tell registered players apart, every player is registered.
+func (p *PlayerServer) registered(name string) bool {
+	if p.AutoCreate {
+		return true
+	}
+	users, ok := storeAs[UserStore](p)
+	if !ok {
+		return true
+	}
+	_, found := users.GetUser(name)
+	return found
+}
+
+// storeWin records a win for the named player. Unless AutoCreate is set the
+// player must be registered, which a RegisteredWinRecorder checks under the
+// same lock as the win so a player deleted meanwhile isn't created again.
+func (p *PlayerServer) storeWin(ctx context.Context, name string) error {
+	if !p.AutoCreate {
+		if recorder, ok := storeAs[RegisteredWinRecorder](p); ok {
+			return recorder.RecordWinIfRegistered(ctx, name)
+		}
+		if !p.registered(name) {
+			return ErrUserNotFound
+		}
+	}
+	return p.store.RecordWin(ctx, name)
+}
+
+// scoreTypes are the representations of a score, plain text is the default.
+var scoreTypes = []string{mediaText, mediaJSON, mediaCSV}
+
+// userTypes are the representations of a user and of the league, JSON is the default.
+var userTypes = []string{mediaJSON, mediaText, mediaCSV}
+
+// getScore writes the current score of the named player, or their score in
+// the season given by the season query parameter.
+func (p *PlayerServer) getScore(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, scoreTypes...)
+	if !ok {
+		notAcceptable(w, scoreTypes...)
+		return
+	}
+
+	playerName := r.PathValue("name")
+	if id := r.URL.Query().Get("season"); id != "" {
+		season, current, err := p.season(r.Context(), id)
+		if err != nil {
+			writeSeasonError(w, err)
+			return
+		}
+		if !current {
+			// Archived seasons keep the scores of players deleted since
+			p.getSeasonScore(w, mediaType, season, playerName)
+			return
+		}
+	}
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	if versioned, ok := storeAs[VersionedPlayerStore](p); ok {
+		score, version, err := versioned.GetPlayerScoreVersion(r.Context(), playerName)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		if checkNotModified(w, r, version, representation(mediaType, scoreTypes)) {
+			return
+		}
+		writeScore(w, mediaType, playerName, score)
+		return
+	}
+
+	score, err := p.store.GetPlayerScore(r.Context(), playerName)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeScore(w, mediaType, playerName, score)
+}
+
+// getUser writes the public representation of the named player, JSON by default.
+// Stores that don't implement UserStore only know the score, unknown players
+// are served as a fresh user with no wins.
+func (p *PlayerServer) getUser(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, userTypes...)
+	if !ok {
+		notAcceptable(w, userTypes...)
+		return
+	}
+
+	playerName := r.PathValue("name")
+	if !p.registered(playerName) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	var user User
+	found := false
+	if users, ok := storeAs[UserStore](p); ok {
+		user, found = users.GetUser(playerName)
+	}
+	if !found {
+		score, err := p.store.GetPlayerScore(r.Context(), playerName)
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		user = User{
+			Name:        playerName,
+			DisplayName: playerName,
+			Wins:        score,
+		}
+	}
+
+	if _, ok := storeAs[VersionedPlayerStore](p); ok && found {
+		if checkNotModified(w, r, user.Version, representation(mediaType, userTypes)) {
+			return
+		}
+	}
+	writeUser(w, mediaType, user)
+}
+
+// createUser registers the player described by the JSON request body, which
+// needs the same authorization as changing the player's score. Only name is
+// required, display name defaults to the name.
+func (p *PlayerServer) createUser(w http.ResponseWriter, r *http.Request) {
+	users, ok := storeAs[UserStore](p)
+	if !ok {
+		http.Error(w, "store does not support registering users", http.StatusNotImplemented)
+		return
+	}
+
+	var request User
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid user: %v", err), http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" || strings.Contains(request.Name, "/") {
+		http.Error(w, "invalid user: name must be non-empty and must not contain '/'", http.StatusBadRequest)
+		return
+	}
+	if !p.authorize(w, r, request.Name) {
+		return
+	}
+
+	user, err := users.CreateUser(request)
+	if errors.Is(err, ErrUserExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/user/"+url.PathEscape(user.Name))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(user)
+}
+
+// deleteUser removes the named player.
+func (p *PlayerServer) deleteUser(w http.ResponseWriter, r *http.Request) {
+	users, ok := storeAs[UserStore](p)
+	if !ok {
+		http.Error(w, "store does not support deleting users", http.StatusNotImplemented)
+		return
+	}
+
+	playerName := r.PathValue("name")
+	if !p.authorize(w, r, playerName) {
+		return
+	}
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		p.deleteUserIfMatch(w, r, playerName, ifMatch)
+		return
+	}
+	if err := users.DeleteUser(playerName); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recordWin records a win for the named player. A season query parameter must
+// name the current season, closed seasons never change.
+func (p *PlayerServer) recordWin(w http.ResponseWriter, r *http.Request) {
+	playerName := r.PathValue("name")
+	if id := r.URL.Query().Get("season"); id != "" {
+		_, current, err := p.season(r.Context(), id)
+		if err != nil {
+			writeSeasonError(w, err)
+			return
+		}
+		if !current {
+			http.Error(w, fmt.Sprintf("season %s is closed", id), http.StatusConflict)
+			return
+		}
+	}
+	r, ok := p.admit(w, r, playerName)
+	if !ok {
+		return
+	}
+	p.idempotent(w, r, func(w http.ResponseWriter, r *http.Request) {
+		if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+			p.recordWinIfMatch(w, r, playerName, ifMatch)
+			return
+		}
+		err := p.recordAndPublishWin(r.Context(), playerName, func() error {
+			return p.storeWin(r.Context(), playerName)
+		})
+		if err != nil {
+			writeStoreError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted) // Use Accepted for actions
+	})
+}
+
+// getLeague writes every player, JSON by default, ranked by wins with ties ordered by name.
+func (p *PlayerServer) getLeague(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, userTypes...)
+	if !ok {
+		notAcceptable(w, userTypes...)
+		return
+	}
+
+	league, err := p.store.GetLeague(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if league == nil {
+		league = []Player{} // encode an empty league as [] rather than null
+	}
+	SortLeague(league)
+	writeLeague(w, mediaType, league)
+}
+
+// SortLeague orders players the way PlayerServer ranks them, by wins descending
+// and then by name.
+func SortLeague(league []Player) {
+	slices.SortFunc(league, func(a, b Player) int {
+		if a.Wins != b.Wins {
+			return b.Wins - a.Wins
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+}
@@ -1,10 +1,17 @@
 package server // Or your service package name + _test
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // --- Mock Implementation (For Testing) ---
@@ -48,6 +55,15 @@ func (s *SpyPlayerStore) RecordWin(name string) {
 	s.scores[name]++
 }
 
+// GetLeague returns every stubbed player with their score.
+func (s *SpyPlayerStore) GetLeague() []Player {
+	league := []Player{}
+	for name, score := range s.scores {
+		league = append(league, Player{Name: name, Wins: score})
+	}
+	return league
+}
+
 // Helper for tests to check RecordWin calls
 func (s *SpyPlayerStore) AssertRecordWinCalledWith(expectedName string) {
 	s.t.Helper()
@@ -70,37 +86,24 @@ func (s *SpyPlayerStore) StubScore(name string, score int) {
 
 // --- Tests ---
 
+// TestMain silences the access logs of servers that don't set their own Logger.
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
 // Helper function to create a PlayerServer instance for testing
-// This simulates creating the server and running its setup logic (like Start).
+// This creates the server and runs its setup logic (Start) to configure the routes.
 func setupTestServer(t *testing.T) (*PlayerServer, *SpyPlayerStore) {
 	t.Helper()
 	store := NewSpyPlayerStore(t)
 
-	// --- Simulate what PlayerServer.Start() would do: setup routes ---
-	// In real code, this mux setup would be inside PlayerServer.Start() or a related method.
-	mux := http.NewServeMux()
-	// Replace handler functions with placeholder names for now
-	mux.HandleFunc("GET /user/{name}/score", func(w http.ResponseWriter, r *http.Request) {
-		playerName := r.PathValue("name") // Requires Go 1.22+ for PathValue
-		// --- Placeholder for actual GET handler logic ---
-		score := store.GetPlayerScore(playerName)
-		fmt.Fprint(w, score) // Write score as string
-		// Actual handler would likely involve JSON marshaling etc.
-	})
-	mux.HandleFunc("PUT /user/{name}/score", func(w http.ResponseWriter, r *http.Request) {
-		playerName := r.PathValue("name") // Requires Go 1.22+ for PathValue
-		// --- Placeholder for actual PUT handler logic ---
-		store.RecordWin(playerName)
-		w.WriteHeader(http.StatusAccepted) // Use Accepted for actions
-	})
-	// --- End Route Setup Simulation ---
+	server := NewPlayerServer(store)
+	// The spy can't register players, unknown players read as 0 and PUT creates them
+	server.AutoCreate = true
+	// We don't block in Start(), it configures the routes on the server's Handler.
+	server.Start()
 
-	server := &PlayerServer{
-		Store:   store,
-		Handler: mux, // Assign the configured mux to the server's handler
-	}
-
-	// We don't call a blocking server.Start() here, we use the configured Handler directly.
 	return server, store
 }
 
@@ -219,3 +222,276 @@ func TestPlayerServer_PUTScore(t *testing.T) {
 		}
 	})
 }
+
+func TestPlayerServer_GETLeague(t *testing.T) {
+	t.Run("returns an empty league as a JSON array", func(t *testing.T) {
+		server, _ := setupTestServer(t)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		if got := strings.TrimSpace(response.Body.String()); got != "[]" {
+			t.Errorf("handler returned unexpected body: got %q want %q", got, "[]")
+		}
+	})
+
+	t.Run("returns players ranked by wins", func(t *testing.T) {
+		server, store := setupTestServer(t)
+		store.StubScore("Alice", 5)
+		store.StubScore("Bob", 10)
+		store.StubScore("Charlie", 5)
+
+		request, _ := http.NewRequest(http.MethodGet, "/league", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		if got := response.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("handler returned wrong content type: got %q want %q", got, "application/json")
+		}
+
+		var got []Player
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse league %q: %v", response.Body.String(), err)
+		}
+
+		// Ties are ordered by name
+		want := []Player{
+			{Name: "Bob", Wins: 10},
+			{Name: "Alice", Wins: 5},
+			{Name: "Charlie", Wins: 5},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("handler returned unexpected league: got %v want %v", got, want)
+		}
+	})
+}
+
+func TestPlayerServer_GETUser(t *testing.T) {
+	t.Run("store without users serves the score", func(t *testing.T) {
+		server, store := setupTestServer(t)
+		store.StubScore("Alice", 5)
+
+		request, _ := http.NewRequest(http.MethodGet, "/user/Alice", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+
+		if response.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		if got := response.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("handler returned wrong content type: got %q want %q", got, "application/json")
+		}
+
+		var got User
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse user %q: %v", response.Body.String(), err)
+		}
+		want := User{Name: "Alice", DisplayName: "Alice", Wins: 5}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("handler returned unexpected user: got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("user store serves the full user", func(t *testing.T) {
+		created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+		store := NewInMemoryPlayerStore()
+		store.now = func() time.Time { return created }
+		store.RecordWin("Bob")
+		store.now = func() time.Time { return created.Add(time.Hour) }
+		store.RecordWin("Bob")
+
+		server := NewPlayerServer(store)
+		server.Start()
+
+		request, _ := http.NewRequest(http.MethodGet, "/user/Bob", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+
+		var got User
+		if err := json.NewDecoder(response.Body).Decode(&got); err != nil {
+			t.Fatalf("unable to parse user %q: %v", response.Body.String(), err)
+		}
+		want := User{
+			Name:        "Bob",
+			DisplayName: "Bob",
+			Wins:        2,
+			CreatedAt:   created,
+			UpdatedAt:   created.Add(time.Hour),
+			Version:     2,
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("handler returned unexpected user: got %+v want %+v", got, want)
+		}
+	})
+
+	t.Run("score route still works alongside the user route", func(t *testing.T) {
+		server, store := setupTestServer(t)
+		store.StubScore("Alice", 3)
+
+		request, _ := http.NewRequest(http.MethodGet, "/user/Alice/score", nil)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+
+		if response.Body.String() != "3" {
+			t.Errorf("handler returned unexpected body: got %q want %q", response.Body.String(), "3")
+		}
+	})
+}
+
+func TestPlayerServer_UserLifecycle(t *testing.T) {
+	// Helper to create a server that requires players to be registered
+	setupLifecycleServer := func(t *testing.T) *PlayerServer {
+		t.Helper()
+		server := NewPlayerServer(NewInMemoryPlayerStore())
+		server.Start()
+		return server
+	}
+
+	serve := func(server *PlayerServer, method, path, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("unknown players are not found", func(t *testing.T) {
+		server := setupLifecycleServer(t)
+
+		tests := []struct {
+			method string
+			path   string
+		}{
+			{http.MethodGet, "/user/Alise/score"},
+			{http.MethodPut, "/user/Alise/score"},
+			{http.MethodGet, "/user/Alise"},
+			{http.MethodDelete, "/user/Alise"},
+		}
+		for _, tt := range tests {
+			response := serve(server, tt.method, tt.path, "")
+			if response.Code != http.StatusNotFound {
+				t.Errorf("%s %s returned wrong status code: got %v want %v", tt.method, tt.path, response.Code, http.StatusNotFound)
+			}
+		}
+	})
+
+	t.Run("registered player starts with a score of 0", func(t *testing.T) {
+		server := setupLifecycleServer(t)
+
+		response := serve(server, http.MethodPost, "/user", `{"name":"Alice","displayName":"Queen Alice"}`)
+		if response.Code != http.StatusCreated {
+			t.Fatalf("POST /user returned wrong status code: got %v want %v", response.Code, http.StatusCreated)
+		}
+		if got := response.Header().Get("Location"); got != "/user/Alice" {
+			t.Errorf("POST /user returned wrong location: got %q want %q", got, "/user/Alice")
+		}
+		var created User
+		if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+			t.Fatalf("unable to parse user %q: %v", response.Body.String(), err)
+		}
+		if created.Name != "Alice" || created.DisplayName != "Queen Alice" || created.Wins != 0 {
+			t.Errorf("POST /user returned unexpected user: %+v", created)
+		}
+
+		response = serve(server, http.MethodGet, "/user/Alice/score", "")
+		if response.Code != http.StatusOK || response.Body.String() != "0" {
+			t.Errorf("GET score returned %v %q want %v %q", response.Code, response.Body.String(), http.StatusOK, "0")
+		}
+
+		response = serve(server, http.MethodPut, "/user/Alice/score", "")
+		if response.Code != http.StatusAccepted {
+			t.Errorf("PUT score returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+		}
+
+		response = serve(server, http.MethodGet, "/user/Alice/score", "")
+		if response.Body.String() != "1" {
+			t.Errorf("GET score returned unexpected body: got %q want %q", response.Body.String(), "1")
+		}
+	})
+
+	t.Run("registering twice is a conflict", func(t *testing.T) {
+		server := setupLifecycleServer(t)
+
+		serve(server, http.MethodPost, "/user", `{"name":"Alice"}`)
+		response := serve(server, http.MethodPost, "/user", `{"name":"Alice"}`)
+		if response.Code != http.StatusConflict {
+			t.Errorf("second POST /user returned wrong status code: got %v want %v", response.Code, http.StatusConflict)
+		}
+	})
+
+	t.Run("invalid registrations are bad requests", func(t *testing.T) {
+		server := setupLifecycleServer(t)
+
+		for _, body := range []string{`not json`, `{}`, `{"name":""}`, `{"name":"a/b"}`} {
+			response := serve(server, http.MethodPost, "/user", body)
+			if response.Code != http.StatusBadRequest {
+				t.Errorf("POST /user %s returned wrong status code: got %v want %v", body, response.Code, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("deleted player is not found", func(t *testing.T) {
+		server := setupLifecycleServer(t)
+		serve(server, http.MethodPost, "/user", `{"name":"Alice"}`)
+		serve(server, http.MethodPut, "/user/Alice/score", "")
+
+		response := serve(server, http.MethodDelete, "/user/Alice", "")
+		if response.Code != http.StatusNoContent {
+			t.Errorf("DELETE returned wrong status code: got %v want %v", response.Code, http.StatusNoContent)
+		}
+
+		response = serve(server, http.MethodGet, "/user/Alice/score", "")
+		if response.Code != http.StatusNotFound {
+			t.Errorf("GET score after delete returned wrong status code: got %v want %v", response.Code, http.StatusNotFound)
+		}
+	})
+
+	t.Run("a win doesn't bring back a player deleted after the check", func(t *testing.T) {
+		// The lookup says Alice is registered, as it would just before a DELETE lands
+		store := staleUserStore{NewInMemoryPlayerStore()}
+		server := NewPlayerServer(store)
+		server.Start()
+
+		tests := []struct {
+			method, path, body string
+			want               int
+		}{
+			{http.MethodPut, "/user/Alice/score", "", http.StatusNotFound},
+			{http.MethodPost, "/matches", `{"winner":"Alice","losers":["Bob"]}`, http.StatusUnprocessableEntity},
+		}
+		for _, tt := range tests {
+			response := serve(server, tt.method, tt.path, tt.body)
+			if response.Code != tt.want {
+				t.Errorf("%s %s returned wrong status code: got %v want %v", tt.method, tt.path, response.Code, tt.want)
+			}
+		}
+		if _, ok := store.InMemoryPlayerStore.GetUser("Alice"); ok {
+			t.Error("expected the win not to create Alice")
+		}
+	})
+
+	t.Run("store without users can't register players", func(t *testing.T) {
+		server, _ := setupTestServer(t)
+
+		response := serve(server, http.MethodPost, "/user", `{"name":"Alice"}`)
+		if response.Code != http.StatusNotImplemented {
+			t.Errorf("POST /user returned wrong status code: got %v want %v", response.Code, http.StatusNotImplemented)
+		}
+	})
+}
+
+// staleUserStore reports every player as registered, like a lookup made just
+// before the player was deleted.
+type staleUserStore struct {
+	*InMemoryPlayerStore
+}
+
+func (s staleUserStore) GetUser(name string) (User, bool) {
+	return User{Name: name, DisplayName: name, Version: 1}, true
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"time"
+)
+
+var (
+	// ErrUserExists is returned when creating a user whose name is already registered.
+	ErrUserExists = errors.New("user already exists")
+	// ErrUserNotFound is returned when a user hasn't been registered.
+	ErrUserNotFound = errors.New("user not found")
+)
+
+// User is the public representation of a player served from GET /user/{name}.
+type User struct {
+	Name        string            `json:"name"`
+	DisplayName string            `json:"displayName"`
+	Wins        int               `json:"wins"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	// Version changes whenever the user does, it is served as the ETag
+	Version uint64 `json:"version"`
+}
+
+// UserStore is implemented by stores that hold the full User and not just a score.
+// PlayerServer checks for it at request time, stores that only implement
+// PlayerStore are served with a User built from the player's score and can't
+// register or delete users.
+type UserStore interface {
+	// GetUser returns the named user, the bool is false if the user is unknown.
+	GetUser(name string) (User, bool)
+	// CreateUser registers a new user with no wins, it returns ErrUserExists if the name is taken.
+	CreateUser(user User) (User, error)
+	// DeleteUser removes a user, it returns ErrUserNotFound if the name isn't registered.
+	DeleteUser(name string) error
+}
+
+// RegisteredWinRecorder is implemented by UserStores that can record a win only
+// for a registered user, checking the registration under the same lock as the
+// win. PlayerServer uses it when AutoCreate is off, otherwise a player deleted
+// between its check and the win would be created again by the win.
+type RegisteredWinRecorder interface {
+	// RecordWinIfRegistered records a win, or returns ErrUserNotFound if the name isn't registered.
+	RecordWinIfRegistered(ctx context.Context, name string) error
+}
+
+// userTable holds the users of a store keyed by name, and an index of them ranked by wins.
+// It does no locking, the owning store guards it.
+type userTable struct {
+	users map[string]*User
+	ranks *rankIndex
+	// lastReset is the season the last reset closed, 0 before the first
+	lastReset int
+}
+
+func newUserTable() userTable {
+	return userTable{
+		users: make(map[string]*User),
+		ranks: newRankIndex(),
+	}
+}
+
+// MarshalJSON encodes the users as an object keyed by name.
+func (t userTable) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.users)
+}
+
+// score returns the wins for a user, unknown users have a score of 0.
+func (t userTable) score(name string) int {
+	if u, ok := t.users[name]; ok {
+		return u.Wins
+	}
+	return 0
+}
+
+// put adds a user as they are, replacing any user with the same name.
+// Stores use it to load users and to restore them when a save fails.
+func (t userTable) put(u *User) {
+	if old, ok := t.users[u.Name]; ok {
+		t.ranks.remove(rankKey{wins: old.Wins, name: old.Name})
+	}
+	t.users[u.Name] = u
+	t.ranks.insert(rankKey{wins: u.Wins, name: u.Name})
+}
+
+// setWins changes a user's wins, keeping the rank index in order.
+func (t userTable) setWins(u *User, wins int) {
+	t.ranks.remove(rankKey{wins: u.Wins, name: u.Name})
+	u.Wins = wins
+	t.ranks.insert(rankKey{wins: u.Wins, name: u.Name})
+}
+
+// recordWin increments the wins for a user, creating the user if needed.
+func (t userTable) recordWin(name string, now time.Time) {
+	u, ok := t.users[name]
+	if !ok {
+		u = &User{Name: name, DisplayName: name, CreatedAt: now}
+		t.put(u)
+	}
+	t.setWins(u, u.Wins+1)
+	u.UpdatedAt = now
+	u.Version++
+}
+
+// recordWinIfRegistered increments the wins for a registered user.
+func (t userTable) recordWinIfRegistered(name string, now time.Time) error {
+	if _, ok := t.users[name]; !ok {
+		return ErrUserNotFound
+	}
+	t.recordWin(name, now)
+	return nil
+}
+
+// version returns the version of a user, 0 if the user is unknown.
+func (t userTable) version(name string) uint64 {
+	if u, ok := t.users[name]; ok {
+		return u.Version
+	}
+	return 0
+}
+
+// recordWinIfVersion increments the wins for a user if its version is still version
+// and returns the new version. An unknown user has version 0.
+func (t userTable) recordWinIfVersion(name string, version uint64, now time.Time) (uint64, error) {
+	if t.version(name) != version {
+		return 0, ErrVersionConflict
+	}
+	t.recordWin(name, now)
+	return t.users[name].Version, nil
+}
+
+// user returns a copy of the named user that is safe to hand to callers.
+func (t userTable) user(name string) (User, bool) {
+	u, ok := t.users[name]
+	if !ok {
+		return User{}, false
+	}
+	c := *u
+	c.Metadata = maps.Clone(u.Metadata)
+	return c, true
+}
+
+// create registers a new user with no wins and returns a copy of it.
+func (t userTable) create(user User, now time.Time) (User, error) {
+	if _, ok := t.users[user.Name]; ok {
+		return User{}, ErrUserExists
+	}
+	if user.DisplayName == "" {
+		user.DisplayName = user.Name
+	}
+	t.put(&User{
+		Name:        user.Name,
+		DisplayName: user.DisplayName,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Metadata:    maps.Clone(user.Metadata),
+		Version:     1,
+	})
+	created, _ := t.user(user.Name)
+	return created, nil
+}
+
+// delete removes a user and returns what was removed so callers can restore it.
+func (t userTable) delete(name string) (*User, error) {
+	u, ok := t.users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	delete(t.users, name)
+	t.ranks.remove(rankKey{wins: u.Wins, name: u.Name})
+	return u, nil
+}
+
+// deleteIfVersion removes a user if its version is still version.
+func (t userTable) deleteIfVersion(name string, version uint64) (*User, error) {
+	u, ok := t.users[name]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if u.Version != version {
+		return nil, ErrVersionConflict
+	}
+	return t.delete(name)
+}
+
+// league returns every user as a Player.
+func (t userTable) league() []Player {
+	league := make([]Player, 0, len(t.users))
+	for name, u := range t.users {
+		league = append(league, Player{Name: name, Wins: u.Wins})
+	}
+	return league
+}
+
+// resetScores sets every user's wins to 0 for the end of season, users keep
+// their registration.
+func (t *userTable) resetScores(season int, now time.Time) {
+	for _, u := range t.users {
+		if u.Wins == 0 {
+			continue
+		}
+		t.setWins(u, 0)
+		u.UpdatedAt = now
+		u.Version++
+	}
+	t.lastReset = season
+}
+
+// rank returns the named user's competition rank and wins. Unknown users are
+// ranked as a user with no wins.
+func (t userTable) rank(name string) RankedPlayer {
+	wins := t.score(name)
+	return RankedPlayer{Rank: t.ranks.rank(wins), Name: name, Wins: wins}
+}
+
+// leaderboard returns a page of the users ranked by wins and how many users there are.
+func (t userTable) leaderboard(offset, limit int) ([]RankedPlayer, int) {
+	return t.ranks.page(offset, limit), t.ranks.length
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionConflict is returned by a VersionedPlayerStore when a player changed
+// since the version a conditional change was based on. PlayerServer answers it
+// with 412 Precondition Failed.
+var ErrVersionConflict = errors.New("player version has changed")
+
+// VersionedPlayerStore is implemented by stores that keep a version per player
+// which changes whenever the player does. PlayerServer serves the version as
+// the ETag of a player and uses it for If-Match and If-None-Match.
+// Unknown players have version 0.
+type VersionedPlayerStore interface {
+	GetPlayerScoreVersion(ctx context.Context, name string) (score int, version uint64, err error)
+	// RecordWinIfVersion records a win and returns the new version, or ErrVersionConflict
+	RecordWinIfVersion(ctx context.Context, name string, version uint64) (uint64, error)
+	// DeleteUserIfVersion deletes a player, or returns ErrVersionConflict
+	DeleteUserIfVersion(ctx context.Context, name string, version uint64) error
+}
+
+// etag formats a version as a strong entity tag for one representation of a player.
+// Each representation needs its own tag so caches don't answer If-None-Match for
+// one media type with another: the default representation is tagged with the bare
+// version, the others with the version and the representation, e.g. "3-csv".
+func etag(version uint64, representation string) string {
+	if representation == "" {
+		return `"` + strconv.FormatUint(version, 10) + `"`
+	}
+	return `"` + strconv.FormatUint(version, 10) + "-" + representation + `"`
+}
+
+// representation names mediaType in a player's ETag, "" if it is the default of offers.
+func representation(mediaType string, offers []string) string {
+	if mediaType == offers[0] {
+		return ""
+	}
+	_, subtype, _ := strings.Cut(mediaType, "/")
+	return subtype
+}
+
+// tagVersion returns the version of a strong entity tag of any representation.
+func tagVersion(tag string) (uint64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, _, _ := strings.Cut(tag[1:len(tag)-1], "-")
+	v, err := strconv.ParseUint(version, 10, 64)
+	return v, err == nil
+}
+
+// matchingVersion returns the version in an If-Match header that equals current.
+// ok is false if none of the listed tags match, * matches any known player.
+// Every representation of the player has the same state, so a tag of any of them matches.
+func matchingVersion(ifMatch string, current uint64) (uint64, bool) {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" && current != 0 {
+			return current, true
+		}
+		// Weak tags never match for If-Match
+		if version, ok := tagVersion(tag); ok && version == current {
+			return current, true
+		}
+	}
+	return 0, false
+}
+
+// noneMatch reports whether an If-None-Match header lists none of the tags for
+// the current version of a representation. Weak comparison is used as for GET.
+func noneMatch(ifNoneMatch string, current uint64, representation string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag(current, representation) {
+			return false
+		}
+	}
+	return true
+}
+
+// preconditionFailed answers a conditional request whose precondition doesn't hold.
+func preconditionFailed(w http.ResponseWriter, version uint64, known bool) {
+	if known {
+		w.Header().Set("ETag", etag(version, ""))
+	}
+	http.Error(w, ErrVersionConflict.Error(), http.StatusPreconditionFailed)
+}
+
+// writeVersionError answers a conditional change that failed in the store.
+func writeVersionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrVersionConflict) {
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	}
+	writeStoreError(w, err)
+}
+
+// checkNotModified sets the ETag of the player's representation and answers
+// 304 Not Modified if the request's If-None-Match lists it, returning true if it did.
+func checkNotModified(w http.ResponseWriter, r *http.Request, version uint64, representation string) bool {
+	w.Header().Set("ETag", etag(version, representation))
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || noneMatch(ifNoneMatch, version, representation) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// currentVersion returns the store's version of the named player for a request sent
+// with If-Match. It answers the request itself and returns false if the store can't
+// version players or fails.
+func (p *PlayerServer) currentVersion(w http.ResponseWriter, r *http.Request, name string) (VersionedPlayerStore, uint64, bool) {
+	versioned, ok := storeAs[VersionedPlayerStore](p)
+	if !ok {
+		// The precondition can't be checked, so it can't be said to hold
+		http.Error(w, "store does not support conditional requests", http.StatusPreconditionFailed)
+		return nil, 0, false
+	}
+	_, version, err := versioned.GetPlayerScoreVersion(r.Context(), name)
+	if err != nil {
+		writeStoreError(w, err)
+		return nil, 0, false
+	}
+	return versioned, version, true
+}
+
+// recordWinIfMatch records a win only if the player still has a version listed in If-Match.
+func (p *PlayerServer) recordWinIfMatch(w http.ResponseWriter, r *http.Request, name, ifMatch string) {
+	versioned, current, ok := p.currentVersion(w, r, name)
+	if !ok {
+		return
+	}
+	// Version 0 would create the player, which only AutoCreate allows
+	if current == 0 && !p.registered(name) {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	version, ok := matchingVersion(ifMatch, current)
+	if !ok {
+		preconditionFailed(w, current, current != 0)
+		return
+	}
+
+	var newVersion uint64
+	err := p.recordAndPublishWin(r.Context(), name, func() (err error) {
+		newVersion, err = versioned.RecordWinIfVersion(r.Context(), name, version)
+		return err
+	})
+	if err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(newVersion, ""))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteUserIfMatch deletes a player only if they still have a version listed in If-Match.
+func (p *PlayerServer) deleteUserIfMatch(w http.ResponseWriter, r *http.Request, name, ifMatch string) {
+	versioned, current, ok := p.currentVersion(w, r, name)
+	if !ok {
+		return
+	}
+	if current == 0 {
+		http.Error(w, ErrUserNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	version, ok := matchingVersion(ifMatch, current)
+	if !ok {
+		preconditionFailed(w, current, true)
+		return
+	}
+
+	if err := versioned.DeleteUserIfVersion(r.Context(), name, version); err != nil {
+		writeVersionError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
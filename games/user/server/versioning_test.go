@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlayerServer_ETags(t *testing.T) {
+	newServer := func(t *testing.T) (*PlayerServer, *InMemoryPlayerStore) {
+		t.Helper()
+		store := NewInMemoryPlayerStore()
+		if _, err := store.CreateUser(User{Name: "Alice"}); err != nil {
+			t.Fatalf("unexpected error creating user: %v", err)
+		}
+		server := NewPlayerServer(store)
+		server.Start()
+		return server, store
+	}
+
+	serve := func(server *PlayerServer, method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	t.Run("GET returns the version as ETag", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		for _, path := range []string{"/user/Alice/score", "/user/Alice"} {
+			response := serve(server, http.MethodGet, path, nil)
+			if got := response.Header().Get("ETag"); got != `"1"` {
+				t.Errorf("GET %s returned ETag %q want %q", path, got, `"1"`)
+			}
+		}
+
+		serve(server, http.MethodPut, "/user/Alice/score", nil)
+		response := serve(server, http.MethodGet, "/user/Alice/score", nil)
+		if got := response.Header().Get("ETag"); got != `"2"` {
+			t.Errorf("GET after a win returned ETag %q want %q", got, `"2"`)
+		}
+	})
+
+	t.Run("If-None-Match", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		tests := []struct {
+			name           string
+			path           string
+			ifNoneMatch    string
+			expectedStatus int
+		}{
+			{"current score is not modified", "/user/Alice/score", `"1"`, http.StatusNotModified},
+			{"weak tag matches", "/user/Alice/score", `W/"1"`, http.StatusNotModified},
+			{"one of a list matches", "/user/Alice/score", `"7", "1"`, http.StatusNotModified},
+			{"stale score is served", "/user/Alice/score", `"0"`, http.StatusOK},
+			{"current user is not modified", "/user/Alice", `"1"`, http.StatusNotModified},
+			{"stale user is served", "/user/Alice", `"9"`, http.StatusOK},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				response := serve(server, http.MethodGet, tt.path, map[string]string{"If-None-Match": tt.ifNoneMatch})
+				if response.Code != tt.expectedStatus {
+					t.Errorf("handler returned wrong status code: got %v want %v", response.Code, tt.expectedStatus)
+				}
+				if response.Code == http.StatusNotModified && response.Body.Len() != 0 {
+					t.Errorf("expected no body with 304, got %q", response.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("each representation has its own ETag", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		tests := []struct {
+			path   string
+			accept string
+			want   string
+		}{
+			{"/user/Alice/score", "text/plain", `"1"`},
+			{"/user/Alice/score", "application/json", `"1-json"`},
+			{"/user/Alice/score", "text/csv", `"1-csv"`},
+			{"/user/Alice", "application/json", `"1"`},
+			{"/user/Alice", "text/plain", `"1-plain"`},
+		}
+		for _, tt := range tests {
+			response := serve(server, http.MethodGet, tt.path, map[string]string{"Accept": tt.accept})
+			if got := response.Header().Get("ETag"); got != tt.want {
+				t.Errorf("GET %s as %s returned ETag %q want %q", tt.path, tt.accept, got, tt.want)
+			}
+			if got := response.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("GET %s returned Vary %q want %q", tt.path, got, "Accept")
+			}
+		}
+
+		// A cached text score doesn't validate the JSON representation
+		response := serve(server, http.MethodGet, "/user/Alice/score", map[string]string{"Accept": "application/json", "If-None-Match": `"1"`})
+		if response.Code != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusOK)
+		}
+		response = serve(server, http.MethodGet, "/user/Alice/score", map[string]string{"Accept": "application/json", "If-None-Match": `"1-json"`})
+		if response.Code != http.StatusNotModified {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusNotModified)
+		}
+	})
+
+	t.Run("If-Match accepts the ETag of any representation", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		response := serve(server, http.MethodPut, "/user/Alice/score", map[string]string{"If-Match": `"1-csv"`})
+		if response.Code != http.StatusAccepted {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("PUT with current If-Match records the win", func(t *testing.T) {
+		server, store := newServer(t)
+
+		response := serve(server, http.MethodPut, "/user/Alice/score", map[string]string{"If-Match": `"1"`})
+		if response.Code != http.StatusAccepted {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusAccepted)
+		}
+		if got := response.Header().Get("ETag"); got != `"2"` {
+			t.Errorf("got new ETag %q want %q", got, `"2"`)
+		}
+		if got := store.GetPlayerScore("Alice"); got != 1 {
+			t.Errorf("got score %d want 1", got)
+		}
+	})
+
+	t.Run("PUT with stale If-Match fails", func(t *testing.T) {
+		server, store := newServer(t)
+		// A live game records a win between the admin's read and write
+		serve(server, http.MethodPut, "/user/Alice/score", nil)
+
+		response := serve(server, http.MethodPut, "/user/Alice/score", map[string]string{"If-Match": `"1"`})
+		if response.Code != http.StatusPreconditionFailed {
+			t.Fatalf("handler returned wrong status code: got %v want %v", response.Code, http.StatusPreconditionFailed)
+		}
+		if got := response.Header().Get("ETag"); got != `"2"` {
+			t.Errorf("expected the current ETag with 412, got %q", got)
+		}
+		if got := store.GetPlayerScore("Alice"); got != 1 {
+			t.Errorf("expected the stale write not to record, got score %d", got)
+		}
+	})
+
+	t.Run("PUT with weak If-Match fails", func(t *testing.T) {
+		server, _ := newServer(t)
+
+		response := serve(server, http.MethodPut, "/user/Alice/score", map[string]string{"If-Match": `W/"1"`})
+		if response.Code != http.StatusPreconditionFailed {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusPreconditionFailed)
+		}
+	})
+
+	t.Run("DELETE with If-Match", func(t *testing.T) {
+		server, store := newServer(t)
+
+		response := serve(server, http.MethodDelete, "/user/Alice", map[string]string{"If-Match": `"5"`})
+		if response.Code != http.StatusPreconditionFailed {
+			t.Errorf("stale DELETE returned wrong status code: got %v want %v", response.Code, http.StatusPreconditionFailed)
+		}
+
+		response = serve(server, http.MethodDelete, "/user/Alice", map[string]string{"If-Match": "*"})
+		if response.Code != http.StatusNoContent {
+			t.Errorf("DELETE returned wrong status code: got %v want %v", response.Code, http.StatusNoContent)
+		}
+		if _, ok := store.GetUser("Alice"); ok {
+			t.Error("expected Alice to be deleted")
+		}
+	})
+
+	t.Run("If-Match on a store without versions fails", func(t *testing.T) {
+		server, store := setupTestServer(t)
+
+		response := serve(server, http.MethodPut, "/user/Alice/score", map[string]string{"If-Match": `"1"`})
+		if response.Code != http.StatusPreconditionFailed {
+			t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusPreconditionFailed)
+		}
+		if len(store.recordWinCalls) != 0 {
+			t.Errorf("expected no wins to be recorded, got %v", store.recordWinCalls)
+		}
+	})
+}
+
+func TestUserTable_RecordWinIfVersion(t *testing.T) {
+	users := newUserTable()
+
+	version, err := users.recordWinIfVersion("Alice", 0, time.Now())
+	if err != nil || version != 1 {
+		t.Fatalf("got version %d, error %v want 1, nil", version, err)
+	}
+	if _, err := users.recordWinIfVersion("Alice", 0, time.Now()); err != ErrVersionConflict {
+		t.Errorf("got error %v want %v", err, ErrVersionConflict)
+	}
+}
+
+func TestFileSystemPlayerStore_RecordWinIfVersionFailedSave(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileSystemPlayerStore(filepath.Join(dir, "scores.json"))
+	if err != nil {
+		t.Fatalf("unexpected error opening store: %v", err)
+	}
+	store.RecordWin(ctx, "Alice")
+	// Saves fail once the store's directory is gone
+	store.path = filepath.Join(dir, "missing", "scores.json")
+
+	for _, name := range []string{"Alice", "Bob"} {
+		version := store.users.version(name)
+		if _, err := store.RecordWinIfVersion(ctx, name, version); err == nil {
+			t.Fatalf("expected the failed save to be returned for %s", name)
+		}
+		if got := store.users.version(name); got != version {
+			t.Errorf("expected %s to be left at version %d, got %d", name, version, got)
+		}
+	}
+	if got, _ := store.GetPlayerScore(ctx, "Alice"); got != 1 {
+		t.Errorf("expected the win to be undone, got score %d", got)
+	}
+	if _, ok := store.GetUser("Bob"); ok {
+		t.Error("expected Bob not to be created")
+	}
+	if rank, _ := store.GetRank(ctx, "Alice"); rank.Rank != 1 {
+		t.Errorf("expected the rank index to be restored, got %+v", rank)
+	}
+}
@@ -0,0 +1,599 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256,
+// keyed by the subscription's secret, of the timestamp, a dot and the body.
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Statuses of a WebhookDelivery attempt.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"    // will be retried
+	DeliveryDead      = "dead"      // out of attempts, dead-lettered
+	DeliveryAbandoned = "abandoned" // the dispatcher shut down first
+)
+
+// maxDeliveryLog bounds the deliveries kept per subscription.
+const maxDeliveryLog = 100
+
+var (
+	// ErrWebhookNotFound is returned for an unknown subscription ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+	// ErrDispatcherClosed is returned when registering with a closed dispatcher.
+	ErrDispatcherClosed = errors.New("webhook dispatcher closed")
+	// ErrWebhookDestination is returned for a webhook url whose host isn't a public address.
+	ErrWebhookDestination = errors.New("webhook url must resolve to public addresses")
+)
+
+// nonPublicPrefixes are special-purpose ranges netip.Addr has no method for.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Webhook is a subscription to score changes.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Players limits the subscription to some players, empty means every player
+	Players []string `json:"players,omitempty"`
+	// Secret signs deliveries, it is only shown when the webhook is registered
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is one attempt at delivering an event to a webhook.
+type WebhookDelivery struct {
+	ID         string    `json:"id"`
+	EventID    uint64    `json:"eventId"`
+	Attempt    int       `json:"attempt"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// webhookPayload is the JSON body of a delivery.
+type webhookPayload struct {
+	ID    string     `json:"id"`
+	Type  string     `json:"type"`
+	Event ScoreEvent `json:"event"`
+}
+
+// WebhookConfig configures a WebhookDispatcher, zero fields get defaults.
+type WebhookConfig struct {
+	// Client sends deliveries, it should have a timeout. The default client refuses
+	// to connect to addresses that aren't public, a Client set here is used as is.
+	Client *http.Client
+	// AllowPrivateDestinations lets webhooks deliver to loopback, private and
+	// link-local addresses, for receivers on the same network
+	AllowPrivateDestinations bool
+	// Workers is the number of concurrent deliveries
+	Workers int
+	// QueueSize bounds the deliveries waiting for a worker, more are dead-lettered
+	QueueSize int
+	// MaxAttempts before a delivery is dead-lettered
+	MaxAttempts int
+	// BaseBackoff is the wait after the first failed attempt, it doubles every attempt up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+// WebhookDispatcher delivers score events to webhook subscriptions asynchronously,
+// retrying failed deliveries with exponential backoff.
+type WebhookDispatcher struct {
+	config WebhookConfig
+
+	mu            sync.Mutex
+	subscriptions map[string]*webhookSubscription
+	queue         chan webhookJob
+	closed        bool
+
+	ctx    context.Context // cancelled to abandon deliveries when Close runs out of time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// pending counts the jobs that are queued, being sent or waiting to be retried
+	pending   sync.WaitGroup
+	closeOnce sync.Once
+
+	// now and after are the dispatcher's clock, replaced in tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+	// lookup resolves webhook hosts, replaced in tests
+	lookup func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// webhookSubscription is a registered Webhook and its delivery log.
+type webhookSubscription struct {
+	webhook    Webhook
+	deliveries []WebhookDelivery
+}
+
+// webhookJob is an event waiting to be delivered to a subscription.
+type webhookJob struct {
+	sub        *webhookSubscription
+	deliveryID string
+	event      ScoreEvent
+	body       []byte
+	// attempt is the number of the next attempt
+	attempt int
+}
+
+// NewWebhookDispatcher creates a WebhookDispatcher and starts its workers.
+// Close it to stop them.
+func NewWebhookDispatcher(config WebhookConfig) *WebhookDispatcher {
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+		if !config.AllowPrivateDestinations {
+			config.Client.Transport = publicTransport()
+		}
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1024
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 5 * time.Minute
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &WebhookDispatcher{
+		config:        config,
+		subscriptions: make(map[string]*webhookSubscription),
+		queue:         make(chan webhookJob, config.QueueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+		now:           time.Now,
+		after:         time.After,
+		lookup: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+	d.wg.Add(config.Workers)
+	for i := 0; i < config.Workers; i++ {
+		go d.work()
+	}
+	return d
+}
+
+// Register adds a subscription. A secret is generated if the webhook has none,
+// the returned Webhook is the only time it is shown. Unless the dispatcher allows
+// private destinations, the url's host must only resolve to public addresses.
+func (d *WebhookDispatcher) Register(webhook Webhook) (Webhook, error) {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return Webhook{}, fmt.Errorf("invalid webhook url %q, want an absolute http or https url", webhook.URL)
+	}
+	if !d.config.AllowPrivateDestinations {
+		if err := d.checkDestination(target.Hostname()); err != nil {
+			return Webhook{}, err
+		}
+	}
+
+	webhook.ID = randomHex(8)
+	if webhook.Secret == "" {
+		webhook.Secret = randomHex(32)
+	}
+	webhook.Players = slices.Clone(webhook.Players)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return Webhook{}, ErrDispatcherClosed
+	}
+	webhook.CreatedAt = d.now()
+	d.subscriptions[webhook.ID] = &webhookSubscription{webhook: webhook}
+	return webhook, nil
+}
+
+// List returns every subscription, without secrets, oldest first.
+func (d *WebhookDispatcher) List() []Webhook {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	webhooks := make([]Webhook, 0, len(d.subscriptions))
+	for _, sub := range d.subscriptions {
+		webhook := sub.webhook
+		webhook.Secret = ""
+		webhooks = append(webhooks, webhook)
+	}
+	slices.SortFunc(webhooks, func(a, b Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return webhooks
+}
+
+// Delete removes a subscription, deliveries still being retried for it stop.
+func (d *WebhookDispatcher) Delete(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.subscriptions[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(d.subscriptions, id)
+	return nil
+}
+
+// Deliveries returns the most recent delivery attempts of a subscription, oldest first.
+func (d *WebhookDispatcher) Deliveries(id string) ([]WebhookDelivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	sub, ok := d.subscriptions[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return slices.Clone(sub.deliveries), nil
+}
+
+// Notify queues the event for every interested subscription, it doesn't wait for delivery.
+func (d *WebhookDispatcher) Notify(event ScoreEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	for _, sub := range d.subscriptions {
+		if len(sub.webhook.Players) > 0 && !slices.Contains(sub.webhook.Players, event.Player) {
+			continue
+		}
+		job := webhookJob{sub: sub, deliveryID: randomHex(8), event: event, attempt: 1}
+		body, err := json.Marshal(webhookPayload{ID: job.deliveryID, Type: "score.changed", Event: event})
+		if err != nil {
+			d.logLocked(job, 0, DeliveryDead, 0, err.Error())
+			continue
+		}
+		job.body = body
+		d.pending.Add(1)
+		select {
+		case d.queue <- job:
+		default:
+			d.pending.Done()
+			d.logLocked(job, 0, DeliveryDead, 0, "delivery queue full")
+		}
+	}
+}
+
+// Close stops accepting events and waits for queued deliveries and their retries
+// to finish. When ctx is done first the remaining deliveries are abandoned.
+func (d *WebhookDispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+	d.closeOnce.Do(func() {
+		// Retries are queued again, so the queue stays open until no job is left
+		go func() {
+			d.pending.Wait()
+			close(d.queue)
+		}()
+	})
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work delivers queued jobs until the queue is closed.
+func (d *WebhookDispatcher) work() {
+	defer d.wg.Done()
+	for job := range d.queue {
+		d.deliver(job)
+	}
+}
+
+// deliver makes one attempt at sending a job. A failed attempt is retried
+// after its backoff, until the job runs out of attempts.
+func (d *WebhookDispatcher) deliver(job webhookJob) {
+	if d.ctx.Err() != nil {
+		d.abandon(job)
+		return
+	}
+	if !d.subscribed(job.sub) {
+		d.pending.Done()
+		return
+	}
+
+	code, err := d.send(job)
+	switch {
+	case err == nil:
+		d.log(job, job.attempt, DeliveryDelivered, code, "")
+		d.pending.Done()
+	case d.ctx.Err() != nil:
+		d.abandon(job)
+	case job.attempt >= d.config.MaxAttempts:
+		d.log(job, job.attempt, DeliveryDead, code, err.Error())
+		d.pending.Done()
+	default:
+		d.log(job, job.attempt, DeliveryFailed, code, err.Error())
+		d.retry(job)
+	}
+}
+
+// retry queues the job's next attempt once its backoff has passed. The wait
+// happens off the workers, so a slow or dead receiver can't hold them up and
+// starve deliveries to the others.
+func (d *WebhookDispatcher) retry(job webhookJob) {
+	wait := d.after(d.backoff(job.attempt))
+	job.attempt++
+	go func() {
+		select {
+		case <-wait:
+		case <-d.ctx.Done():
+			d.abandon(job)
+			return
+		}
+		select {
+		case d.queue <- job:
+		case <-d.ctx.Done():
+			d.abandon(job)
+		}
+	}()
+}
+
+// abandon gives up on a job because the dispatcher was closed.
+func (d *WebhookDispatcher) abandon(job webhookJob) {
+	d.log(job, job.attempt-1, DeliveryAbandoned, 0, "dispatcher closed")
+	d.pending.Done()
+}
+
+// send makes one delivery attempt, any response but a 2xx is an error.
+func (d *WebhookDispatcher) send(job webhookJob) (int, error) {
+	request, err := http.NewRequestWithContext(d.ctx, http.MethodPost, job.sub.webhook.URL, bytes.NewReader(job.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(d.now().Unix(), 10)
+	request.Header.Set("Content-Type", mediaJSON)
+	request.Header.Set(WebhookIDHeader, job.deliveryID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, SignWebhook(job.sub.webhook.Secret, timestamp, job.body))
+
+	response, err := d.config.Client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver answered %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff is the wait after the given failed attempt.
+func (d *WebhookDispatcher) backoff(attempt int) time.Duration {
+	wait := d.config.BaseBackoff
+	for i := 1; i < attempt && wait < d.config.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, d.config.MaxBackoff)
+}
+
+// checkDestination returns ErrWebhookDestination unless host only resolves to public addresses.
+func (d *WebhookDispatcher) checkDestination(host string) error {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrWebhookDestination, host)
+	}
+	addrs := []netip.Addr{}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = append(addrs, addr)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		addrs, err = d.lookup(ctx, host)
+		if err != nil {
+			return fmt.Errorf("resolving webhook host: %w", err)
+		}
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return fmt.Errorf("%w: %s is %s", ErrWebhookDestination, host, addr)
+		}
+	}
+	return nil
+}
+
+// isPublicAddr reports whether addr is a globally routable unicast address.
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// publicTransport returns a Transport that refuses to connect to addresses that
+// aren't public. The check is made on the address being dialed, so it also
+// covers redirects and hosts that resolve differently after registration.
+func publicTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialed instead of the receiver
+	transport.Proxy = nil
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !isPublicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrWebhookDestination, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// subscribed reports whether a subscription is still registered.
+func (d *WebhookDispatcher) subscribed(sub *webhookSubscription) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.subscriptions[sub.webhook.ID] == sub
+}
+
+// log records a delivery attempt.
+func (d *WebhookDispatcher) log(job webhookJob, attempt int, status string, code int, errMsg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logLocked(job, attempt, status, code, errMsg)
+}
+
+// logLocked records a delivery attempt. Callers must hold d.mu.
+func (d *WebhookDispatcher) logLocked(job webhookJob, attempt int, status string, code int, errMsg string) {
+	sub := job.sub
+	sub.deliveries = append(sub.deliveries, WebhookDelivery{
+		ID:         job.deliveryID,
+		EventID:    job.event.ID,
+		Attempt:    attempt,
+		Status:     status,
+		StatusCode: code,
+		Error:      errMsg,
+		Time:       d.now(),
+	})
+	if len(sub.deliveries) > maxDeliveryLog {
+		sub.deliveries = slices.Delete(sub.deliveries, 0, len(sub.deliveries)-maxDeliveryLog)
+	}
+}
+
+// SignWebhook returns the signature of a delivery, receivers recompute it with
+// their secret and compare with hmac.Equal.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// --- Routes ---
+
+// createWebhook registers the webhook described by the JSON request body.
+func (p *PlayerServer) createWebhook(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, AnyPlayer) {
+		return
+	}
+	var request Webhook
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid webhook: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	webhook, err := p.Webhooks.Register(request)
+	if errors.Is(err, ErrWebhookDestination) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, ErrDispatcherClosed) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Location", "/webhooks/"+webhook.ID)
+	w.Header().Set("Content-Type", mediaJSON)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// listWebhooks writes every webhook, without secrets.
+func (p *PlayerServer) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, AnyPlayer) {
+		return
+	}
+	writeJSON(w, p.Webhooks.List())
+}
+
+// deleteWebhook removes a webhook.
+func (p *PlayerServer) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, AnyPlayer) {
+		return
+	}
+	if err := p.Webhooks.Delete(r.PathValue("id")); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries writes the delivery log of a webhook.
+func (p *PlayerServer) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !p.authorize(w, r, AnyPlayer) {
+		return
+	}
+	deliveries, err := p.Webhooks.Deliveries(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []WebhookDelivery{}
+	}
+	writeJSON(w, deliveries)
+}
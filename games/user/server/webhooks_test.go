@@ -0,0 +1,356 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookReceiver is an httptest server that records deliveries, failing the
+// first failures of them.
+type webhookReceiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{failures: failures}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.deliveries = append(receiver.deliveries, r)
+		receiver.bodies = append(receiver.bodies, body)
+		if receiver.failures > 0 {
+			receiver.failures--
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (wr *webhookReceiver) count() int {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return len(wr.deliveries)
+}
+
+// newTestDispatcher creates a dispatcher whose backoff waits return at once,
+// recording how long they would have been.
+func newTestDispatcher(t *testing.T, maxAttempts int) (*WebhookDispatcher, func() []time.Duration) {
+	t.Helper()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	dispatcher := NewWebhookDispatcher(WebhookConfig{
+		Workers:                  1,
+		MaxAttempts:              maxAttempts,
+		BaseBackoff:              time.Second,
+		MaxBackoff:               3 * time.Second,
+		AllowPrivateDestinations: true, // receivers are on loopback
+	})
+	dispatcher.now = func() time.Time { return now }
+
+	var mu sync.Mutex
+	var waits []time.Duration
+	dispatcher.after = func(d time.Duration) <-chan time.Time {
+		mu.Lock()
+		waits = append(waits, d)
+		mu.Unlock()
+		ch := make(chan time.Time, 1)
+		ch <- now.Add(d)
+		return ch
+	}
+	return dispatcher, func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return waits
+	}
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	t.Run("delivers a signed payload", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, 0)
+		dispatcher, _ := newTestDispatcher(t, 3)
+		webhook, err := dispatcher.Register(Webhook{URL: receiver.URL})
+		if err != nil {
+			t.Fatalf("unexpected error registering webhook: %v", err)
+		}
+
+		dispatcher.Notify(ScoreEvent{ID: 7, Player: "Alice", Wins: 3})
+		dispatcher.Close(context.Background())
+
+		if receiver.count() != 1 {
+			t.Fatalf("expected 1 delivery, got %d", receiver.count())
+		}
+		request, body := receiver.deliveries[0], receiver.bodies[0]
+		want := SignWebhook(webhook.Secret, request.Header.Get(WebhookTimestampHeader), body)
+		if got := request.Header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(got), []byte(want)) {
+			t.Errorf("got signature %q want %q", got, want)
+		}
+
+		var payload webhookPayload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatalf("unable to parse payload %q: %v", body, err)
+		}
+		if payload.Event.Player != "Alice" || payload.Event.Wins != 3 || payload.ID != request.Header.Get(WebhookIDHeader) {
+			t.Errorf("unexpected payload %+v", payload)
+		}
+
+		deliveries, _ := dispatcher.Deliveries(webhook.ID)
+		if len(deliveries) != 1 || deliveries[0].Status != DeliveryDelivered || deliveries[0].StatusCode != http.StatusNoContent {
+			t.Errorf("unexpected delivery log %+v", deliveries)
+		}
+	})
+
+	t.Run("retries with exponential backoff", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, 3)
+		dispatcher, waits := newTestDispatcher(t, 5)
+		webhook, _ := dispatcher.Register(Webhook{URL: receiver.URL})
+
+		dispatcher.Notify(ScoreEvent{ID: 1, Player: "Alice", Wins: 1})
+		dispatcher.Close(context.Background())
+
+		if receiver.count() != 4 {
+			t.Errorf("expected 3 failures and a success, got %d deliveries", receiver.count())
+		}
+		// Doubling from 1s, capped at 3s
+		want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+		if got := waits(); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Errorf("got backoff %v want %v", got, want)
+		}
+
+		deliveries, _ := dispatcher.Deliveries(webhook.ID)
+		var statuses []string
+		for _, delivery := range deliveries {
+			statuses = append(statuses, delivery.Status)
+		}
+		if strings.Join(statuses, ",") != "failed,failed,failed,delivered" {
+			t.Errorf("unexpected delivery log %v", statuses)
+		}
+	})
+
+	t.Run("dead-letters after the last attempt", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, 100)
+		dispatcher, _ := newTestDispatcher(t, 3)
+		webhook, _ := dispatcher.Register(Webhook{URL: receiver.URL})
+
+		dispatcher.Notify(ScoreEvent{ID: 1, Player: "Alice", Wins: 1})
+		dispatcher.Close(context.Background())
+
+		if receiver.count() != 3 {
+			t.Errorf("expected 3 attempts, got %d", receiver.count())
+		}
+		deliveries, _ := dispatcher.Deliveries(webhook.ID)
+		last := deliveries[len(deliveries)-1]
+		if last.Status != DeliveryDead || last.Attempt != 3 || last.StatusCode != http.StatusBadGateway {
+			t.Errorf("expected the last attempt to be dead-lettered, got %+v", last)
+		}
+	})
+
+	t.Run("player filter", func(t *testing.T) {
+		receiver := newWebhookReceiver(t, 0)
+		dispatcher, _ := newTestDispatcher(t, 3)
+		dispatcher.Register(Webhook{URL: receiver.URL, Players: []string{"Bob"}})
+
+		dispatcher.Notify(ScoreEvent{ID: 1, Player: "Alice", Wins: 1})
+		dispatcher.Notify(ScoreEvent{ID: 2, Player: "Bob", Wins: 1})
+		dispatcher.Close(context.Background())
+
+		if receiver.count() != 1 {
+			t.Errorf("expected only Bob's event to be delivered, got %d deliveries", receiver.count())
+		}
+	})
+
+	t.Run("a failing receiver doesn't starve the others", func(t *testing.T) {
+		dead := newWebhookReceiver(t, 1000)
+		healthy := newWebhookReceiver(t, 0)
+		dispatcher := NewWebhookDispatcher(WebhookConfig{
+			Workers:                  1,
+			QueueSize:                4,
+			BaseBackoff:              time.Hour,
+			AllowPrivateDestinations: true,
+		})
+		deadHook, _ := dispatcher.Register(Webhook{URL: dead.URL})
+		dispatcher.Register(Webhook{URL: healthy.URL})
+
+		// More events than the queue holds, every one retried against the dead receiver
+		for i := 1; i <= 6; i++ {
+			dispatcher.Notify(ScoreEvent{ID: uint64(i), Player: "Alice", Wins: i})
+			deadline := time.Now().Add(5 * time.Second)
+			for healthy.count() < i && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		if healthy.count() != 6 {
+			t.Errorf("expected every event to reach the healthy receiver, got %d", healthy.count())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := dispatcher.Close(ctx); err == nil {
+			t.Error("expected Close to run out of time waiting for retries")
+		}
+		deliveries, _ := dispatcher.Deliveries(deadHook.ID)
+		if last := deliveries[len(deliveries)-1]; last.Status != DeliveryAbandoned {
+			t.Errorf("expected the retries to be abandoned, got %+v", last)
+		}
+	})
+
+	t.Run("invalid url is refused", func(t *testing.T) {
+		dispatcher, _ := newTestDispatcher(t, 3)
+		defer dispatcher.Close(context.Background())
+
+		for _, target := range []string{"", "ftp://example.com", "/relative"} {
+			if _, err := dispatcher.Register(Webhook{URL: target}); err == nil {
+				t.Errorf("expected url %q to be refused", target)
+			}
+		}
+	})
+}
+
+func TestPlayerServer_Webhooks(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	dispatcher, _ := newTestDispatcher(t, 3)
+
+	server, _ := setupTestServer(t)
+	server.Webhooks = dispatcher
+	server.Auth = NewAPIKeyAuthenticator(map[string]Principal{
+		"admin-key": {Subject: "admin", Players: []string{AnyPlayer}},
+		"alice-key": {Subject: "alice", Players: []string{"Alice"}},
+	})
+	server.Start()
+
+	serve := func(method, path, key, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		request.Header.Set(APIKeyHeader, key)
+		response := httptest.NewRecorder()
+		server.Handler.ServeHTTP(response, request)
+		return response
+	}
+
+	response := serve(http.MethodPost, "/webhooks", "alice-key", `{"url":"`+receiver.URL+`"}`)
+	if response.Code != http.StatusForbidden {
+		t.Errorf("POST /webhooks by a player returned wrong status code: got %v want %v", response.Code, http.StatusForbidden)
+	}
+
+	response = serve(http.MethodPost, "/webhooks", "admin-key", `{"url":"`+receiver.URL+`"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("POST /webhooks returned wrong status code: got %v want %v", response.Code, http.StatusCreated)
+	}
+	var created Webhook
+	json.NewDecoder(response.Body).Decode(&created)
+	if created.ID == "" || created.Secret == "" {
+		t.Errorf("expected the created webhook to have an ID and secret, got %+v", created)
+	}
+
+	response = serve(http.MethodGet, "/webhooks", "admin-key", "")
+	var listed []Webhook
+	json.NewDecoder(response.Body).Decode(&listed)
+	if len(listed) != 1 || listed[0].ID != created.ID || listed[0].Secret != "" {
+		t.Errorf("expected the webhook to be listed without its secret, got %+v", listed)
+	}
+
+	serve(http.MethodPut, "/user/Alice/score", "alice-key", "")
+	dispatcher.Close(context.Background())
+	if receiver.count() != 1 {
+		t.Errorf("expected the win to be delivered, got %d deliveries", receiver.count())
+	}
+
+	response = serve(http.MethodGet, "/webhooks/"+created.ID+"/deliveries", "admin-key", "")
+	var deliveries []WebhookDelivery
+	json.NewDecoder(response.Body).Decode(&deliveries)
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryDelivered {
+		t.Errorf("unexpected delivery log %+v", deliveries)
+	}
+
+	response = serve(http.MethodDelete, "/webhooks/"+created.ID, "admin-key", "")
+	if response.Code != http.StatusNoContent {
+		t.Errorf("DELETE returned wrong status code: got %v want %v", response.Code, http.StatusNoContent)
+	}
+	response = serve(http.MethodDelete, "/webhooks/"+created.ID, "admin-key", "")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("second DELETE returned wrong status code: got %v want %v", response.Code, http.StatusNotFound)
+	}
+}
+
+func TestWebhookDispatcher_Destinations(t *testing.T) {
+	dispatcher := NewWebhookDispatcher(WebhookConfig{})
+	defer dispatcher.Close(context.Background())
+	dispatcher.lookup = func(ctx context.Context, host string) ([]netip.Addr, error) {
+		switch host {
+		case "public.example":
+			return []netip.Addr{netip.MustParseAddr("93.184.215.14")}, nil
+		case "rebind.example":
+			return []netip.Addr{netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("10.0.0.1")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://public.example/hook", true},
+		{"https://93.184.215.14/hook", true},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://10.1.2.3/hook", false},
+		{"http://192.168.0.10/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"https://rebind.example/hook", false},
+		{"https://unknown.example/hook", false},
+	}
+	for _, tt := range tests {
+		_, err := dispatcher.Register(Webhook{URL: tt.url})
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("Register(%q) returned %v, want allowed %v", tt.url, err, tt.allowed)
+		}
+	}
+
+	// The address dialed is checked too, in case the host resolves differently later
+	receiver := newWebhookReceiver(t, 0)
+	client := &http.Client{Transport: publicTransport()}
+	if _, err := client.Post(receiver.URL, mediaJSON, nil); !errors.Is(err, ErrWebhookDestination) {
+		t.Errorf("expected dialing a loopback receiver to fail with %v, got %v", ErrWebhookDestination, err)
+	}
+	if receiver.count() != 0 {
+		t.Errorf("expected nothing to be delivered, got %d", receiver.count())
+	}
+}
+
+func TestPlayerServer_WebhooksNeedAuth(t *testing.T) {
+	dispatcher, _ := newTestDispatcher(t, 3)
+	defer dispatcher.Close(context.Background())
+	server, _ := setupTestServer(t)
+	server.Webhooks = dispatcher
+	server.Start()
+
+	request, _ := http.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"http://127.0.0.1/hook"}`))
+	response := httptest.NewRecorder()
+	server.Handler.ServeHTTP(response, request)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", response.Code, http.StatusNotFound)
+	}
+	if len(dispatcher.List()) != 0 {
+		t.Error("expected no webhook to be registered without Auth")
+	}
+}